@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/imdario/mergo"
+	"github.com/quintans/toolkit/clock"
 )
 
 var TimeoutError = errors.New("Circuit Breaker Timeout")
@@ -38,6 +39,8 @@ type Config struct {
 	Timeout      time.Duration
 	Maxfailures  int //consecutive failures
 	ResetTimeout time.Duration
+	// Clock used to measure timeouts. Defaults to the system clock.
+	Clock clock.Clock
 }
 
 type CircuitBreaker struct {
@@ -63,6 +66,7 @@ func New(cfg Config) *CircuitBreaker {
 	}
 
 	mergo.Merge(&cfg, defaultConfig)
+	cfg.Clock = clock.OrDefault(cfg.Clock)
 	cb.Config = cfg
 	return cb
 }
@@ -90,7 +94,7 @@ func (cb *CircuitBreaker) Try(fn func() error, fallback func(err error) error) <
 			cherr <- nil
 		}
 
-	}(cb.state == CLOSE || time.Now().After(cb.openUntil))
+	}(cb.state == CLOSE || cb.Clock.Now().After(cb.openUntil))
 	return cherr
 }
 
@@ -102,7 +106,7 @@ func (cb *CircuitBreaker) call(fn func() error) error {
 	if cb.Timeout != time.Duration(0) {
 		var err error
 		select {
-		case <-time.After(cb.Timeout):
+		case <-cb.Clock.After(cb.Timeout):
 			err = TimeoutError
 		case err = <-ch:
 		}
@@ -124,11 +128,11 @@ func (cb *CircuitBreaker) fail() {
 		cb.failures++
 		if cb.failures >= cb.Maxfailures {
 			cb.state = OPEN
-			cb.openUntil = time.Now().Add(cb.ResetTimeout)
+			cb.openUntil = cb.Clock.Now().Add(cb.ResetTimeout)
 			changed = true
 		}
 	} else {
-		cb.openUntil = time.Now().Add(cb.ResetTimeout)
+		cb.openUntil = cb.Clock.Now().Add(cb.ResetTimeout)
 	}
 
 	cb.Unlock()
@@ -160,7 +164,7 @@ func (cb *CircuitBreaker) State() EState {
 	defer cb.RUnlock()
 
 	if cb.state == OPEN {
-		if time.Now().After(cb.openUntil) {
+		if cb.Clock.Now().After(cb.openUntil) {
 			return HALFOPEN
 		} else {
 			return OPEN
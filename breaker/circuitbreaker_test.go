@@ -4,12 +4,16 @@ import (
 	"errors"
 	"testing"
 	"time"
+
+	"github.com/quintans/toolkit/clock"
 )
 
 func TestOpenSimple(t *testing.T) {
+	var clk = clock.NewFake(time.Now())
 	var cb = New(Config{
 		Maxfailures:  2,
 		ResetTimeout: time.Second,
+		Clock:        clk,
 	})
 	var calls = 0
 	var fails = 0
@@ -63,7 +67,7 @@ func TestOpenSimple(t *testing.T) {
 	}
 
 	// reset timeout
-	time.Sleep(time.Second * 2)
+	clk.Advance(time.Second * 2)
 	// calling failure and fallback
 	<-cb.Try(failure, fallback)
 	if cb.State() != OPEN {
@@ -89,7 +93,7 @@ func TestOpenSimple(t *testing.T) {
 	}
 
 	// reset timeout
-	time.Sleep(time.Second * 2)
+	clk.Advance(time.Second * 2)
 	// calling only success
 	<-cb.Try(success, fallback)
 	if cb.State() != CLOSE {
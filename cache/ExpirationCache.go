@@ -3,38 +3,54 @@ package cache
 import (
 	"sync"
 	"time"
+
+	"github.com/quintans/toolkit/clock"
 )
 
 type ExpirationCache struct {
 	items    map[string]*item
 	timeout  time.Duration
 	interval time.Duration
+	clock    clock.Clock
 	sync.Mutex
 }
 
+type Option func(*ExpirationCache)
+
+// WithClock sets the clock used to expire the items
+func WithClock(c clock.Clock) Option {
+	return func(cache *ExpirationCache) {
+		cache.clock = clock.OrDefault(c)
+	}
+}
+
 type item struct {
 	value      interface{}
 	expiration time.Time
 }
 
 // Returns true if the item has expired.
-func (i *item) expired() bool {
-	return i.expiration.Before(time.Now())
+func (i *item) expired(now time.Time) bool {
+	return i.expiration.Before(now)
 }
 
-func NewExpirationCache(timeout time.Duration, interval time.Duration) *ExpirationCache {
+func NewExpirationCache(timeout time.Duration, interval time.Duration, options ...Option) *ExpirationCache {
 	cache := new(ExpirationCache)
 	cache.items = make(map[string]*item)
 	cache.timeout = timeout
 	cache.interval = interval
+	cache.clock = clock.New()
+	for _, o := range options {
+		o(cache)
+	}
 	go cache.cleanup()
 	return cache
 }
 
 func (this *ExpirationCache) cleanup() {
-	tick := time.Tick(this.interval)
+	tick := this.clock.NewTicker(this.interval)
 	for {
-		<-tick
+		<-tick.C()
 		this.deleteExpired()
 	}
 }
@@ -43,8 +59,9 @@ func (this *ExpirationCache) cleanup() {
 func (this *ExpirationCache) deleteExpired() {
 	this.Lock()
 	defer this.Unlock()
+	now := this.clock.Now()
 	for k, v := range this.items {
-		if v.expired() {
+		if v.expired(now) {
 			delete(this.items, k)
 		}
 	}
@@ -56,7 +73,7 @@ func (this *ExpirationCache) GetIfPresentAndTouch(key string) interface{} {
 
 	v, ok := this.items[key]
 	if ok {
-		v.expiration = time.Now().Add(this.timeout)
+		v.expiration = this.clock.Now().Add(this.timeout)
 		return v.value
 	}
 	return nil
@@ -88,7 +105,7 @@ func (this *ExpirationCache) GetWithDuration(key string, callback func() interfa
 
 	v, ok := this.items[key]
 	if !ok {
-		v = &item{callback(), time.Now().Add(this.timeout)}
+		v = &item{callback(), this.clock.Now().Add(this.timeout)}
 		this.items[key] = v
 	}
 	return v.value
@@ -103,7 +120,7 @@ func (this *ExpirationCache) PutWithDuration(key string, value interface{}, dura
 	this.Lock()
 	// defer now sice I do not know what will happen in a out of memory error
 	defer this.Unlock()
-	this.items[key] = &item{value, time.Now().Add(duration)}
+	this.items[key] = &item{value, this.clock.Now().Add(duration)}
 }
 
 func (this *ExpirationCache) Touch(key string) {
@@ -114,7 +131,7 @@ func (this *ExpirationCache) TouchWithDuration(key string, duration time.Duratio
 	this.Lock()
 	v, ok := this.items[key]
 	if ok {
-		v.expiration = time.Now().Add(duration)
+		v.expiration = this.clock.Now().Add(duration)
 	}
 	this.Unlock()
 }
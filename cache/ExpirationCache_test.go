@@ -0,0 +1,33 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quintans/toolkit/clock"
+)
+
+func TestExpiration(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	cache := NewExpirationCache(time.Minute, time.Second, WithClock(clk))
+	cache.Put("one", "um")
+	cache.PutWithDuration("two", "dois", time.Hour)
+
+	clk.BlockUntil(1)
+	clk.Advance(30 * time.Second)
+	if cache.GetIfPresent("one") == nil {
+		t.Fatal("Expected 'one' to be present")
+	}
+
+	clk.Advance(31 * time.Second)
+	deadline := time.Now().Add(time.Second)
+	for cache.GetIfPresent("one") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected 'one' to be expired")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if cache.GetIfPresent("two") == nil {
+		t.Fatal("Expected 'two' to be present")
+	}
+}
@@ -0,0 +1,191 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+var _ Clock = &Fake{}
+
+// Fake is a Clock whose time only moves when Advance or Set are called.
+// Timers, tickers and sleeps fire, in order, as the time goes by them.
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+// NewFake creates a Fake clock set at now
+func NewFake(now time.Time) *Fake {
+	f := &Fake{
+		now: now,
+	}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return f.newTimer(d, 0)
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return fakeTicker{f.newTimer(d, d)}
+}
+
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// Advance moves the time forward, firing the timers that expire in the meantime.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	f.advanceTo(f.now.Add(d))
+	f.mu.Unlock()
+}
+
+// Set moves the time to t, firing the timers that expire in the meantime.
+// Setting a time in the past does not fire any timer.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	if t.After(f.now) {
+		f.advanceTo(t)
+	} else {
+		f.now = t
+	}
+	f.mu.Unlock()
+}
+
+// Waiters returns the number of active timers, tickers and sleeps
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil blocks until there are at least n active timers, tickers or sleeps.
+// It is used to make sure that the code under test is waiting on the clock before advancing it.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+func (f *Fake) advanceTo(end time.Time) {
+	for {
+		w := f.next(end)
+		if w == nil {
+			break
+		}
+		f.now = w.at
+		select {
+		case w.c <- w.at:
+		default:
+			// like time.Ticker, drop the tick if the reader is slow
+		}
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+		} else {
+			f.remove(w)
+		}
+	}
+	f.now = end
+}
+
+// next returns the earliest waiter expiring until end
+func (f *Fake) next(end time.Time) *fakeTimer {
+	var first *fakeTimer
+	for _, w := range f.waiters {
+		if !w.at.After(end) && (first == nil || w.at.Before(first.at)) {
+			first = w
+		}
+	}
+	return first
+}
+
+func (f *Fake) newTimer(d, period time.Duration) *fakeTimer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := &fakeTimer{
+		clock:  f,
+		c:      make(chan time.Time, 1),
+		period: period,
+	}
+	f.schedule(w, d)
+	return w
+}
+
+func (f *Fake) schedule(w *fakeTimer, d time.Duration) {
+	w.at = f.now.Add(d)
+	if d <= 0 && w.period == 0 {
+		// fires immediately
+		select {
+		case w.c <- f.now:
+		default:
+		}
+		return
+	}
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+}
+
+// remove returns true if the waiter was active
+func (f *Fake) remove(w *fakeTimer) bool {
+	for k, v := range f.waiters {
+		if v == w {
+			f.waiters = append(f.waiters[:k], f.waiters[k+1:]...)
+			f.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock  *Fake
+	c      chan time.Time
+	at     time.Time
+	period time.Duration
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.clock.remove(t)
+	t.clock.schedule(t, d)
+	return active
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
@@ -0,0 +1,53 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeTimers(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+
+	timer := f.NewTimer(time.Second)
+	ticker := f.NewTicker(300 * time.Millisecond)
+	defer ticker.Stop()
+
+	f.Advance(500 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("Timer should not have fired")
+	default:
+	}
+	if tick := <-ticker.C(); !tick.Equal(start.Add(300 * time.Millisecond)) {
+		t.Fatal("Unexpected tick", tick)
+	}
+
+	f.Advance(500 * time.Millisecond)
+	if fired := <-timer.C(); !fired.Equal(start.Add(time.Second)) {
+		t.Fatal("Unexpected timer time", fired)
+	}
+	if timer.Stop() {
+		t.Fatal("Expected an expired timer to not be active")
+	}
+	if !f.Now().Equal(start.Add(time.Second)) {
+		t.Fatal("Unexpected now", f.Now())
+	}
+}
+
+func TestFakeSleep(t *testing.T) {
+	f := NewFake(time.Now())
+	done := make(chan struct{})
+	go func() {
+		f.Sleep(time.Hour)
+		close(done)
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Hour)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Sleep to return")
+	}
+}
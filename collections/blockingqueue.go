@@ -0,0 +1,170 @@
+package collections
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrQueueFull  = errors.New("queue full")
+	ErrQueueEmpty = errors.New("queue empty")
+)
+
+// BlockingQueue is a bounded FIFO that blocks the producers when full and the consumers when empty.
+//
+// After Close, producers are rejected with ErrQueueClosed
+// and consumers can still take the remaining elements before getting ErrQueueClosed.
+//
+// BlockingQueue is safe for concurrent access.
+type BlockingQueue struct {
+	mu       sync.Mutex
+	elements []interface{}
+	head     int
+	size     int
+	closed   bool
+	// closed, and replaced, to wake up the waiting consumers or producers
+	notEmpty chan struct{}
+	notFull  chan struct{}
+}
+
+// NewBlockingQueue creates a BlockingQueue holding up to capacity elements.
+func NewBlockingQueue(capacity int) *BlockingQueue {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &BlockingQueue{
+		elements: make([]interface{}, capacity),
+		notEmpty: make(chan struct{}),
+		notFull:  make(chan struct{}),
+	}
+}
+
+// Put adds an element, waiting for space if the queue is full.
+func (this *BlockingQueue) Put(ctx context.Context, value interface{}) error {
+	return this.put(ctx, nil, value)
+}
+
+// Offer adds an element, waiting up to timeout for space if the queue is full.
+// A zero timeout does not wait. It returns ErrQueueFull if no space became available.
+func (this *BlockingQueue) Offer(value interface{}, timeout time.Duration) error {
+	expired, stop := deadline(timeout)
+	defer stop()
+	return this.put(context.Background(), expired, value)
+}
+
+// Take removes the oldest element, waiting for one if the queue is empty.
+func (this *BlockingQueue) Take(ctx context.Context) (interface{}, error) {
+	return this.take(ctx, nil)
+}
+
+// Poll removes the oldest element, waiting up to timeout for one if the queue is empty.
+// A zero timeout does not wait. It returns ErrQueueEmpty if no element became available.
+func (this *BlockingQueue) Poll(timeout time.Duration) (interface{}, error) {
+	expired, stop := deadline(timeout)
+	defer stop()
+	return this.take(context.Background(), expired)
+}
+
+func (this *BlockingQueue) put(ctx context.Context, expired <-chan time.Time, value interface{}) error {
+	this.mu.Lock()
+	for {
+		if this.closed {
+			this.mu.Unlock()
+			return ErrQueueClosed
+		}
+		if this.size < len(this.elements) {
+			this.elements[(this.head+this.size)%len(this.elements)] = value
+			this.size++
+			this.notEmpty = notify(this.notEmpty)
+			this.mu.Unlock()
+			return nil
+		}
+		notFull := this.notFull
+		this.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-expired:
+			return ErrQueueFull
+		case <-notFull:
+		}
+		this.mu.Lock()
+	}
+}
+
+func (this *BlockingQueue) take(ctx context.Context, expired <-chan time.Time) (interface{}, error) {
+	this.mu.Lock()
+	for {
+		if this.size > 0 {
+			value := this.elements[this.head]
+			this.elements[this.head] = nil
+			this.head = (this.head + 1) % len(this.elements)
+			this.size--
+			if !this.closed {
+				this.notFull = notify(this.notFull)
+			}
+			this.mu.Unlock()
+			return value, nil
+		}
+		if this.closed {
+			this.mu.Unlock()
+			return nil, ErrQueueClosed
+		}
+		notEmpty := this.notEmpty
+		this.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-expired:
+			return nil, ErrQueueEmpty
+		case <-notEmpty:
+		}
+		this.mu.Lock()
+	}
+}
+
+func (this *BlockingQueue) Size() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.size
+}
+
+func (this *BlockingQueue) Capacity() int {
+	return len(this.elements)
+}
+
+// Close rejects new elements and wakes up all waiting producers and consumers.
+func (this *BlockingQueue) Close() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.closed {
+		return
+	}
+	this.closed = true
+	close(this.notEmpty)
+	close(this.notFull)
+}
+
+// notify closes the channel, waking up whoever is waiting on it, and returns a new one.
+func notify(ch chan struct{}) chan struct{} {
+	close(ch)
+	return make(chan struct{})
+}
+
+// deadline returns a channel that fires after timeout.
+// A non positive timeout returns an already expired channel.
+func deadline(timeout time.Duration) (<-chan time.Time, func()) {
+	if timeout <= 0 {
+		ch := make(chan time.Time, 1)
+		ch <- time.Time{}
+		return ch, func() {}
+	}
+	t := time.NewTimer(timeout)
+	return t.C, func() { t.Stop() }
+}
@@ -0,0 +1,579 @@
+package collections
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	tk "github.com/quintans/toolkit"
+	"github.com/quintans/toolkit/clock"
+)
+
+var ErrQueueClosed = errors.New("queue closed")
+
+// DelayedItem is an item of a DelayQueue
+type DelayedItem struct {
+	ID    string
+	Value interface{}
+	Due   time.Time
+
+	index int
+}
+
+// DelayQueue holds items until they become due.
+// Items are taken in the order of their due time.
+//
+// DelayQueue is safe for concurrent access.
+type DelayQueue struct {
+	mu    sync.Mutex
+	items delayHeap
+	byID  map[string]*DelayedItem
+	// closed, and replaced, whenever the queue changes to wake up the takers
+	changed chan struct{}
+	closed  bool
+	clock   clock.Clock
+	log     *delayLog
+	// sync the log after every operation
+	logSync bool
+}
+
+type DelayQueueOption func(*DelayQueue) error
+
+// DelayQueueClock sets the clock used to check if the items are due
+func DelayQueueClock(c clock.Clock) DelayQueueOption {
+	return func(q *DelayQueue) error {
+		q.clock = clock.OrDefault(c)
+		return nil
+	}
+}
+
+// DelayQueueSync tells if the log of DelayQueuePersistence is synced to disk after every operation. Default is true.
+// Without it, Put and Cancel are faster but the last operations may be lost if the machine crashes,
+// though not if only the process does.
+func DelayQueueSync(sync bool) DelayQueueOption {
+	return func(q *DelayQueue) error {
+		q.logSync = sync
+		return nil
+	}
+}
+
+// DelayQueuePersistence stores the queue operations in a log file inside dir,
+// so that the pending items survive restarts.
+// Each operation is synced to disk before returning, unless disabled with DelayQueueSync.
+// If the log already exists, the queue is restored from it.
+//
+// codec: codec to convert between []byte and the item values
+// zero: zero value of the item values
+func DelayQueuePersistence(dir string, codec tk.Codec, zero interface{}) DelayQueueOption {
+	return func(q *DelayQueue) error {
+		if len(dir) == 0 {
+			return errors.New("dir is empty")
+		}
+		if codec == nil {
+			return errors.New("codec is nil")
+		}
+		if zero == nil {
+			return errors.New("zero is nil")
+		}
+		t := reflect.TypeOf(zero)
+		// if pointer user non pointer type
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		q.log = &delayLog{
+			dir:      dir,
+			codec:    codec,
+			dataType: t,
+		}
+		return nil
+	}
+}
+
+// NewDelayQueue creates a DelayQueue
+func NewDelayQueue(options ...DelayQueueOption) (*DelayQueue, error) {
+	q := &DelayQueue{
+		byID:    make(map[string]*DelayedItem),
+		changed: make(chan struct{}),
+		clock:   clock.New(),
+		logSync: true,
+	}
+	for _, o := range options {
+		if err := o(q); err != nil {
+			return nil, err
+		}
+	}
+
+	if q.log != nil {
+		q.log.sync = q.logSync
+		items, err := q.log.open()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range items {
+			q.byID[v.ID] = v
+			heap.Push(&q.items, v)
+		}
+	}
+
+	return q, nil
+}
+
+// Put adds an item that will be due at the given time.
+// If id is empty, a new one is generated. An item with the same id is replaced.
+// It returns the id of the item.
+func (q *DelayQueue) Put(id string, value interface{}, due time.Time) (string, error) {
+	if id == "" {
+		id = tk.NewUUID().String()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return "", ErrQueueClosed
+	}
+	if q.log != nil {
+		if err := q.log.put(id, value, due); err != nil {
+			return "", err
+		}
+	}
+
+	if old, ok := q.byID[id]; ok {
+		heap.Remove(&q.items, old.index)
+	}
+	item := &DelayedItem{
+		ID:    id,
+		Value: value,
+		Due:   due,
+	}
+	q.byID[id] = item
+	heap.Push(&q.items, item)
+	q.compact()
+
+	if item.index == 0 {
+		q.notify()
+	}
+	return id, nil
+}
+
+// PutAfter adds an item that will be due after delay
+func (q *DelayQueue) PutAfter(id string, value interface{}, delay time.Duration) (string, error) {
+	return q.Put(id, value, q.clock.Now().Add(delay))
+}
+
+// Cancel removes a pending item, returning false if it was not found
+func (q *DelayQueue) Cancel(id string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item, ok := q.byID[id]
+	if !ok {
+		return false, nil
+	}
+	if err := q.remove(item); err != nil {
+		return false, err
+	}
+	q.notify()
+	return true, nil
+}
+
+// Poll removes and returns the next due item or nil if there is none.
+func (q *DelayQueue) Poll() (*DelayedItem, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item, _, err := q.poll()
+	return item, err
+}
+
+// Take removes and returns the next due item, waiting for it if necessary.
+// It returns an error if the context is cancelled or the queue is closed.
+func (q *DelayQueue) Take(ctx context.Context) (*DelayedItem, error) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return nil, ErrQueueClosed
+		}
+		item, wait, err := q.poll()
+		changed := q.changed
+		q.mu.Unlock()
+		if item != nil || err != nil {
+			return item, err
+		}
+
+		var timeout <-chan time.Time
+		var timer clock.Timer
+		if wait > 0 {
+			timer = q.clock.NewTimer(wait)
+			timeout = timer.C()
+		}
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil, ctx.Err()
+		case <-changed:
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-timeout:
+		}
+	}
+}
+
+// Peek returns the next item, due or not, without removing it
+func (q *DelayQueue) Peek() *DelayedItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return nil
+	}
+	return q.items[0]
+}
+
+func (q *DelayQueue) Size() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
+
+// Close closes the queue, waking up any waiting Take.
+func (q *DelayQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	close(q.changed)
+	if q.log != nil {
+		return q.log.close()
+	}
+	return nil
+}
+
+// poll returns the next due item or the time to wait for it.
+// A zero wait means that there are no items.
+// Must be called with mu held.
+func (q *DelayQueue) poll() (*DelayedItem, time.Duration, error) {
+	if len(q.items) == 0 {
+		return nil, 0, nil
+	}
+	item := q.items[0]
+	wait := item.Due.Sub(q.clock.Now())
+	if wait > 0 {
+		return nil, wait, nil
+	}
+	if err := q.remove(item); err != nil {
+		return nil, 0, err
+	}
+	return item, 0, nil
+}
+
+// remove must be called with mu held
+func (q *DelayQueue) remove(item *DelayedItem) error {
+	if q.log != nil {
+		if err := q.log.remove(item.ID); err != nil {
+			return err
+		}
+	}
+	heap.Remove(&q.items, item.index)
+	delete(q.byID, item.ID)
+	q.compact()
+	return nil
+}
+
+// compact rewrites the log when there are too many obsolete records.
+// Must be called with mu held.
+func (q *DelayQueue) compact() {
+	if q.log == nil || !q.log.needsCompaction(len(q.items)) {
+		return
+	}
+	if err := q.log.compact(q.items); err != nil {
+		// compaction is an optimization. the log is still valid
+		logger.Errorf("unable to compact delay queue log %s: %+v", q.log.dir, err)
+	}
+}
+
+// notify wakes up all the takers. Must be called with mu held.
+func (q *DelayQueue) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+type delayHeap []*DelayedItem
+
+func (h delayHeap) Len() int           { return len(h) }
+func (h delayHeap) Less(i, j int) bool { return h[i].Due.Before(h[j].Due) }
+func (h delayHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *delayHeap) Push(x interface{}) {
+	item := x.(*DelayedItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*h = old[:n-1]
+	return item
+}
+
+const (
+	delayLogFile = "delayqueue.log"
+	opPut        = byte(1)
+	opRemove     = byte(2)
+	// minimum number of obsolete records before compacting
+	compactThreshold = 1024
+)
+
+// delayLog is an append only log of the DelayQueue operations.
+// Like the FileFifo, each record is prefixed by its size.
+type delayLog struct {
+	dir      string
+	codec    tk.Codec
+	dataType reflect.Type
+	file     *os.File
+	sync     bool
+	// number of records in the log
+	records int
+}
+
+// open replays the log returning the pending items
+func (l *delayLog) open() ([]*DelayedItem, error) {
+	err := os.MkdirAll(l.dir, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := l.replay()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*DelayedItem, 0, len(items))
+	for _, v := range items {
+		list = append(list, v)
+	}
+	// rewriting also discards any incomplete record left by a crash
+	if err := l.compact(list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (l *delayLog) path() string {
+	return filepath.Join(l.dir, delayLogFile)
+}
+
+func (l *delayLog) replay() (map[string]*DelayedItem, error) {
+	items := make(map[string]*DelayedItem)
+	f, err := os.Open(l.path())
+	if os.IsNotExist(err) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	buf := make([]byte, intByteSize)
+	for {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return items, nil
+			}
+			return nil, err
+		}
+		data := make([]byte, binary.BigEndian.Uint32(buf))
+		if _, err := io.ReadFull(r, data); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				// incomplete record
+				return items, nil
+			}
+			return nil, err
+		}
+
+		op, item, err := l.decode(data)
+		if err != nil {
+			return nil, err
+		}
+		if op == opRemove {
+			delete(items, item.ID)
+		} else {
+			items[item.ID] = item
+		}
+	}
+}
+
+// decode decodes a record returning the operation and the item
+func (l *delayLog) decode(data []byte) (byte, *DelayedItem, error) {
+	if len(data) < 1+intByteSize {
+		return 0, nil, ErrShortRead
+	}
+	op := data[0]
+	size := int(binary.BigEndian.Uint32(data[1:]))
+	data = data[1+intByteSize:]
+	if len(data) < size {
+		return 0, nil, ErrShortRead
+	}
+	item := &DelayedItem{
+		ID: string(data[:size]),
+	}
+	data = data[size:]
+	if op == opRemove {
+		return op, item, nil
+	}
+
+	if len(data) < 8 {
+		return 0, nil, ErrShortRead
+	}
+	item.Due = time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+	v := reflect.New(l.dataType)
+	if err := l.codec.Decode(data[8:], v.Interface()); err != nil {
+		return 0, nil, err
+	}
+	item.Value = v.Elem().Interface()
+	return op, item, nil
+}
+
+func (l *delayLog) encode(op byte, id string, value interface{}, due time.Time) ([]byte, error) {
+	var payload []byte
+	if op == opPut {
+		var err error
+		payload, err = l.codec.Encode(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	size := 1 + intByteSize + len(id)
+	if op == opPut {
+		size += 8 + len(payload)
+	}
+	data := make([]byte, intByteSize+size)
+	binary.BigEndian.PutUint32(data, uint32(size))
+	p := data[intByteSize:]
+	p[0] = op
+	binary.BigEndian.PutUint32(p[1:], uint32(len(id)))
+	p = p[1+intByteSize:]
+	copy(p, id)
+	if op == opPut {
+		p = p[len(id):]
+		binary.BigEndian.PutUint64(p, uint64(due.UnixNano()))
+		copy(p[8:], payload)
+	}
+	return data, nil
+}
+
+func (l *delayLog) append(op byte, id string, value interface{}, due time.Time) error {
+	data, err := l.encode(op, id, value, due)
+	if err != nil {
+		return err
+	}
+	n, err := l.file.Write(data)
+	if err != nil {
+		return err
+	} else if n < len(data) {
+		return io.ErrShortWrite
+	}
+	l.records++
+	if l.sync {
+		return l.file.Sync()
+	}
+	return nil
+}
+
+func (l *delayLog) put(id string, value interface{}, due time.Time) error {
+	return l.append(opPut, id, value, due)
+}
+
+func (l *delayLog) remove(id string) error {
+	return l.append(opRemove, id, nil, time.Time{})
+}
+
+func (l *delayLog) needsCompaction(live int) bool {
+	obsolete := l.records - live
+	return obsolete > compactThreshold && obsolete > live
+}
+
+// compact writes the live items to a new log and replaces the current one
+func (l *delayLog) compact(items []*DelayedItem) error {
+	tmp := l.path() + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, v := range items {
+		data, err := l.encode(opPut, v.ID, v.Value, v.Due)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	logger.Debugf("compacting delay queue log %s", l.path())
+	if err := os.Rename(tmp, l.path()); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.path(), os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = file
+	l.records = len(items)
+	return nil
+}
+
+func (l *delayLog) close() error {
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Sync()
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.file = nil
+	return err
+}
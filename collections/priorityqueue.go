@@ -0,0 +1,176 @@
+package collections
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// PQItem is the handle of a value stored in a PriorityQueue.
+// It is used to update the priority or to remove the value.
+type PQItem struct {
+	Value interface{}
+	index int
+}
+
+// PriorityQueue returns the values ordered by a comparator.
+type PriorityQueue struct {
+	mu   sync.RWMutex
+	lock bool
+
+	items pqHeap
+}
+
+// NewPriorityQueue creates a PriorityQueue where the values for which less returns true come out first.
+func NewPriorityQueue(less func(a, b interface{}) bool) *PriorityQueue {
+	return newPriorityQueue(less, false)
+}
+
+// NewLockPriorityQueue creates a PriorityQueue to be accessed concurrently
+func NewLockPriorityQueue(less func(a, b interface{}) bool) *PriorityQueue {
+	return newPriorityQueue(less, true)
+}
+
+func newPriorityQueue(less func(a, b interface{}) bool, lock bool) *PriorityQueue {
+	this := new(PriorityQueue)
+	this.items.less = less
+	this.lock = lock
+	return this
+}
+
+func (this *PriorityQueue) Size() int {
+	if this.lock {
+		this.mu.RLock()
+		defer this.mu.RUnlock()
+	}
+
+	return len(this.items.items)
+}
+
+// Clear removes all the values.
+func (this *PriorityQueue) Clear() {
+	if this.lock {
+		this.mu.Lock()
+		defer this.mu.Unlock()
+	}
+
+	for _, v := range this.items.items {
+		v.index = -1
+	}
+	this.items.items = nil
+}
+
+// Push adds a value, returning its handle.
+func (this *PriorityQueue) Push(value interface{}) *PQItem {
+	if this.lock {
+		this.mu.Lock()
+		defer this.mu.Unlock()
+	}
+
+	item := &PQItem{Value: value}
+	heap.Push(&this.items, item)
+	return item
+}
+
+// Pop removes and returns the value with the highest priority, or nil if empty.
+func (this *PriorityQueue) Pop() interface{} {
+	if this.lock {
+		this.mu.Lock()
+		defer this.mu.Unlock()
+	}
+
+	if len(this.items.items) == 0 {
+		return nil
+	}
+	return heap.Pop(&this.items).(*PQItem).Value
+}
+
+// Peek returns the value with the highest priority without removing it, or nil if empty.
+func (this *PriorityQueue) Peek() interface{} {
+	if this.lock {
+		this.mu.RLock()
+		defer this.mu.RUnlock()
+	}
+
+	if len(this.items.items) == 0 {
+		return nil
+	}
+	return this.items.items[0].Value
+}
+
+// Update replaces the value of an item and reorders the queue.
+// It returns false if the item is no longer in the queue.
+func (this *PriorityQueue) Update(item *PQItem, value interface{}) bool {
+	if this.lock {
+		this.mu.Lock()
+		defer this.mu.Unlock()
+	}
+
+	if !this.contains(item) {
+		return false
+	}
+	item.Value = value
+	heap.Fix(&this.items, item.index)
+	return true
+}
+
+// Fix reorders the queue after the priority of the item value was changed in place.
+// It returns false if the item is no longer in the queue.
+func (this *PriorityQueue) Fix(item *PQItem) bool {
+	if this.lock {
+		this.mu.Lock()
+		defer this.mu.Unlock()
+	}
+
+	if !this.contains(item) {
+		return false
+	}
+	heap.Fix(&this.items, item.index)
+	return true
+}
+
+// Remove removes an item, returning false if it is no longer in the queue.
+func (this *PriorityQueue) Remove(item *PQItem) bool {
+	if this.lock {
+		this.mu.Lock()
+		defer this.mu.Unlock()
+	}
+
+	if !this.contains(item) {
+		return false
+	}
+	heap.Remove(&this.items, item.index)
+	return true
+}
+
+func (this *PriorityQueue) contains(item *PQItem) bool {
+	return item != nil && item.index >= 0 && item.index < len(this.items.items) && this.items.items[item.index] == item
+}
+
+type pqHeap struct {
+	items []*PQItem
+	less  func(a, b interface{}) bool
+}
+
+func (h pqHeap) Len() int           { return len(h.items) }
+func (h pqHeap) Less(i, j int) bool { return h.less(h.items[i].Value, h.items[j].Value) }
+func (h pqHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *pqHeap) Push(x interface{}) {
+	item := x.(*PQItem)
+	item.index = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *pqHeap) Pop() interface{} {
+	old := h.items
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	h.items = old[:n-1]
+	return item
+}
@@ -0,0 +1,122 @@
+package test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	tk "github.com/quintans/toolkit"
+	"github.com/quintans/toolkit/clock"
+	"github.com/quintans/toolkit/collections"
+)
+
+const delayDir = "delay_test"
+
+func TestDelayQueueOrder(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	q, err := collections.NewDelayQueue(collections.DelayQueueClock(clk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	q.PutAfter("c", "three", 3*time.Second)
+	q.PutAfter("a", "one", time.Second)
+	q.PutAfter("b", "two", 2*time.Second)
+	q.PutAfter("x", "cancelled", 1500*time.Millisecond)
+	if ok, _ := q.Cancel("x"); !ok {
+		t.Fatal("Expected to cancel 'x'")
+	}
+
+	if item, _ := q.Poll(); item != nil {
+		t.Fatal("Expected no due item, got", item.ID)
+	}
+
+	result := make(chan string, 3)
+	go func() {
+		for i := 0; i < 3; i++ {
+			item, err := q.Take(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			result <- item.Value.(string)
+		}
+	}()
+
+	for _, expected := range []string{"one", "two", "three"} {
+		clk.BlockUntil(1)
+		clk.Advance(time.Second)
+		if v := <-result; v != expected {
+			t.Fatalf("Expected %s, got %s", expected, v)
+		}
+	}
+}
+
+func TestDelayQueueTakeCancel(t *testing.T) {
+	q, err := collections.NewDelayQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := q.Take(ctx); err != context.DeadlineExceeded {
+		t.Fatal("Expected deadline exceeded, got", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		q.Close()
+	}()
+	if _, err := q.Take(context.Background()); err != collections.ErrQueueClosed {
+		t.Fatal("Expected ErrQueueClosed, got", err)
+	}
+}
+
+func TestDelayQueuePersistence(t *testing.T) {
+	os.RemoveAll(delayDir)
+	defer os.RemoveAll(delayDir)
+
+	clk := clock.NewFake(time.Now())
+	q, err := collections.NewDelayQueue(
+		collections.DelayQueueClock(clk),
+		collections.DelayQueuePersistence(delayDir, tk.GobCodec{}, (*string)(nil)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.PutAfter("a", "one", time.Second)
+	q.PutAfter("b", "two", 2*time.Second)
+	q.PutAfter("c", "three", 3*time.Second)
+	q.Cancel("b")
+	clk.Advance(time.Second)
+	if item, _ := q.Poll(); item == nil || item.ID != "a" {
+		t.Fatal("Expected 'a' to be due")
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// restart
+	q, err = collections.NewDelayQueue(
+		collections.DelayQueueClock(clk),
+		collections.DelayQueuePersistence(delayDir, tk.GobCodec{}, (*string)(nil)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if q.Size() != 1 {
+		t.Fatal("Expected 1 item after restart, got", q.Size())
+	}
+	clk.Advance(2 * time.Second)
+	item, err := q.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item == nil || item.ID != "c" || item.Value.(string) != "three" {
+		t.Fatal("Expected item 'c' after restart, got", item)
+	}
+}
@@ -2,6 +2,7 @@ package test
 
 import (
 	"fmt"
+	"strconv"
 	"testing"
 
 	. "github.com/quintans/toolkit/collections"
@@ -29,25 +30,25 @@ func TestResize(t *testing.T) {
 	loop := 20
 	// Insert
 	for i := 0; i < loop; i++ {
-		hmap.Put(Str("Hello"+string(i)), i*10)
+		hmap.Put(Str("Hello"+strconv.Itoa(i)), i*10)
 	}
 	if hmap.Size() != loop {
-		t.Error("Expected "+string(loop)+", got ", hmap.Size())
+		t.Error("Expected "+strconv.Itoa(loop)+", got ", hmap.Size())
 	}
 	// Check
 	for i := 0; i < loop; i++ {
-		v, _ := hmap.Get(Str("Hello" + string(i)))
+		v, _ := hmap.Get(Str("Hello" + strconv.Itoa(i)))
 		k := i * 10
 		if k != v {
-			t.Error("Expected "+string(k)+", got ", v)
+			t.Error("Expected "+strconv.Itoa(k)+", got ", v)
 		}
 	}
 	// Delete
 	for i := 0; i < loop; i++ {
-		v := hmap.Delete(Str("Hello" + string(i)))
+		v := hmap.Delete(Str("Hello" + strconv.Itoa(i)))
 		k := i * 10
 		if k != v {
-			t.Error("Expected deletion of "+string(k)+", got ", v)
+			t.Error("Expected deletion of "+strconv.Itoa(k)+", got ", v)
 		}
 	}
 	if hmap.Size() != 0 {
@@ -56,10 +57,10 @@ func TestResize(t *testing.T) {
 }
 
 var dics = []KeyValue{
-	KeyValue{Str("Martim"), 9},
-	KeyValue{Str("Paulo"), 41},
-	KeyValue{Str("Monica"), 33},
-	KeyValue{Str("Francisca"), 15},
+	KeyValue{Key: Str("Martim"), Value: 9},
+	KeyValue{Key: Str("Paulo"), Value: 41},
+	KeyValue{Key: Str("Monica"), Value: 33},
+	KeyValue{Key: Str("Francisca"), Value: 15},
 }
 
 func TestHashMapIterator(t *testing.T) {
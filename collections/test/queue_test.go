@@ -0,0 +1,122 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/quintans/toolkit/collections"
+)
+
+type task struct {
+	name     string
+	priority int
+}
+
+func TestPriorityQueue(t *testing.T) {
+	pq := collections.NewPriorityQueue(func(a, b interface{}) bool {
+		return a.(*task).priority > b.(*task).priority
+	})
+	pq.Push(&task{"low", 1})
+	mid := pq.Push(&task{"mid", 5})
+	pq.Push(&task{"high", 10})
+	gone := pq.Push(&task{"gone", 7})
+
+	if !pq.Remove(gone) {
+		t.Fatal("Expected to remove 'gone'")
+	}
+	if pq.Remove(gone) {
+		t.Fatal("Expected 'gone' to be already removed")
+	}
+	if pq.Peek().(*task).name != "high" {
+		t.Fatal("Expected 'high' to be at the head, got", pq.Peek())
+	}
+
+	mid.Value.(*task).priority = 20
+	pq.Fix(mid)
+	pq.Update(mid, &task{"urgent", 30})
+
+	for _, expected := range []string{"urgent", "high", "low"} {
+		v := pq.Pop()
+		if v == nil || v.(*task).name != expected {
+			t.Fatalf("Expected %s, got %v", expected, v)
+		}
+	}
+	if pq.Size() != 0 || pq.Pop() != nil {
+		t.Fatal("Expected empty queue")
+	}
+}
+
+func TestBlockingQueueOfferPoll(t *testing.T) {
+	q := collections.NewBlockingQueue(2)
+	if err := q.Offer(1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Offer(2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Offer(3, 20*time.Millisecond); err != collections.ErrQueueFull {
+		t.Fatal("Expected ErrQueueFull, got", err)
+	}
+
+	if v, err := q.Poll(0); err != nil || v != 1 {
+		t.Fatal("Expected 1, got", v, err)
+	}
+	if v, err := q.Poll(0); err != nil || v != 2 {
+		t.Fatal("Expected 2, got", v, err)
+	}
+	if _, err := q.Poll(20 * time.Millisecond); err != collections.ErrQueueEmpty {
+		t.Fatal("Expected ErrQueueEmpty, got", err)
+	}
+}
+
+func TestBlockingQueueProducerConsumer(t *testing.T) {
+	q := collections.NewBlockingQueue(3)
+	ctx := context.Background()
+	const total = 100
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < total; i++ {
+			if err := q.Put(ctx, i); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		q.Close()
+	}()
+
+	next := 0
+	for {
+		v, err := q.Take(ctx)
+		if err == collections.ErrQueueClosed {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != next {
+			t.Fatalf("Expected %d, got %v", next, v)
+		}
+		next++
+	}
+	wg.Wait()
+	if next != total {
+		t.Fatalf("Expected %d elements, got %d", total, next)
+	}
+	if err := q.Put(ctx, 1); err != collections.ErrQueueClosed {
+		t.Fatal("Expected ErrQueueClosed, got", err)
+	}
+}
+
+func TestBlockingQueueContext(t *testing.T) {
+	q := collections.NewBlockingQueue(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := q.Take(ctx); err != context.DeadlineExceeded {
+		t.Fatal("Expected DeadlineExceeded, got", err)
+	}
+}
@@ -7,21 +7,19 @@ import (
 	"time"
 
 	"github.com/hashicorp/consul/api"
+	"github.com/quintans/toolkit/lock"
 )
 
+var _ lock.Locker = &Lock{}
+
 type Pool struct {
 	client *api.Client
 }
 
 func NewPool(consulAddress string) (Pool, error) {
-	api.DefaultConfig()
 	client, err := api.NewClient(&api.Config{Address: consulAddress})
 	if err != nil {
-		return Pool{}, err
-	}
-
-	if err != nil {
-		return Pool{}, fmt.Errorf("session create err: %v", err)
+		return Pool{}, fmt.Errorf("client create err: %w", err)
 	}
 
 	return Pool{
@@ -29,11 +27,44 @@ func NewPool(consulAddress string) (Pool, error) {
 	}, nil
 }
 
-func (p Pool) NewLock(lockName string, expiry time.Duration) *Lock {
+type options struct {
+	backoff lock.Backoff
+	value   []byte
+}
+
+// Option configures a Lock, Semaphore or RWLock
+type Option func(*options)
+
+// WithBackoff sets the delays between the attempts of LockWait. Default is lock.DefaultBackoff.
+func WithBackoff(b lock.Backoff) Option {
+	return func(o *options) {
+		o.backoff = b
+	}
+}
+
+// WithValue sets the value stored in the lock key while the lock is held. Default is the session ID.
+func WithValue(value []byte) Option {
+	return func(o *options) {
+		o.value = value
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		backoff: lock.DefaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (p Pool) NewLock(lockName string, expiry time.Duration, options ...Option) *Lock {
 	return &Lock{
 		client:   p.client,
 		lockName: lockName,
 		expiry:   expiry,
+		opts:     newOptions(options),
 	}
 }
 
@@ -42,37 +73,38 @@ type Lock struct {
 	sID      string
 	lockName string
 	expiry   time.Duration
+	opts     options
 	done     chan struct{}
 	mu       sync.Mutex
 }
 
-func (l *Lock) Lock(ctx context.Context) (chan struct{}, error) {
+func (l *Lock) Lock(ctx context.Context) (<-chan struct{}, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	if l.done != nil {
-		return nil, fmt.Errorf("this lock '%s' is already acquire. Unlock it first", l.lockName)
+		return nil, fmt.Errorf("lock '%s': %w", l.lockName, lock.ErrAlreadyAcquired)
 	}
 
-	sEntry := &api.SessionEntry{
-		TTL:      l.expiry.String(),
-		Behavior: "delete",
-	}
 	options := &api.WriteOptions{}
 	options = options.WithContext(ctx)
-	sID, _, err := l.client.Session().Create(sEntry, options)
+	sID, err := createSession(ctx, l.client, l.expiry)
 	if err != nil {
 		return nil, err
 	}
 
-	l.sID = sID
+	value := l.opts.value
+	if value == nil {
+		value = []byte(sID)
+	}
 	acquireKv := &api.KVPair{
-		Session: l.sID,
+		Session: sID,
 		Key:     l.lockName,
-		Value:   []byte(sID),
+		Value:   value,
 	}
 	acquired, _, err := l.client.KV().Acquire(acquireKv, options)
 	if err != nil {
+		_, _ = l.client.Session().Destroy(sID, options)
 		return nil, err
 	}
 
@@ -81,57 +113,117 @@ func (l *Lock) Lock(ctx context.Context) (chan struct{}, error) {
 		return nil, nil
 	}
 
-	// auto renew session
-	l.done = make(chan struct{})
-	go func() {
-		// we use a new options because context may no longer be usable
-		err := l.client.Session().RenewPeriodic(sEntry.TTL, sID, &api.WriteOptions{}, l.done)
+	l.sID = sID
+	done := make(chan struct{})
+	l.done = done
+	go keepAlive(l.client, sID, l.expiry, done, func() {
+		l.release(context.Background(), done)
+	})
+
+	return done, nil
+}
+
+// LockWait keeps trying to acquire the lock until it succeeds or the context is done.
+// Between attempts it waits, with a blocking query, for the lock key to change or for the backoff delay,
+// whatever comes first.
+func (l *Lock) LockWait(ctx context.Context) (<-chan struct{}, error) {
+	return lock.Retry(ctx, l.opts.backoff, l.Lock, func(ctx context.Context, timeout time.Duration) error {
+		kv, meta, err := l.get(ctx, 0, 0)
 		if err != nil {
-			_ = l.Unlock(options.Context())
+			return err
+		}
+		if kv == nil {
+			return nil
+		}
+		_, _, err = l.get(ctx, meta.LastIndex, timeout)
+		return err
+	})
+}
+
+// Holder returns the value stored by the current holder of the lock, or nil if the lock is free
+func (l *Lock) Holder(ctx context.Context) ([]byte, error) {
+	kv, _, err := l.get(ctx, 0, 0)
+	if err != nil || kv == nil {
+		return nil, err
+	}
+	return kv.Value, nil
+}
+
+// get reads the lock key. If waitIndex is greater than zero,
+// it blocks until the key changes after that index or until waitTime elapses.
+func (l *Lock) get(ctx context.Context, waitIndex uint64, waitTime time.Duration) (*api.KVPair, *api.QueryMeta, error) {
+	opts := &api.QueryOptions{
+		WaitIndex: waitIndex,
+		WaitTime:  waitTime,
+	}
+	opts = opts.WithContext(ctx)
+	kv, meta, err := l.client.KV().Get(l.lockName, opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
 		}
-	}()
+		return nil, nil, err
+	}
+	return kv, meta, nil
+}
 
-	return l.done, nil
+func (l *Lock) TryLock(ctx context.Context) (bool, error) {
+	done, err := l.Lock(ctx)
+	return done != nil, err
 }
 
 func (l *Lock) Unlock(ctx context.Context) error {
+	l.mu.Lock()
+	done := l.done
+	l.mu.Unlock()
+
+	return l.release(ctx, done)
+}
+
+// release releases the lock if it is still the one identified by done
+func (l *Lock) release(ctx context.Context, done chan struct{}) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	if l.done == nil {
+	if done == nil || l.done != done {
 		return nil
 	}
 
 	close(l.done)
 	l.done = nil
 
-	return nil
+	// destroying the session deletes the key, releasing the lock
+	options := &api.WriteOptions{}
+	options = options.WithContext(ctx)
+	_, err := l.client.Session().Destroy(l.sID, options)
+	l.sID = ""
+	return err
 }
 
-func (l *Lock) WaitForUnlock(ctx context.Context) error {
-	opts := &api.QueryOptions{}
-	opts = opts.WithContext(ctx)
+func (l *Lock) Done() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	done := make(chan error, 1)
-	heartbeat := l.expiry / 2
-
-	go func() {
-		ticker := time.NewTicker(heartbeat)
-		defer ticker.Stop()
-		for {
-			kv, _, err := l.client.KV().Get(l.lockName, opts)
-			if err != nil {
-				done <- err
-				return
-			}
-			if kv == nil {
-				done <- nil
-				return
-			}
-			<-ticker.C
-		}
-	}()
-	err := <-done
+	return l.done
+}
 
-	return err
+// WaitForUnlock blocks until the lock key no longer exists,
+// using blocking queries on the key modify index.
+func (l *Lock) WaitForUnlock(ctx context.Context) error {
+	var index uint64
+	for {
+		kv, meta, err := l.get(ctx, index, l.expiry)
+		if err != nil {
+			return err
+		}
+		if kv == nil {
+			return nil
+		}
+		// a lower index means that the key was recreated
+		if meta.LastIndex < index {
+			index = 0
+		} else {
+			index = meta.LastIndex
+		}
+	}
 }
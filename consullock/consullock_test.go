@@ -2,12 +2,15 @@ package consullock_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/docker/go-connections/nat"
 	"github.com/quintans/toolkit/consullock"
+	"github.com/quintans/toolkit/lock"
+	"github.com/quintans/toolkit/lock/locktest"
 	"github.com/stretchr/testify/require"
 	testcontainers "github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -90,3 +93,129 @@ func TestConsul(t *testing.T) {
 	require.NoError(t, err)
 	require.True(t, time.Now().Sub(start) > wait, "Waiting duration for lock was too short")
 }
+
+func TestConsulConformance(t *testing.T) {
+	ctx := context.Background()
+	container, addr, err := Setup(ctx)
+	require.NoError(t, err)
+	defer container.Terminate(ctx)
+
+	locktest.Run(t, func(t *testing.T, name string) lock.Locker {
+		pool, err := consullock.NewPool(addr)
+		require.NoError(t, err)
+		return pool.NewLock(name, 10*time.Second)
+	})
+}
+
+func TestSemaphore(t *testing.T) {
+	ctx := context.Background()
+	container, addr, err := Setup(ctx)
+	require.NoError(t, err)
+	defer container.Terminate(ctx)
+
+	pool, err := consullock.NewPool(addr)
+	require.NoError(t, err)
+
+	t.Run("Conformance", func(t *testing.T) {
+		locktest.Run(t, func(t *testing.T, name string) lock.Locker {
+			return pool.NewSemaphore(name, 1, 10*time.Second)
+		})
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		var sems []lock.Locker
+		for i := 0; i < 4; i++ {
+			sems = append(sems, pool.NewSemaphore("exports", 3, 2*time.Second))
+		}
+		for i := 0; i < 3; i++ {
+			ok, err := sems[i].TryLock(ctx)
+			require.NoError(t, err)
+			require.True(t, ok, "Expected to acquire permit %d", i)
+		}
+		ok, err := sems[3].TryLock(ctx)
+		require.NoError(t, err)
+		require.False(t, ok, "Expected no permits available")
+
+		// permits are kept alive
+		time.Sleep(3 * time.Second)
+		ok, err = sems[3].TryLock(ctx)
+		require.NoError(t, err)
+		require.False(t, ok, "Expected no permits available")
+
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			sems[0].Unlock(ctx)
+		}()
+		done, err := sems[3].LockWait(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, done)
+		for _, s := range sems {
+			require.NoError(t, s.Unlock(ctx))
+		}
+	})
+
+	t.Run("LimitMismatch", func(t *testing.T) {
+		s1 := pool.NewSemaphore("jobs", 2, 2*time.Second)
+		s2 := pool.NewSemaphore("jobs", 3, 2*time.Second)
+
+		ok, err := s1.TryLock(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+		_, err = s2.TryLock(ctx)
+		require.True(t, errors.Is(err, consullock.ErrLimitMismatch), "Expected limit mismatch, got %v", err)
+
+		// without holders, the limit can change
+		require.NoError(t, s1.Unlock(ctx))
+		ok, err = s2.TryLock(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.NoError(t, s2.Unlock(ctx))
+	})
+}
+
+func TestRWLock(t *testing.T) {
+	ctx := context.Background()
+	container, addr, err := Setup(ctx)
+	require.NoError(t, err)
+	defer container.Terminate(ctx)
+
+	pool, err := consullock.NewPool(addr)
+	require.NoError(t, err)
+
+	t.Run("Conformance", func(t *testing.T) {
+		locktest.Run(t, func(t *testing.T, name string) lock.Locker {
+			return pool.NewRWLock(name, 10*time.Second).Locker()
+		})
+	})
+
+	t.Run("ReadWrite", func(t *testing.T) {
+		r1 := pool.NewRWLock("data", 10*time.Second).RLocker()
+		r2 := pool.NewRWLock("data", 10*time.Second).RLocker()
+		w := pool.NewRWLock("data", 10*time.Second).Locker()
+
+		ok, err := r1.TryLock(ctx)
+		require.NoError(t, err)
+		require.True(t, ok, "Expected readers to share the lock")
+		ok, err = r2.TryLock(ctx)
+		require.NoError(t, err)
+		require.True(t, ok, "Expected readers to share the lock")
+		ok, err = w.TryLock(ctx)
+		require.NoError(t, err)
+		require.False(t, ok, "Expected writer to wait for readers")
+
+		require.NoError(t, r1.Unlock(ctx))
+		require.NoError(t, r2.Unlock(ctx))
+		ok, err = w.TryLock(ctx)
+		require.NoError(t, err)
+		require.True(t, ok, "Expected writer to acquire the lock")
+		ok, err = r1.TryLock(ctx)
+		require.NoError(t, err)
+		require.False(t, ok, "Expected reader to wait for writer")
+
+		require.NoError(t, w.Unlock(ctx))
+		ok, err = r1.TryLock(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.NoError(t, r1.Unlock(ctx))
+	})
+}
@@ -0,0 +1,390 @@
+package consullock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/quintans/toolkit/lock"
+)
+
+var _ lock.Locker = &Semaphore{}
+
+// ErrLimitMismatch is returned when the semaphore is held by contenders created with a different limit
+var ErrLimitMismatch = errors.New("semaphore limit mismatch")
+
+// semaphoreLockKey is the key, under the semaphore prefix, holding the semaphore state
+const semaphoreLockKey = ".lock"
+
+type holderKind string
+
+const (
+	kindPermit holderKind = "permit"
+	kindRead   holderKind = "read"
+	kindWrite  holderKind = "write"
+)
+
+// semaphoreState is the content of the semaphore lock key
+type semaphoreState struct {
+	Limit   int                   `json:"limit"`
+	Holders map[string]holderKind `json:"holders"`
+}
+
+// Semaphore is a distributed semaphore allowing up to limit concurrent holders,
+// using the consul semaphore pattern:
+// each contender holds, with its session, a key under the prefix
+// and the holders are registered, with check-and-set, in the prefix lock key.
+// Holders whose session expired are pruned by the next contender.
+// The lock key also records the limit, and contenders with a different limit are rejected with ErrLimitMismatch
+// while there are holders.
+//
+// A Semaphore instance represents one contender and implements lock.Locker,
+// where acquiring the lock means acquiring a permit.
+type Semaphore struct {
+	client *api.Client
+	prefix string
+	limit  int
+	kind   holderKind
+	expiry time.Duration
+	opts   options
+
+	mu        sync.Mutex
+	acquiring bool
+	sID       string
+	done      chan struct{}
+}
+
+// NewSemaphore creates a contender for the semaphore under prefix allowing up to limit holders
+func (p Pool) NewSemaphore(prefix string, limit int, expiry time.Duration, options ...Option) *Semaphore {
+	return newSemaphore(p.client, prefix, limit, kindPermit, expiry, options)
+}
+
+func newSemaphore(client *api.Client, prefix string, limit int, kind holderKind, expiry time.Duration, options []Option) *Semaphore {
+	if limit < 1 {
+		limit = 1
+	}
+	return &Semaphore{
+		client: client,
+		prefix: prefix,
+		limit:  limit,
+		kind:   kind,
+		expiry: expiry,
+		opts:   newOptions(options),
+	}
+}
+
+// RWLock is a distributed read/write lock.
+// Any number of readers can hold the lock, as long as there is no writer.
+// A writer only acquires the lock when there are no readers, so a steady stream of readers can starve the writers.
+type RWLock struct {
+	r *Semaphore
+	w *Semaphore
+}
+
+// NewRWLock creates a contender, for reading and for writing, for the lock under prefix
+func (p Pool) NewRWLock(prefix string, expiry time.Duration, options ...Option) *RWLock {
+	return &RWLock{
+		r: newSemaphore(p.client, prefix, 1, kindRead, expiry, options),
+		w: newSemaphore(p.client, prefix, 1, kindWrite, expiry, options),
+	}
+}
+
+// RLocker returns the contender for the shared read lock
+func (rw *RWLock) RLocker() lock.Locker {
+	return rw.r
+}
+
+// Locker returns the contender for the exclusive write lock
+func (rw *RWLock) Locker() lock.Locker {
+	return rw.w
+}
+
+func (s *Semaphore) lockKey() string {
+	return path.Join(s.prefix, semaphoreLockKey)
+}
+
+func (s *Semaphore) contenderKey(sID string) string {
+	return path.Join(s.prefix, sID)
+}
+
+func (s *Semaphore) Lock(ctx context.Context) (<-chan struct{}, error) {
+	s.mu.Lock()
+	if s.done != nil || s.acquiring {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("semaphore '%s': %w", s.prefix, lock.ErrAlreadyAcquired)
+	}
+	s.acquiring = true
+	s.mu.Unlock()
+
+	sID, err := s.acquire(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acquiring = false
+	if sID == "" {
+		return nil, err
+	}
+
+	s.sID = sID
+	done := make(chan struct{})
+	s.done = done
+	go keepAlive(s.client, sID, s.expiry, done, func() {
+		s.release(context.Background(), done)
+	})
+
+	return done, nil
+}
+
+// acquire registers a contender and adds it to the holders, if there is a permit available.
+// It returns an empty session id if the permit was not acquired.
+func (s *Semaphore) acquire(ctx context.Context) (string, error) {
+	sID, err := createSession(ctx, s.client, s.expiry)
+	if err != nil {
+		return "", err
+	}
+
+	// the contender key is deleted when the session is destroyed or expires
+	options := &api.WriteOptions{}
+	options = options.WithContext(ctx)
+	value := s.opts.value
+	if value == nil {
+		value = []byte(sID)
+	}
+	ok, _, err := s.client.KV().Acquire(&api.KVPair{
+		Session: sID,
+		Key:     s.contenderKey(sID),
+		Value:   value,
+	}, options)
+	if err == nil && !ok {
+		err = fmt.Errorf("semaphore '%s': unable to register contender", s.prefix)
+	}
+	if err != nil {
+		_ = destroySession(ctx, s.client, sID)
+		return "", err
+	}
+
+	var errLimit error
+	acquired, err := s.update(ctx, func(state *semaphoreState) bool {
+		if errLimit = s.checkLimit(state); errLimit != nil {
+			return false
+		}
+		if !s.available(state) {
+			return false
+		}
+		state.Limit = s.limit
+		state.Holders[sID] = s.kind
+		return true
+	})
+	if err == nil {
+		err = errLimit
+	}
+	if err != nil || !acquired {
+		_ = destroySession(ctx, s.client, sID)
+		return "", err
+	}
+	return sID, nil
+}
+
+// LockWait keeps trying to acquire a permit until it succeeds or the context is done.
+// Between attempts it waits, with a blocking query, for the semaphore keys to change or for the backoff delay,
+// whatever comes first.
+func (s *Semaphore) LockWait(ctx context.Context) (<-chan struct{}, error) {
+	return lock.Retry(ctx, s.opts.backoff, s.Lock, func(ctx context.Context, timeout time.Duration) error {
+		_, meta, err := s.list(ctx, 0, 0)
+		if err != nil {
+			return err
+		}
+		_, _, err = s.list(ctx, meta.LastIndex, timeout)
+		return err
+	})
+}
+
+func (s *Semaphore) TryLock(ctx context.Context) (bool, error) {
+	done, err := s.Lock(ctx)
+	return done != nil, err
+}
+
+func (s *Semaphore) Unlock(ctx context.Context) error {
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+
+	return s.release(ctx, done)
+}
+
+// release releases the permit if it is still the one identified by done
+func (s *Semaphore) release(ctx context.Context, done chan struct{}) error {
+	s.mu.Lock()
+	if done == nil || s.done != done {
+		s.mu.Unlock()
+		return nil
+	}
+	close(s.done)
+	s.done = nil
+	sID := s.sID
+	s.sID = ""
+	s.mu.Unlock()
+
+	_, err := s.update(ctx, func(state *semaphoreState) bool {
+		if _, ok := state.Holders[sID]; !ok {
+			return false
+		}
+		delete(state.Holders, sID)
+		return true
+	})
+	// destroying the session also deletes the contender key
+	if err2 := destroySession(ctx, s.client, sID); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (s *Semaphore) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.done
+}
+
+// WaitForUnlock blocks until a permit is available,
+// using blocking queries on the semaphore prefix.
+func (s *Semaphore) WaitForUnlock(ctx context.Context) error {
+	var index uint64
+	for {
+		pairs, meta, err := s.list(ctx, index, s.expiry)
+		if err != nil {
+			return err
+		}
+		state, _, err := s.state(pairs)
+		if err != nil {
+			return err
+		}
+		if err := s.checkLimit(state); err != nil {
+			return err
+		}
+		if s.available(state) {
+			return nil
+		}
+		// a lower index means that the keys were recreated
+		if meta.LastIndex < index {
+			index = 0
+		} else {
+			index = meta.LastIndex
+		}
+	}
+}
+
+// checkLimit returns ErrLimitMismatch if the semaphore has holders with a different limit.
+// Without holders, the limit of the next holder is the one recorded.
+func (s *Semaphore) checkLimit(state *semaphoreState) error {
+	if len(state.Holders) > 0 && state.Limit != 0 && state.Limit != s.limit {
+		return fmt.Errorf("semaphore '%s': %w (holders: %d, contender: %d)", s.prefix, ErrLimitMismatch, state.Limit, s.limit)
+	}
+	return nil
+}
+
+// available returns true if the state admits one more holder of this kind
+func (s *Semaphore) available(state *semaphoreState) bool {
+	count := 0
+	for _, kind := range state.Holders {
+		switch {
+		case s.kind == kindWrite:
+			// a writer excludes everyone
+			return false
+		case kind == kindWrite:
+			return false
+		case kind == s.kind:
+			count++
+		}
+	}
+	return s.kind == kindRead || count < s.limit
+}
+
+// update applies fn to the current semaphore state and, if fn returns true,
+// writes the new state with check-and-set, retrying if the state was concurrently changed.
+// It returns the result of fn.
+func (s *Semaphore) update(ctx context.Context, fn func(*semaphoreState) bool) (bool, error) {
+	for {
+		pairs, _, err := s.list(ctx, 0, 0)
+		if err != nil {
+			return false, err
+		}
+		state, modifyIndex, err := s.state(pairs)
+		if err != nil {
+			return false, err
+		}
+		if !fn(state) {
+			return false, nil
+		}
+
+		value, err := json.Marshal(state)
+		if err != nil {
+			return false, err
+		}
+		options := &api.WriteOptions{}
+		options = options.WithContext(ctx)
+		ok, _, err := s.client.KV().CAS(&api.KVPair{
+			Key:         s.lockKey(),
+			Value:       value,
+			ModifyIndex: modifyIndex,
+		}, options)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+}
+
+// state decodes the semaphore state from the keys under the prefix,
+// pruning the holders without a live contender key.
+// It also returns the modify index of the lock key, or zero if it does not exist.
+func (s *Semaphore) state(pairs api.KVPairs) (*semaphoreState, uint64, error) {
+	state := &semaphoreState{}
+	var modifyIndex uint64
+	live := map[string]bool{}
+	lockKey := s.lockKey()
+	for _, kv := range pairs {
+		if kv.Key == lockKey {
+			modifyIndex = kv.ModifyIndex
+			if err := json.Unmarshal(kv.Value, state); err != nil {
+				return nil, 0, fmt.Errorf("semaphore '%s': invalid state: %w", s.prefix, err)
+			}
+		} else if kv.Session != "" {
+			live[kv.Session] = true
+		}
+	}
+	if state.Holders == nil {
+		state.Holders = map[string]holderKind{}
+	}
+	for sID := range state.Holders {
+		if !live[sID] {
+			delete(state.Holders, sID)
+		}
+	}
+	return state, modifyIndex, nil
+}
+
+// list reads the keys under the prefix. If waitIndex is greater than zero,
+// it blocks until the keys change after that index or until waitTime elapses.
+func (s *Semaphore) list(ctx context.Context, waitIndex uint64, waitTime time.Duration) (api.KVPairs, *api.QueryMeta, error) {
+	opts := &api.QueryOptions{
+		WaitIndex: waitIndex,
+		WaitTime:  waitTime,
+	}
+	opts = opts.WithContext(ctx)
+	pairs, meta, err := s.client.KV().List(s.prefix+"/", opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, err
+	}
+	return pairs, meta, nil
+}
@@ -0,0 +1,37 @@
+package consullock
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// createSession creates a session that deletes the keys it holds when it is destroyed or expires
+func createSession(ctx context.Context, client *api.Client, expiry time.Duration) (string, error) {
+	sEntry := &api.SessionEntry{
+		TTL:      expiry.String(),
+		Behavior: "delete",
+	}
+	options := &api.WriteOptions{}
+	options = options.WithContext(ctx)
+	sID, _, err := client.Session().Create(sEntry, options)
+	return sID, err
+}
+
+// keepAlive renews the session until done is closed.
+// If the session is lost, lost is called.
+func keepAlive(client *api.Client, sID string, expiry time.Duration, done chan struct{}, lost func()) {
+	// we use a new options because context may no longer be usable
+	err := client.Session().RenewPeriodic(expiry.String(), sID, &api.WriteOptions{}, done)
+	if err != nil {
+		lost()
+	}
+}
+
+func destroySession(ctx context.Context, client *api.Client, sID string) error {
+	options := &api.WriteOptions{}
+	options = options.WithContext(ctx)
+	_, err := client.Session().Destroy(sID, options)
+	return err
+}
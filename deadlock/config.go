@@ -0,0 +1,136 @@
+package deadlock
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// EnvVar is the environment variable that, set to 0, false or off,
+// disables the detection of the instrumented mutexes at startup.
+// It can only disable the detection: any other value, like 1, does not instrument Mutex and RWMutex
+// in a build without the deadlock tag, since they are then the sync mutexes.
+const EnvVar = "DEADLOCK"
+
+type config struct {
+	enabled         bool
+	timeout         time.Duration
+	stackDepth      int
+	output          io.Writer
+	detectLockOrder bool
+	maxOrderings    int
+	collectStats    bool
+	handler         func(Report)
+	exitOnTimeout   bool
+}
+
+// Option configures the detection
+type Option func(*config)
+
+// WithEnabled enables or disables the detection of the instrumented mutexes.
+// Disabled, they behave like the sync mutexes. Default is true, unless disabled with EnvVar.
+func WithEnabled(enabled bool) Option {
+	return func(c *config) {
+		c.enabled = enabled
+	}
+}
+
+// WithTimeout sets how long to wait for a lock before reporting a deadlock. Default is 10s.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.timeout = timeout
+	}
+}
+
+// WithStackDepth sets the maximum depth of the stack traces. Default is 50.
+func WithStackDepth(depth int) Option {
+	return func(c *config) {
+		c.stackDepth = depth
+	}
+}
+
+// WithOutput sets where the default handler writes the reports. Default is os.Stderr.
+func WithOutput(w io.Writer) Option {
+	return func(c *config) {
+		c.output = w
+	}
+}
+
+// WithLockOrder enables the detection of locks acquired in inconsistent order. Default is true.
+func WithLockOrder(detect bool) Option {
+	return func(c *config) {
+		c.detectLockOrder = detect
+	}
+}
+
+// WithMaxOrderings sets the max number of lock orderings kept for the detection of locks acquired in inconsistent order.
+// When it is reached, the orderings seen so far are discarded. Default is 10000.
+func WithMaxOrderings(max int) Option {
+	return func(c *config) {
+		if max > 0 {
+			c.maxOrderings = max
+		}
+	}
+}
+
+// WithStats enables the collection of the wait and hold times per call site. Default is true.
+func WithStats(collect bool) Option {
+	return func(c *config) {
+		c.collectStats = collect
+	}
+}
+
+// WithHandler sets the function called when a deadlock, or a potential one, is detected.
+// By default, the report is written to the output.
+func WithHandler(handler func(Report)) Option {
+	return func(c *config) {
+		c.handler = handler
+	}
+}
+
+// WithExitOnTimeout sets if the default handler exits the process, with status 1, after reporting a timeout.
+// Default is false, and the goroutine keeps waiting for the lock.
+func WithExitOnTimeout(exit bool) Option {
+	return func(c *config) {
+		c.exitOnTimeout = exit
+	}
+}
+
+var current atomic.Value
+
+func init() {
+	Configure()
+}
+
+// Configure replaces the configuration with the defaults changed by options.
+// It is safe to call while the mutexes are in use.
+func Configure(options ...Option) {
+	c := &config{
+		enabled:         enabledByEnv(),
+		timeout:         10 * time.Second,
+		stackDepth:      50,
+		output:          os.Stderr,
+		detectLockOrder: true,
+		maxOrderings:    10000,
+		collectStats:    true,
+	}
+	for _, o := range options {
+		o(c)
+	}
+	current.Store(c)
+}
+
+func loadConfig() *config {
+	return current.Load().(*config)
+}
+
+func enabledByEnv() bool {
+	switch strings.ToLower(os.Getenv(EnvVar)) {
+	case "0", "false", "off":
+		return false
+	default:
+		return true
+	}
+}
@@ -1,104 +1,146 @@
+// Package deadlock detects deadlocks, and potential ones, in the use of mutexes.
+//
+// Mutex and RWMutex are instrumented only when building with the deadlock tag (go build -tags deadlock),
+// otherwise they are the sync mutexes, without any overhead.
+// DebugMutex and DebugRWMutex are always instrumented.
+// The detection of the instrumented mutexes can also be turned off with the DEADLOCK environment variable
+// or with Configure. The environment variable can only turn it off: DEADLOCK=1 does not instrument Mutex and RWMutex
+// in a build without the deadlock tag.
 package deadlock
 
 import (
-	"fmt"
-	"os"
-	"runtime"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
-)
 
-var Config = struct {
-	DeadlockTimeout time.Duration
-	StackDepth      int
-}{
-	DeadlockTimeout: time.Second * 10,
-	StackDepth:      50,
-}
+	"github.com/quintans/toolkit/stacktrace"
+)
 
 type stack struct {
+	mu sync.Mutex
+	// identifies the lock in the detection, assigned on first use
+	id uint64
+	// where the lock was last acquired
 	callers []uintptr
+	// number of holders registered by the detection
+	tracked int32
 }
 
-func lock(lockFn func(), m *stack) {
-	callers := make([]uintptr, Config.StackDepth)
-	length := runtime.Callers(3, callers)
-	callers = callers[:length]
+var lastLockID uint64
+
+func (s *stack) lockID() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.id == 0 {
+		s.id = atomic.AddUint64(&lastLockID, 1)
+	}
+	return s.id
+}
 
+func (s *stack) last() []uintptr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.callers
+}
+
+func (s *stack) set(callers []uintptr) {
+	s.mu.Lock()
+	s.callers = callers
+	s.mu.Unlock()
+}
+
+func lock(lockFn func(), s *stack, read bool) {
+	cfg := loadConfig()
+	if !cfg.enabled {
+		lockFn()
+		return
+	}
+
+	callers := stacktrace.Callers(2, cfg.stackDepth)
+	gid := goroutineID()
+	id := s.lockID()
+
+	if cfg.detectLockOrder {
+		checkOrder(cfg, gid, id, read, callers)
+	}
+
+	start := time.Now()
 	ch := make(chan struct{})
 	go func() {
 		lockFn()
 		close(ch)
-		m.callers = callers
 	}()
-	t := time.NewTimer(Config.DeadlockTimeout)
+	t := time.NewTimer(cfg.timeout)
 	defer t.Stop()
 	select {
 	case <-t.C:
-		fmt.Printf("A timeout ocurred (%s) while trying to acquire a lock at:\n", Config.DeadlockTimeout)
-		printStackTrace(callers)
-		fmt.Println("\nLast lock was at:")
-		printStackTrace(m.callers)
-		os.Exit(1)
+		report(cfg, Report{
+			Kind:    Timeout,
+			Message: "A timeout occurred (" + cfg.timeout.String() + ") while trying to acquire a lock",
+			Stacks: []Stack{
+				{Title: "Lock being acquired at", Callers: callers},
+				{Title: "Last lock was at", Callers: s.last()},
+			},
+		})
+		// if the handler returns, we keep waiting
+		<-ch
 	case <-ch:
 	}
+
+	if !read {
+		s.set(callers)
+	}
+	atomic.AddInt32(&s.tracked, 1)
+	acquired(cfg, gid, id, read, callers, time.Since(start))
+}
+
+func unlock(unlockFn func(), s *stack, read bool) {
+	// checking the holders registered by the detection, instead of the configuration,
+	// handles locks acquired before the detection was disabled
+	if atomic.LoadInt32(&s.tracked) > 0 {
+		if !read {
+			s.set(nil)
+		}
+		atomic.AddInt32(&s.tracked, -1)
+		released(loadConfig(), goroutineID(), s.lockID(), read)
+	}
+	unlockFn()
 }
 
-type Mutex struct {
+// DebugMutex is a sync.Mutex instrumented for deadlock detection, regardless of the build tag
+type DebugMutex struct {
 	stack
 	mu sync.Mutex
 }
 
-func (m *Mutex) Lock() {
-	lock(m.mu.Lock, &m.stack)
+func (m *DebugMutex) Lock() {
+	lock(m.mu.Lock, &m.stack, false)
 }
 
-func (m *Mutex) Unlock() {
-	m.mu.Unlock()
-	(&m.stack).callers = nil
+func (m *DebugMutex) Unlock() {
+	unlock(m.mu.Unlock, &m.stack, false)
 }
 
-type RWMutex struct {
+// DebugRWMutex is a sync.RWMutex instrumented for deadlock detection, regardless of the build tag
+type DebugRWMutex struct {
 	stack
 	mu sync.RWMutex
 }
 
-func (m *RWMutex) Lock() {
-	lock(m.mu.Lock, &m.stack)
+func (m *DebugRWMutex) Lock() {
+	lock(m.mu.Lock, &m.stack, false)
 }
 
-func (m *RWMutex) Unlock() {
-	m.mu.Unlock()
-	(&m.stack).callers = nil
+func (m *DebugRWMutex) Unlock() {
+	unlock(m.mu.Unlock, &m.stack, false)
 }
 
-func (m *RWMutex) RLock() {
-	// lock(m.mu.RLock, &m.stack)
-	m.mu.RLock()
+func (m *DebugRWMutex) RLock() {
+	lock(m.mu.RLock, &m.stack, true)
 }
 
-func (m *RWMutex) RUnlock() {
-	m.mu.RUnlock()
-	//(&m.stack).callers = nil
-}
-
-func printStackTrace(callers []uintptr) {
-	var pc uintptr
-	for _, v := range callers {
-		pc = v - 1
-		fun := runtime.FuncForPC(pc)
-		if fun == nil {
-			fmt.Println("n/a")
-		} else {
-			fnName := fun.Name()
-			idx := strings.LastIndex(fnName, ".")
-			if idx > 0 {
-				fnName = fnName[idx+1:]
-			}
-
-			file, line := fun.FileLine(pc)
-			fmt.Printf("%s:%v %s()\n", file, line, fnName)
-		}
-	}
+func (m *DebugRWMutex) RUnlock() {
+	unlock(m.mu.RUnlock, &m.stack, true)
 }
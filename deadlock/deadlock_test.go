@@ -1,26 +1,292 @@
 package deadlock
 
 import (
-	"fmt"
+	"bytes"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/require"
 )
 
-func TestDead(t *testing.T) {
-	Config.DeadlockTimeout = time.Second
+type recorder struct {
+	mu      sync.Mutex
+	reports []Report
+	ch      chan Report
+}
+
+func record() *recorder {
+	return recordWith()
+}
+
+func recordWith(options ...Option) *recorder {
+	r := &recorder{ch: make(chan Report, 10)}
+	Configure(append(options, WithHandler(func(report Report) {
+		r.mu.Lock()
+		r.reports = append(r.reports, report)
+		r.mu.Unlock()
+		r.ch <- report
+	}))...)
+	return r
+}
+
+func (r *recorder) stop() {
+	Configure()
+}
+
+func (r *recorder) next(t *testing.T) Report {
+	select {
+	case report := <-r.ch:
+		return report
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a report")
+		return Report{}
+	}
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	var mu RWMutex
-	test1(&mu)
+	return len(r.reports)
 }
 
-func test1(mu *RWMutex) {
+func TestTimeout(t *testing.T) {
+	rec := recordWith(WithTimeout(100 * time.Millisecond))
+	defer rec.stop()
+
+	var mu DebugMutex
 	mu.Lock()
-	test2(mu)
+	acquired := make(chan struct{})
+	go func() {
+		mu.Lock()
+		close(acquired)
+		mu.Unlock()
+	}()
+
+	report := rec.next(t)
+	require.Equal(t, Timeout, report.Kind)
+	require.Len(t, report.Stacks, 2)
+	require.Contains(t, report.String(), "TestTimeout")
+
+	// the handler did not exit, so the lock is still acquired when released
 	mu.Unlock()
+	<-acquired
 }
 
-func test2(mu *RWMutex) {
+func TestLockOrder(t *testing.T) {
+	rec := record()
+	defer rec.stop()
+
+	var a, b DebugMutex
+	var c DebugRWMutex
+
+	// a -> b
+	a.Lock()
+	b.Lock()
+	b.Unlock()
+	a.Unlock()
+
+	// b -> a, without actually deadlocking
+	b.Lock()
+	a.Lock()
+	a.Unlock()
+	b.Unlock()
+
+	report := rec.next(t)
+	require.Equal(t, LockOrder, report.Kind)
+	require.Len(t, report.Stacks, 4)
+
+	// reported only once
+	b.Lock()
+	a.Lock()
+	a.Unlock()
+	b.Unlock()
+	require.Equal(t, 1, rec.count())
+
+	// inversion through another lock: b -> c (read), c -> a
+	b.Lock()
+	c.RLock()
+	c.RUnlock()
+	b.Unlock()
+
+	c.Lock()
+	a.Lock()
+	a.Unlock()
+	c.Unlock()
+
+	// a -> b -> c -> a
+	a.Lock()
+	c.RLock()
+	c.RUnlock()
+	a.Unlock()
+
+	report = rec.next(t)
+	require.Equal(t, LockOrder, report.Kind)
+}
+
+func TestMaxOrderings(t *testing.T) {
+	rec := recordWith(WithMaxOrderings(1))
+	defer rec.stop()
+
+	var a, b, c, d DebugMutex
+
+	// a -> b
+	a.Lock()
+	b.Lock()
+	b.Unlock()
+	a.Unlock()
+
+	// c -> d discards a -> b
+	c.Lock()
+	d.Lock()
+	d.Unlock()
+	c.Unlock()
+
+	order.mu.Lock()
+	require.Equal(t, 1, order.size)
+	order.mu.Unlock()
+
+	// b -> a
+	b.Lock()
+	a.Lock()
+	a.Unlock()
+	b.Unlock()
+	require.Equal(t, 0, rec.count())
+}
+
+func TestRecursive(t *testing.T) {
+	rec := record()
+	defer rec.stop()
+
+	var mu DebugRWMutex
+	// recursive read locks are allowed
+	mu.RLock()
+	mu.RLock()
+	mu.RUnlock()
+	mu.RUnlock()
+	require.Equal(t, 0, rec.count())
+
+	acquired := make(chan struct{})
+	mu.Lock()
+	go func() {
+		mu.Lock()
+		mu.Lock()
+		close(acquired)
+		mu.Unlock()
+	}()
+	mu.Unlock()
+
+	report := rec.next(t)
+	require.Equal(t, Recursive, report.Kind)
+	// unlocked by another goroutine
+	mu.Unlock()
+	<-acquired
+}
+
+func TestStats(t *testing.T) {
+	ResetStats()
+
+	var mu DebugMutex
+	for i := 0; i < 3; i++ {
+		mu.Lock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Unlock()
+	}
+
+	stats := Stats()
+	var stat *Stat
+	for i, s := range stats {
+		if strings.Contains(s.Site, "TestStats") {
+			stat = &stats[i]
+		}
+	}
+	require.NotNil(t, stat, "Expected stats for the test call site")
+	require.Equal(t, int64(3), stat.Count)
+	require.True(t, stat.TotalHold >= 30*time.Millisecond, "Expected hold time, got %s", stat.TotalHold)
+	require.True(t, stat.MaxHold >= 10*time.Millisecond)
+}
+
+func TestDisabled(t *testing.T) {
+	rec := recordWith(WithEnabled(false))
+	defer rec.stop()
+
+	var a, b DebugMutex
+	a.Lock()
+	b.Lock()
+	b.Unlock()
+	a.Unlock()
+	b.Lock()
+	a.Lock()
+	a.Unlock()
+	b.Unlock()
+	require.Equal(t, 0, rec.count())
+
+	// acquired while enabled and released while disabled
+	Configure(WithHandler(func(Report) {}))
+	a.Lock()
+	Configure(WithEnabled(false))
+	a.Unlock()
+	order.mu.Lock()
+	require.Len(t, order.held, 0)
+	order.mu.Unlock()
+}
+
+func TestReportOutput(t *testing.T) {
+	var buf bytes.Buffer
+	Configure(WithOutput(&buf))
+	defer Configure()
+
+	var a, b DebugMutex
+	a.Lock()
+	b.Lock()
+	b.Unlock()
+	a.Unlock()
+	b.Lock()
+	a.Lock()
+	a.Unlock()
+	b.Unlock()
+
+	require.Contains(t, buf.String(), "locks acquired in inconsistent order")
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestTimeoutOutput(t *testing.T) {
+	buf := &syncBuffer{}
+	Configure(WithOutput(buf), WithTimeout(100*time.Millisecond))
+	defer Configure()
+
+	var mu DebugMutex
 	mu.Lock()
-	fmt.Println("I am here")
+	acquired := make(chan struct{})
+	go func() {
+		mu.Lock()
+		close(acquired)
+		mu.Unlock()
+	}()
+
+	require.Eventually(t, func() bool {
+		return buf.String() != ""
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the process did not exit
 	mu.Unlock()
+	<-acquired
 }
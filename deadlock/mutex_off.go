@@ -0,0 +1,15 @@
+//go:build !deadlock
+// +build !deadlock
+
+package deadlock
+
+import "sync"
+
+// Enabled reports if Mutex and RWMutex are instrumented, by building with the deadlock tag
+const Enabled = false
+
+// Mutex is a DebugMutex when building with the deadlock tag, otherwise it is a sync.Mutex
+type Mutex = sync.Mutex
+
+// RWMutex is a DebugRWMutex when building with the deadlock tag, otherwise it is a sync.RWMutex
+type RWMutex = sync.RWMutex
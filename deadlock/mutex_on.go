@@ -0,0 +1,13 @@
+//go:build deadlock
+// +build deadlock
+
+package deadlock
+
+// Enabled reports if Mutex and RWMutex are instrumented, by building with the deadlock tag
+const Enabled = true
+
+// Mutex is a DebugMutex when building with the deadlock tag, otherwise it is a sync.Mutex
+type Mutex = DebugMutex
+
+// RWMutex is a DebugRWMutex when building with the deadlock tag, otherwise it is a sync.RWMutex
+type RWMutex = DebugRWMutex
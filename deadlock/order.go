@@ -0,0 +1,212 @@
+package deadlock
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type heldLock struct {
+	id      uint64
+	read    bool
+	callers []uintptr
+	at      time.Time
+}
+
+type lockPair struct {
+	from, to uint64
+}
+
+// ordering records where two locks were acquired, the first while holding the second
+type ordering struct {
+	fromCallers []uintptr
+	toCallers   []uintptr
+}
+
+// order keeps the locks held by each goroutine and the graph of the lock acquisition orderings.
+// Locks are identified by an id assigned on their first use, so discarded locks are never confused with new ones,
+// but the graph has no way of knowing when a lock is discarded. To bound the memory used by programs
+// that keep creating locks, the graph is cleared when it reaches the max number of orderings,
+// losing the orderings seen so far.
+var order = struct {
+	mu       sync.Mutex
+	held     map[int64][]*heldLock
+	edges    map[uint64]map[uint64]ordering
+	size     int
+	reported map[lockPair]bool
+}{
+	held:     map[int64][]*heldLock{},
+	edges:    map[uint64]map[uint64]ordering{},
+	reported: map[lockPair]bool{},
+}
+
+// checkOrder reports if acquiring the lock id, while holding the locks of the goroutine,
+// inverts an ordering seen before, directly or through other locks, and records the new orderings.
+func checkOrder(cfg *config, gid int64, id uint64, read bool, callers []uintptr) {
+	var reports []Report
+
+	order.mu.Lock()
+	for _, h := range order.held[gid] {
+		if h.id == id {
+			if read && h.read {
+				continue
+			}
+			reports = append(reports, Report{
+				Kind:    Recursive,
+				Message: "Potential deadlock: a goroutine is acquiring a lock that it already holds",
+				Stacks: []Stack{
+					{Title: "Lock being acquired at", Callers: callers},
+					{Title: "Lock held since", Callers: h.callers},
+				},
+			})
+			continue
+		}
+
+		pair := lockPair{h.id, id}
+		if path := orderingPath(id, h.id); path != nil && !order.reported[pair] {
+			order.reported[pair] = true
+			r := Report{
+				Kind:    LockOrder,
+				Message: "Potential deadlock: locks acquired in inconsistent order",
+				Stacks: []Stack{
+					{Title: "Lock being acquired at", Callers: callers},
+					{Title: "while holding lock acquired at", Callers: h.callers},
+				},
+			}
+			for _, o := range path {
+				r.Stacks = append(r.Stacks,
+					Stack{Title: "Previously, lock acquired at", Callers: o.toCallers},
+					Stack{Title: "while holding lock acquired at", Callers: o.fromCallers},
+				)
+			}
+			reports = append(reports, r)
+		}
+
+		to := order.edges[h.id]
+		if _, ok := to[id]; ok {
+			continue
+		}
+		if order.size >= cfg.maxOrderings {
+			order.edges = map[uint64]map[uint64]ordering{}
+			order.reported = map[lockPair]bool{}
+			order.size = 0
+			to = nil
+		}
+		if to == nil {
+			to = map[uint64]ordering{}
+			order.edges[h.id] = to
+		}
+		to[id] = ordering{fromCallers: h.callers, toCallers: callers}
+		order.size++
+	}
+	order.mu.Unlock()
+
+	for _, r := range reports {
+		report(cfg, r)
+	}
+}
+
+// orderingPath returns the orderings leading from the lock from to the lock to, or nil if there is none.
+// It must be called with the order lock held.
+func orderingPath(from, to uint64) []ordering {
+	type step struct {
+		id   uint64
+		prev *step
+		o    ordering
+	}
+	visited := map[uint64]bool{from: true}
+	queue := []*step{{id: from}}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		for next, o := range order.edges[s.id] {
+			if visited[next] {
+				continue
+			}
+			n := &step{id: next, prev: s, o: o}
+			if next == to {
+				var path []ordering
+				for ; n.prev != nil; n = n.prev {
+					path = append([]ordering{n.o}, path...)
+				}
+				return path
+			}
+			visited[next] = true
+			queue = append(queue, n)
+		}
+	}
+	return nil
+}
+
+func acquired(cfg *config, gid int64, id uint64, read bool, callers []uintptr, wait time.Duration) {
+	order.mu.Lock()
+	order.held[gid] = append(order.held[gid], &heldLock{
+		id:      id,
+		read:    read,
+		callers: callers,
+		at:      time.Now(),
+	})
+	order.mu.Unlock()
+
+	if cfg.collectStats {
+		addWait(site(callers), wait)
+	}
+}
+
+func released(cfg *config, gid int64, id uint64, read bool) {
+	order.mu.Lock()
+	h := removeHeld(gid, id, read)
+	if h == nil {
+		// unlocked by a goroutine other than the one that locked it
+		for g := range order.held {
+			if h = removeHeld(g, id, read); h != nil {
+				break
+			}
+		}
+	}
+	order.mu.Unlock()
+
+	if h != nil && cfg.collectStats {
+		addHold(site(h.callers), time.Since(h.at))
+	}
+}
+
+// removeHeld must be called with the order lock held
+func removeHeld(gid int64, id uint64, read bool) *heldLock {
+	held := order.held[gid]
+	for i := len(held) - 1; i >= 0; i-- {
+		h := held[i]
+		if h.id == id && h.read == read {
+			held = append(held[:i], held[i+1:]...)
+			if len(held) == 0 {
+				delete(order.held, gid)
+			} else {
+				order.held[gid] = held
+			}
+			return h
+		}
+	}
+	return nil
+}
+
+func site(callers []uintptr) uintptr {
+	if len(callers) == 0 {
+		return 0
+	}
+	return callers[0]
+}
+
+var goroutinePrefix = []byte("goroutine ")
+
+func goroutineID() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, goroutinePrefix)
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
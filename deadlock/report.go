@@ -0,0 +1,76 @@
+package deadlock
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/quintans/toolkit/stacktrace"
+)
+
+// Kind is the kind of problem detected
+type Kind int
+
+const (
+	// Timeout means that a lock could not be acquired within the deadlock timeout
+	Timeout Kind = iota + 1
+	// LockOrder means that two or more locks were acquired in inconsistent order,
+	// which can deadlock if run concurrently
+	LockOrder
+	// Recursive means that a goroutine is acquiring a lock that it already holds
+	Recursive
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Timeout:
+		return "Timeout"
+	case LockOrder:
+		return "LockOrder"
+	case Recursive:
+		return "Recursive"
+	default:
+		return "Unknown"
+	}
+}
+
+// Stack is a titled stack trace of a report
+type Stack struct {
+	Title   string
+	Callers []uintptr
+}
+
+// Report describes a deadlock, or a potential one
+type Report struct {
+	Kind    Kind
+	Message string
+	Stacks  []Stack
+}
+
+func (r Report) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(r.Message)
+	buf.WriteString("\n")
+	for _, s := range r.Stacks {
+		buf.WriteString("\n")
+		buf.WriteString(s.Title)
+		buf.WriteString(":\n")
+		writeStackTrace(&buf, s.Callers)
+	}
+	return buf.String()
+}
+
+func report(cfg *config, r Report) {
+	if cfg.handler != nil {
+		cfg.handler(r)
+		return
+	}
+	fmt.Fprint(cfg.output, r.String())
+	if r.Kind == Timeout && cfg.exitOnTimeout {
+		os.Exit(1)
+	}
+}
+
+func writeStackTrace(buf *bytes.Buffer, callers []uintptr) {
+	stacktrace.Write(buf, stacktrace.Frames(callers))
+}
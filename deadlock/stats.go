@@ -0,0 +1,93 @@
+package deadlock
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/quintans/toolkit/stacktrace"
+)
+
+// Stat is the contention of the locks acquired at a call site
+type Stat struct {
+	// Site is the file, line and function where the locks were acquired
+	Site      string
+	Count     int64
+	TotalWait time.Duration
+	MaxWait   time.Duration
+	TotalHold time.Duration
+	MaxHold   time.Duration
+}
+
+var stats = struct {
+	mu    sync.Mutex
+	sites map[uintptr]*Stat
+}{
+	sites: map[uintptr]*Stat{},
+}
+
+// Stats returns the contention per call site, the most waited for first
+func Stats() []Stat {
+	stats.mu.Lock()
+	result := make([]Stat, 0, len(stats.sites))
+	for pc, s := range stats.sites {
+		st := *s
+		st.Site = siteName(pc)
+		result = append(result, st)
+	}
+	stats.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].TotalWait > result[j].TotalWait
+	})
+	return result
+}
+
+// ResetStats discards the collected stats
+func ResetStats() {
+	stats.mu.Lock()
+	stats.sites = map[uintptr]*Stat{}
+	stats.mu.Unlock()
+}
+
+func siteStat(pc uintptr) *Stat {
+	s := stats.sites[pc]
+	if s == nil {
+		s = &Stat{}
+		stats.sites[pc] = s
+	}
+	return s
+}
+
+func addWait(pc uintptr, wait time.Duration) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	s := siteStat(pc)
+	s.Count++
+	s.TotalWait += wait
+	if wait > s.MaxWait {
+		s.MaxWait = wait
+	}
+}
+
+func addHold(pc uintptr, hold time.Duration) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	s := siteStat(pc)
+	s.TotalHold += hold
+	if hold > s.MaxHold {
+		s.MaxHold = hold
+	}
+}
+
+func siteName(pc uintptr) string {
+	frames := stacktrace.Frames([]uintptr{pc})
+	if len(frames) == 0 || frames[0].Function == "" {
+		return "n/a"
+	}
+	f := frames[0]
+	return fmt.Sprintf("%s:%v %s()", f.File, f.Line, f.Function)
+}
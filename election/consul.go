@@ -0,0 +1,13 @@
+package election
+
+import (
+	"time"
+
+	"github.com/quintans/toolkit/consullock"
+)
+
+// NewConsul creates a candidate for the named election, using a consul lock
+func NewConsul(pool consullock.Pool, name string, expiry time.Duration, meta Metadata, options ...Option) *Election {
+	l := pool.NewLock(name, expiry, consullock.WithValue(EncodeMetadata(meta)))
+	return New(l, meta, options...)
+}
@@ -0,0 +1,152 @@
+// Package election elects a leader among several instances, using a distributed lock
+package election
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/quintans/toolkit/lock"
+)
+
+// Metadata identifies the leader
+type Metadata struct {
+	NodeID  string `json:"nodeId"`
+	Address string `json:"address,omitempty"`
+}
+
+// Backend is the lock used to hold the leadership.
+// While the lock is held, the holder value is the encoded Metadata of the leader.
+type Backend interface {
+	lock.Locker
+	// Holder returns the value stored by the current holder of the lock, or nil if the lock is free
+	Holder(ctx context.Context) ([]byte, error)
+}
+
+// Election is a candidate to the leadership
+type Election struct {
+	backend   Backend
+	meta      Metadata
+	onElected func()
+	onDemoted func()
+
+	mu      sync.Mutex
+	leader  bool
+	demoted chan struct{}
+}
+
+// Option configures an Election
+type Option func(*Election)
+
+// OnElected sets the callback called when this candidate becomes the leader
+func OnElected(fn func()) Option {
+	return func(e *Election) {
+		e.onElected = fn
+	}
+}
+
+// OnDemoted sets the callback called when this candidate stops being the leader,
+// either because it resigned or because the leadership was lost
+func OnDemoted(fn func()) Option {
+	return func(e *Election) {
+		e.onDemoted = fn
+	}
+}
+
+// New creates a candidate that campaigns using backend.
+// backend must store meta, as returned by EncodeMetadata, as the holder value.
+func New(backend Backend, meta Metadata, options ...Option) *Election {
+	e := &Election{
+		backend: backend,
+		meta:    meta,
+	}
+	for _, o := range options {
+		o(e)
+	}
+	return e
+}
+
+// EncodeMetadata encodes the metadata to be stored with the lock
+func EncodeMetadata(meta Metadata) []byte {
+	b, _ := json.Marshal(meta)
+	return b
+}
+
+// Campaign blocks until this candidate is elected or the context is done.
+// It returns a channel that is closed when this candidate is no longer the leader.
+func (e *Election) Campaign(ctx context.Context) (<-chan struct{}, error) {
+	done, err := e.backend.LockWait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	demoted := make(chan struct{})
+	e.mu.Lock()
+	e.leader = true
+	e.demoted = demoted
+	e.mu.Unlock()
+
+	if e.onElected != nil {
+		e.onElected()
+	}
+
+	go func() {
+		<-done
+		e.mu.Lock()
+		e.leader = false
+		e.mu.Unlock()
+		if e.onDemoted != nil {
+			e.onDemoted()
+		}
+		close(demoted)
+	}()
+
+	return demoted, nil
+}
+
+// Resign gives up the leadership, returning after the demoted callback was called.
+// Resigning when not being the leader does nothing.
+func (e *Election) Resign(ctx context.Context) error {
+	e.mu.Lock()
+	demoted := e.demoted
+	e.mu.Unlock()
+
+	if err := e.backend.Unlock(ctx); err != nil {
+		return err
+	}
+	if demoted == nil {
+		return nil
+	}
+	select {
+	case <-demoted:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// IsLeader returns true if this candidate is the leader
+func (e *Election) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.leader
+}
+
+// Metadata returns the metadata of this candidate
+func (e *Election) Metadata() Metadata {
+	return e.meta
+}
+
+// Leader returns the metadata of the current leader, or nil if there is no leader
+func (e *Election) Leader(ctx context.Context) (*Metadata, error) {
+	b, err := e.backend.Holder(ctx)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	meta := &Metadata{}
+	if err := json.Unmarshal(b, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
@@ -0,0 +1,111 @@
+package election_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/quintans/toolkit/election"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCampaignAndResign(t *testing.T) {
+	ctx := context.Background()
+	memory := election.NewMemory()
+
+	elected := make(chan string, 2)
+	demoted := make(chan string, 2)
+	candidate := func(id string) *election.Election {
+		return memory.NewElection("job", election.Metadata{NodeID: id, Address: id + ":8080"},
+			election.OnElected(func() { elected <- id }),
+			election.OnDemoted(func() { demoted <- id }),
+		)
+	}
+	e1 := candidate("node-1")
+	e2 := candidate("node-2")
+
+	leader, err := e1.Leader(ctx)
+	require.NoError(t, err)
+	require.Nil(t, leader)
+
+	done1, err := e1.Campaign(ctx)
+	require.NoError(t, err)
+	require.True(t, e1.IsLeader())
+	require.Equal(t, "node-1", <-elected)
+
+	leader, err = e2.Leader(ctx)
+	require.NoError(t, err)
+	require.Equal(t, &election.Metadata{NodeID: "node-1", Address: "node-1:8080"}, leader)
+
+	campaign := make(chan error, 1)
+	go func() {
+		_, err := e2.Campaign(ctx)
+		campaign <- err
+	}()
+	select {
+	case <-campaign:
+		t.Fatal("Expected second candidate to wait for the leadership")
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.False(t, e2.IsLeader())
+
+	require.NoError(t, e1.Resign(ctx))
+	require.False(t, e1.IsLeader())
+	require.Equal(t, "node-1", <-demoted)
+	<-done1
+
+	require.NoError(t, <-campaign)
+	require.True(t, e2.IsLeader())
+	require.Equal(t, "node-2", <-elected)
+
+	leader, err = e1.Leader(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "node-2", leader.NodeID)
+
+	require.NoError(t, e2.Resign(ctx))
+	// resigning again does nothing
+	require.NoError(t, e2.Resign(ctx))
+}
+
+func TestLeadershipLost(t *testing.T) {
+	ctx := context.Background()
+	memory := election.NewMemory()
+
+	demoted := make(chan struct{})
+	e := memory.NewElection("job", election.Metadata{NodeID: "node-1"},
+		election.OnDemoted(func() { close(demoted) }),
+	)
+
+	done, err := e.Campaign(ctx)
+	require.NoError(t, err)
+
+	memory.Revoke("job")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected leadership to be lost")
+	}
+	<-demoted
+	require.False(t, e.IsLeader())
+
+	// can campaign again
+	_, err = e.Campaign(ctx)
+	require.NoError(t, err)
+	require.True(t, e.IsLeader())
+}
+
+func TestCampaignCancelled(t *testing.T) {
+	ctx := context.Background()
+	memory := election.NewMemory()
+	e1 := memory.NewElection("job", election.Metadata{NodeID: "node-1"})
+	e2 := memory.NewElection("job", election.Metadata{NodeID: "node-2"})
+
+	_, err := e1.Campaign(ctx)
+	require.NoError(t, err)
+
+	ctx2, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = e2.Campaign(ctx2)
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.False(t, e2.IsLeader())
+}
@@ -0,0 +1,30 @@
+package election
+
+import (
+	"github.com/quintans/toolkit/locallock"
+)
+
+// Memory holds in-memory elections, to be used in unit tests.
+// Candidates created by the same Memory compete for the same elections.
+type Memory struct {
+	manager *locallock.Manager
+}
+
+// NewMemory creates an empty Memory
+func NewMemory() *Memory {
+	return &Memory{
+		manager: locallock.NewManager(),
+	}
+}
+
+// NewElection creates a candidate for the named election
+func (m *Memory) NewElection(name string, meta Metadata, options ...Option) *Election {
+	l := m.manager.NewLock(name, 0, locallock.WithValue(EncodeMetadata(meta)))
+	return New(l, meta, options...)
+}
+
+// Revoke makes the current leader of the named election lose the leadership,
+// as if its lock had expired.
+func (m *Memory) Revoke(name string) {
+	m.manager.Expire(name)
+}
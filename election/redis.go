@@ -0,0 +1,13 @@
+package election
+
+import (
+	"time"
+
+	"github.com/quintans/toolkit/redislock"
+)
+
+// NewRedis creates a candidate for the named election, using a redis lock
+func NewRedis(pool redislock.Pool, name string, expiry time.Duration, meta Metadata, options ...Option) *Election {
+	l := pool.NewLock(name, expiry, redislock.WithValue(EncodeMetadata(meta)))
+	return New(l, meta, options...)
+}
@@ -3,8 +3,8 @@ package faults
 import (
 	"bytes"
 	"fmt"
-	"runtime"
-	"strings"
+
+	"github.com/quintans/toolkit/stacktrace"
 )
 
 var MaxDepth = 50
@@ -36,11 +36,9 @@ func (e *Fault) Format(s fmt.State, verb rune) {
 }
 
 func create(msg string, cause error) *Fault {
-	callers := make([]uintptr, MaxDepth)
-	length := runtime.Callers(3, callers)
 	return &Fault{
 		message: msg,
-		callers: callers[:length],
+		callers: stacktrace.Callers(2, MaxDepth),
 		cause:   cause,
 	}
 }
@@ -111,38 +109,12 @@ func (err *Fault) stack(buf *bytes.Buffer) {
 
 	buf.WriteString(err.Error())
 
-	var pc uintptr
-	for _, v := range err.callers {
-		pc = v - 1
-		fun := runtime.FuncForPC(pc)
-		if fun == nil {
+	for _, f := range stacktrace.Frames(err.callers) {
+		if f.Function == "" {
 			buf.WriteString("\n    n/a")
 		} else {
-			var file, line = fun.FileLine(pc)
-
-			const sep = "/"
-			// gets only the filename.
-			// eg: /home/paulo/go/src/package/file.go -> file.go
-			var idx = strings.LastIndex(file, sep)
-			if idx > 0 {
-				file = file[idx+1:]
-			}
-
-			// package name.
-			// eg: folder/package.funcname -> folder/package
-			pck := fun.Name()
-			idx = len(pck) - 1
-			for i := idx; i > 0; i-- {
-				if pck[i] == '.' {
-					idx = i
-				}
-				if pck[i] == '/' {
-					break
-				}
-			}
-			pck = pck[:idx]
-			file = pck + sep + file
-			buf.WriteString(fmt.Sprintf("\n    %s:%v", file, line))
+			// eg: /home/paulo/go/src/package/file.go -> folder/package/file.go
+			buf.WriteString(fmt.Sprintf("\n    %s:%v", f.PackageFile(), f.Line))
 		}
 	}
 
@@ -6,7 +6,6 @@ require (
 	github.com/armon/go-metrics v0.4.0 // indirect
 	github.com/docker/go-connections v0.4.0
 	github.com/fatih/color v1.13.0
-	github.com/go-redsync/redsync v1.4.2
 	github.com/gomodule/redigo v2.0.0+incompatible
 	github.com/hashicorp/consul/api v1.13.0
 	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
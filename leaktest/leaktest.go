@@ -0,0 +1,169 @@
+// Package leaktest detects goroutines leaked by a test.
+//
+//	func TestSomething(t *testing.T) {
+//		defer leaktest.Check(t)()
+//		...
+//	}
+package leaktest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/quintans/toolkit/stacktrace"
+)
+
+// TB is the subset of testing.TB used to report the leaks
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// ignoredFunctions are the functions of goroutines started by the runtime or the testing package
+var ignoredFunctions = []string{
+	"testing.Main(",
+	"testing.(*T).Run",
+	"testing.(*T).Parallel",
+	"testing.tRunner",
+	"testing.runTests",
+	"testing.(*M).",
+	"runtime.MHeap_Scavenger",
+	"runtime.ensureSigM",
+	"os/signal.signal_recv",
+	"os/signal.loop",
+	"signal.signal_recv",
+	"created by runtime.gc",
+	"runtime/trace.Start",
+}
+
+type options struct {
+	timeout time.Duration
+	ignored []string
+}
+
+// Option configures the leak detection
+type Option func(*options)
+
+// Timeout sets how long to wait for the goroutines to finish before reporting them. Default is 5s.
+func Timeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// Ignore ignores the goroutines with a frame, or the creation, in a function starting with one of prefixes.
+// eg: "github.com/quintans/toolkit/log.(*LogMaster)"
+func Ignore(prefixes ...string) Option {
+	return func(o *options) {
+		o.ignored = append(o.ignored, prefixes...)
+	}
+}
+
+// Check snapshots the running goroutines and returns a function that,
+// when called at the end of the test, fails the test if there are new goroutines.
+// It waits for the new goroutines to finish up to the timeout.
+func Check(t TB, opts ...Option) func() {
+	o := options{
+		timeout: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	before := map[int64]bool{}
+	for _, g := range stacktrace.AllGoroutines() {
+		before[g.ID] = true
+	}
+
+	return func() {
+		t.Helper()
+
+		var leaked []stacktrace.Goroutine
+		deadline := time.Now().Add(o.timeout)
+		for {
+			leaked = Leaked(before, o.ignored...)
+			if len(leaked) == 0 {
+				return
+			}
+			if time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Errorf("leaked goroutines:\n%s", Format(leaked))
+	}
+}
+
+// Leaked returns the running goroutines that are not in before and that are not ignored,
+// either by default or by having a function starting with one of the prefixes
+func Leaked(before map[int64]bool, prefixes ...string) []stacktrace.Goroutine {
+	var leaked []stacktrace.Goroutine
+	for i, g := range stacktrace.AllGoroutines() {
+		// the first goroutine is the current one
+		if i == 0 || before[g.ID] || ignored(g, prefixes) {
+			continue
+		}
+		leaked = append(leaked, g)
+	}
+	return leaked
+}
+
+func ignored(g stacktrace.Goroutine, prefixes []string) bool {
+	functions := make([]string, 0, len(g.Frames)+1)
+	for _, f := range g.Frames {
+		functions = append(functions, f.Function+"(")
+	}
+	if g.CreatedBy != nil {
+		functions = append(functions, "created by "+g.CreatedBy.Function)
+	}
+	for _, fn := range functions {
+		for _, p := range ignoredFunctions {
+			if strings.HasPrefix(fn, p) {
+				return true
+			}
+		}
+		for _, p := range prefixes {
+			if strings.HasPrefix(fn, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Format formats the goroutines grouped by identical stack traces, the largest groups first
+func Format(goroutines []stacktrace.Goroutine) string {
+	type group struct {
+		stack string
+		ids   []int64
+		state string
+	}
+	groups := map[string]*group{}
+	var order []*group
+	for _, g := range goroutines {
+		var buf bytes.Buffer
+		stacktrace.Write(&buf, g.Frames)
+		if g.CreatedBy != nil {
+			fmt.Fprintf(&buf, "created by %s\n", g.CreatedBy.String())
+		}
+		key := buf.String()
+		gr := groups[key]
+		if gr == nil {
+			gr = &group{stack: key, state: g.State}
+			groups[key] = gr
+			order = append(order, gr)
+		}
+		gr.ids = append(gr.ids, g.ID)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(order[i].ids) > len(order[j].ids)
+	})
+
+	var buf bytes.Buffer
+	for _, gr := range order {
+		fmt.Fprintf(&buf, "%d goroutine(s) %v [%s]:\n%s\n", len(gr.ids), gr.ids, gr.state, gr.stack)
+	}
+	return buf.String()
+}
@@ -0,0 +1,72 @@
+package leaktest_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quintans/toolkit/leaktest"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeT struct {
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func blocked(ch chan struct{}) {
+	<-ch
+}
+
+func TestLeak(t *testing.T) {
+	ft := &fakeT{}
+	check := leaktest.Check(ft, leaktest.Timeout(100*time.Millisecond))
+
+	ch := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		go blocked(ch)
+	}
+	check()
+	close(ch)
+
+	require.Len(t, ft.errors, 1)
+	report := ft.errors[0]
+	require.Contains(t, report, "3 goroutine(s)")
+	require.Contains(t, report, "leaktest_test.go")
+	require.Contains(t, report, "blocked()")
+	require.Contains(t, report, "created by")
+}
+
+func TestNoLeak(t *testing.T) {
+	ft := &fakeT{}
+	check := leaktest.Check(ft)
+
+	ch := make(chan struct{})
+	go blocked(ch)
+	// finishes while checking
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(ch)
+	}()
+	check()
+
+	require.Empty(t, ft.errors)
+}
+
+func TestIgnore(t *testing.T) {
+	ft := &fakeT{}
+	check := leaktest.Check(ft, leaktest.Timeout(50*time.Millisecond), leaktest.Ignore("github.com/quintans/toolkit/leaktest_test.blocked"))
+
+	ch := make(chan struct{})
+	defer close(ch)
+	go blocked(ch)
+	check()
+
+	require.Empty(t, ft.errors, strings.Join(ft.errors, "\n"))
+}
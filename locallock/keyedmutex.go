@@ -0,0 +1,102 @@
+package locallock
+
+import (
+	"context"
+	"sync"
+)
+
+// KeyedMutex is a mutual exclusion lock per key.
+// The lock of a key is created when first needed and discarded when no one holds or waits for it,
+// so it can be used with an unbounded number of keys.
+//
+// The zero value is an unlocked KeyedMutex.
+type KeyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	// holds one element while locked
+	ch   chan struct{}
+	refs int
+}
+
+// Lock locks the key, waiting if it is already locked
+func (k *KeyedMutex) Lock(key string) {
+	_ = k.LockContext(context.Background(), key)
+}
+
+// LockContext locks the key, waiting until it is unlocked or the context is done
+func (k *KeyedMutex) LockContext(ctx context.Context, key string) error {
+	l := k.acquire(key)
+	select {
+	case l.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		k.unref(key, l)
+		return ctx.Err()
+	}
+}
+
+// TryLock locks the key if it is not locked, returning false otherwise
+func (k *KeyedMutex) TryLock(key string) bool {
+	l := k.acquire(key)
+	select {
+	case l.ch <- struct{}{}:
+		return true
+	default:
+		k.unref(key, l)
+		return false
+	}
+}
+
+// Unlock unlocks the key. It panics if the key is not locked.
+func (k *KeyedMutex) Unlock(key string) {
+	k.mu.Lock()
+	l := k.locks[key]
+	k.mu.Unlock()
+
+	if l == nil {
+		panic("locallock: unlock of unlocked key " + key)
+	}
+	select {
+	case <-l.ch:
+	default:
+		panic("locallock: unlock of unlocked key " + key)
+	}
+	k.unref(key, l)
+}
+
+// Len returns the number of keys being held or waited for
+func (k *KeyedMutex) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return len(k.locks)
+}
+
+func (k *KeyedMutex) acquire(key string) *keyedLock {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.locks == nil {
+		k.locks = map[string]*keyedLock{}
+	}
+	l := k.locks[key]
+	if l == nil {
+		l = &keyedLock{ch: make(chan struct{}, 1)}
+		k.locks[key] = l
+	}
+	l.refs++
+	return l
+}
+
+func (k *KeyedMutex) unref(key string, l *keyedLock) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	l.refs--
+	if l.refs == 0 {
+		delete(k.locks, key)
+	}
+}
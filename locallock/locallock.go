@@ -0,0 +1,255 @@
+// Package locallock provides in-process implementations of lock.Locker,
+// for unit tests and single node deployments.
+package locallock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/quintans/toolkit/clock"
+	"github.com/quintans/toolkit/lock"
+)
+
+var _ lock.Locker = &Lock{}
+
+// Manager holds named locks. Locks created by the same Manager compete for the same names,
+// as if they were in different processes using a distributed lock.
+//
+// Like the distributed locks, a held lock is renewed automatically until it is released.
+// StopRenewal and Expire simulate a holder that stopped renewing the lock and a lost lock.
+type Manager struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	holders map[string]*Lock
+	// closed, and replaced, when a lock is released
+	changed chan struct{}
+}
+
+// ManagerOption configures a Manager
+type ManagerOption func(*Manager)
+
+// WithClock sets the clock used for the lock expiration and the LockWait backoff
+func WithClock(c clock.Clock) ManagerOption {
+	return func(m *Manager) {
+		m.clock = c
+	}
+}
+
+// NewManager creates a Manager without locks
+func NewManager(options ...ManagerOption) *Manager {
+	m := &Manager{
+		holders: map[string]*Lock{},
+		changed: make(chan struct{}),
+	}
+	for _, o := range options {
+		o(m)
+	}
+	m.clock = clock.OrDefault(m.clock)
+	return m
+}
+
+type options struct {
+	backoff lock.Backoff
+	value   []byte
+}
+
+// Option configures a Lock
+type Option func(*options)
+
+// WithBackoff sets the delays between the attempts of LockWait. Default is lock.DefaultBackoff.
+func WithBackoff(b lock.Backoff) Option {
+	return func(o *options) {
+		o.backoff = b
+	}
+}
+
+// WithValue sets the value stored with the lock while it is held, retrievable with Holder.
+func WithValue(value []byte) Option {
+	return func(o *options) {
+		o.value = value
+	}
+}
+
+// NewLock creates a contender for the named lock.
+// expiry is how long the lock survives after its renewal stops.
+func (m *Manager) NewLock(name string, expiry time.Duration, options ...Option) *Lock {
+	l := &Lock{
+		manager: m,
+		name:    name,
+		expiry:  expiry,
+	}
+	l.opts.backoff = lock.DefaultBackoff
+	for _, o := range options {
+		o(&l.opts)
+	}
+	return l
+}
+
+// IsLocked returns true if the named lock is held
+func (m *Manager) IsLocked(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.holders[name] != nil
+}
+
+// Expire makes the holder of the named lock lose it immediately, as if it had expired.
+// It returns false if the lock was not held.
+func (m *Manager) Expire(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := m.holders[name]
+	if l == nil {
+		return false
+	}
+	l.release()
+	return true
+}
+
+// StopRenewal simulates a holder of the named lock that stopped renewing it, like a paused process.
+// The lock is lost after its expiry duration, unless released before.
+// It returns false if the lock was not held.
+func (m *Manager) StopRenewal(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := m.holders[name]
+	if l == nil {
+		return false
+	}
+	done := l.done
+	timer := m.clock.NewTimer(l.expiry)
+	go func() {
+		select {
+		case <-timer.C():
+			m.mu.Lock()
+			if l.done == done {
+				l.release()
+			}
+			m.mu.Unlock()
+		case <-done:
+			timer.Stop()
+		}
+	}()
+	return true
+}
+
+// Lock is an in-process lock with the same behaviour as the distributed locks
+type Lock struct {
+	manager *Manager
+	name    string
+	expiry  time.Duration
+	opts    options
+	// guarded by the manager lock
+	done chan struct{}
+}
+
+func (l *Lock) Lock(ctx context.Context) (<-chan struct{}, error) {
+	m := l.manager
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if l.done != nil {
+		return nil, fmt.Errorf("lock '%s': %w", l.name, lock.ErrAlreadyAcquired)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if m.holders[l.name] != nil {
+		return nil, nil
+	}
+	l.done = make(chan struct{})
+	m.holders[l.name] = l
+	return l.done, nil
+}
+
+// LockWait keeps trying to acquire the lock until it succeeds or the context is done.
+// Between attempts it waits for the backoff delay or for the release of a lock, whatever comes first.
+func (l *Lock) LockWait(ctx context.Context) (<-chan struct{}, error) {
+	return lock.Retry(ctx, l.opts.backoff, l.Lock, func(ctx context.Context, timeout time.Duration) error {
+		m := l.manager
+		m.mu.Lock()
+		changed := m.changed
+		m.mu.Unlock()
+
+		timer := m.clock.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-changed:
+		case <-timer.C():
+		case <-ctx.Done():
+		}
+		return ctx.Err()
+	})
+}
+
+func (l *Lock) TryLock(ctx context.Context) (bool, error) {
+	done, err := l.Lock(ctx)
+	return done != nil, err
+}
+
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.manager.mu.Lock()
+	defer l.manager.mu.Unlock()
+
+	if l.done != nil {
+		l.release()
+	}
+	return nil
+}
+
+// release must be called with the manager lock held
+func (l *Lock) release() {
+	m := l.manager
+	delete(m.holders, l.name)
+	close(l.done)
+	l.done = nil
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func (l *Lock) Done() <-chan struct{} {
+	l.manager.mu.Lock()
+	defer l.manager.mu.Unlock()
+
+	return l.done
+}
+
+func (l *Lock) WaitForUnlock(ctx context.Context) error {
+	m := l.manager
+	for {
+		m.mu.Lock()
+		held := m.holders[l.name] != nil
+		changed := m.changed
+		m.mu.Unlock()
+
+		if !held {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Holder returns the value stored by the current holder of the lock, or nil if the lock is free
+func (l *Lock) Holder(ctx context.Context) ([]byte, error) {
+	m := l.manager
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h := m.holders[l.name]
+	if h == nil {
+		return nil, nil
+	}
+	if h.opts.value == nil {
+		return []byte{}, nil
+	}
+	return h.opts.value, nil
+}
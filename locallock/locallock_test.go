@@ -0,0 +1,121 @@
+package locallock_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quintans/toolkit/clock"
+	"github.com/quintans/toolkit/locallock"
+	"github.com/quintans/toolkit/lock"
+	"github.com/quintans/toolkit/lock/locktest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	manager := locallock.NewManager()
+	locktest.Run(t, func(t *testing.T, name string) lock.Locker {
+		return manager.NewLock(name, 10*time.Second)
+	})
+}
+
+func TestExpire(t *testing.T) {
+	ctx := context.Background()
+	manager := locallock.NewManager()
+	l1 := manager.NewLock("job", time.Second)
+	l2 := manager.NewLock("job", time.Second)
+
+	require.False(t, manager.Expire("job"))
+
+	done, err := l1.Lock(ctx)
+	require.NoError(t, err)
+	require.True(t, manager.IsLocked("job"))
+
+	require.True(t, manager.Expire("job"))
+	requireClosed(t, done)
+	require.Nil(t, l1.Done())
+	require.False(t, manager.IsLocked("job"))
+
+	ok, err := l2.TryLock(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestStopRenewal(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(time.Now())
+	manager := locallock.NewManager(locallock.WithClock(clk))
+	l := manager.NewLock("job", 10*time.Second, locallock.WithValue([]byte("node-1")))
+
+	done, err := l.Lock(ctx)
+	require.NoError(t, err)
+	holder, err := l.Holder(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "node-1", string(holder))
+
+	require.True(t, manager.StopRenewal("job"))
+	clk.Advance(9 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("Expected lock to be held until it expires")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clk.Advance(time.Second)
+	requireClosed(t, done)
+	holder, err = l.Holder(ctx)
+	require.NoError(t, err)
+	require.Nil(t, holder)
+}
+
+func TestKeyedMutex(t *testing.T) {
+	km := locallock.KeyedMutex{}
+
+	km.Lock("a")
+	require.True(t, km.TryLock("b"), "Expected different keys to be independent")
+	require.False(t, km.TryLock("a"))
+	require.Equal(t, 2, km.Len())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, km.LockContext(ctx, "a"))
+
+	km.Unlock("a")
+	km.Unlock("b")
+	require.Equal(t, 0, km.Len(), "Expected unused keys to be discarded")
+
+	require.Panics(t, func() { km.Unlock("a") })
+}
+
+func TestKeyedMutexConcurrency(t *testing.T) {
+	km := locallock.KeyedMutex{}
+	var inside, max int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			km.Lock("key")
+			n := atomic.AddInt32(&inside, 1)
+			if n > atomic.LoadInt32(&max) {
+				atomic.StoreInt32(&max, n)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&inside, -1)
+			km.Unlock("key")
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), max)
+	require.Equal(t, 0, km.Len())
+}
+
+func requireClosed(t *testing.T, done <-chan struct{}) {
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected lock channel to be closed")
+	}
+}
@@ -0,0 +1,68 @@
+package lock
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// DefaultBackoff is the Backoff used by the lockers when none is configured
+var DefaultBackoff = Backoff{
+	Min:    50 * time.Millisecond,
+	Max:    2 * time.Second,
+	Factor: 2,
+	Jitter: 0.2,
+}
+
+// Backoff computes the delay between attempts to acquire a lock.
+type Backoff struct {
+	// Min is the delay after the first failed attempt
+	Min time.Duration
+	// Max caps the delay
+	Max time.Duration
+	// Factor multiplies the delay after each failed attempt
+	Factor float64
+	// Jitter randomizes the delay by up to this fraction (0 to 1), so that waiting contenders do not retry in lockstep
+	Jitter float64
+}
+
+// Delay returns the delay to wait after the failed attempt number attempt, starting at 0
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := float64(b.Min)
+	for i := 0; i < attempt && d < float64(b.Max); i++ {
+		d *= b.Factor
+	}
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		d += d * b.Jitter * (rand.Float64()*2 - 1)
+	}
+	if d < 0 {
+		return 0
+	}
+	return time.Duration(d)
+}
+
+// Retry calls acquire until the lock is acquired, an error occurs or the context is done.
+// Between attempts it calls wait with the backoff delay.
+// wait should return earlier if it knows that the lock was released.
+func Retry(
+	ctx context.Context,
+	b Backoff,
+	acquire func(context.Context) (<-chan struct{}, error),
+	wait func(context.Context, time.Duration) error,
+) (<-chan struct{}, error) {
+	for attempt := 0; ; attempt++ {
+		done, err := acquire(ctx)
+		if err != nil || done != nil {
+			return done, err
+		}
+		if err := wait(ctx, b.Delay(attempt)); err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
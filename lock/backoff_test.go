@@ -0,0 +1,57 @@
+package lock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/quintans/toolkit/lock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := lock.Backoff{Min: 10 * time.Millisecond, Max: 100 * time.Millisecond, Factor: 2}
+	require.Equal(t, 10*time.Millisecond, b.Delay(0))
+	require.Equal(t, 20*time.Millisecond, b.Delay(1))
+	require.Equal(t, 80*time.Millisecond, b.Delay(3))
+	require.Equal(t, 100*time.Millisecond, b.Delay(4))
+	require.Equal(t, 100*time.Millisecond, b.Delay(1000))
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := b.Delay(1)
+		require.True(t, d >= 10*time.Millisecond && d <= 30*time.Millisecond, "Delay %s out of jitter range", d)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+	var delays []time.Duration
+	b := lock.Backoff{Min: time.Millisecond, Max: 4 * time.Millisecond, Factor: 2}
+	done, err := lock.Retry(context.Background(), b,
+		func(context.Context) (<-chan struct{}, error) {
+			attempts++
+			if attempts < 5 {
+				return nil, nil
+			}
+			return make(chan struct{}), nil
+		},
+		func(_ context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		},
+	)
+	require.NoError(t, err)
+	require.NotNil(t, done)
+	require.Equal(t, 5, attempts)
+	require.Equal(t, []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 4 * time.Millisecond}, delays)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done, err = lock.Retry(ctx, b,
+		func(context.Context) (<-chan struct{}, error) { return nil, nil },
+		func(ctx context.Context, _ time.Duration) error { return ctx.Err() },
+	)
+	require.Nil(t, done)
+	require.Equal(t, context.Canceled, err)
+}
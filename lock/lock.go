@@ -0,0 +1,33 @@
+package lock
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrAlreadyAcquired is returned when trying to acquire a lock that is already held by the same Locker
+var ErrAlreadyAcquired = errors.New("lock already acquired")
+
+// Locker is a distributed lock.
+//
+// A Locker instance represents one contender of a named lock.
+// The same instance can acquire the lock again after it was released or lost.
+type Locker interface {
+	// Lock tries to acquire the lock without waiting.
+	// If successful, it returns a channel that is closed when the lock is released or lost,
+	// otherwise it returns a nil channel and a nil error.
+	Lock(ctx context.Context) (<-chan struct{}, error)
+	// LockWait is the same as Lock but, if the lock is taken, it keeps retrying until
+	// the lock is acquired or the context is done.
+	LockWait(ctx context.Context) (<-chan struct{}, error)
+	// TryLock is the same as Lock, returning true if the lock was acquired.
+	// The lost lock notification channel is available through Done.
+	TryLock(ctx context.Context) (bool, error)
+	// Unlock releases the lock. Releasing a lock that is not held does nothing.
+	Unlock(ctx context.Context) error
+	// Done returns the channel that is closed when the lock is released or lost,
+	// or nil if the lock is not held.
+	Done() <-chan struct{}
+	// WaitForUnlock blocks until the lock is not held by anyone
+	WaitForUnlock(ctx context.Context) error
+}
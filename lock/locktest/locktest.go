@@ -0,0 +1,206 @@
+// Package locktest provides a conformance test suite for lock.Locker implementations
+package locktest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quintans/toolkit/lock"
+	"github.com/stretchr/testify/require"
+)
+
+var counter int64
+
+// Factory creates a new contender for the named lock.
+// Contenders for the same name must behave as if they were in different processes.
+type Factory func(t *testing.T, name string) lock.Locker
+
+// Run runs the conformance test suite against the Locker implementation created by factory
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		test func(*testing.T, Factory, string)
+	}{
+		{"AcquireRelease", testAcquireRelease},
+		{"TryLock", testTryLock},
+		{"AlreadyAcquired", testAlreadyAcquired},
+		{"UnlockNotHeld", testUnlockNotHeld},
+		{"Reacquire", testReacquire},
+		{"WaitForUnlock", testWaitForUnlock},
+		{"LockWait", testLockWait},
+		{"LockWaitTimeout", testLockWaitTimeout},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			name := fmt.Sprintf("locktest-%s-%d", tt.name, atomic.AddInt64(&counter, 1))
+			tt.test(t, factory, name)
+		})
+	}
+}
+
+func testAcquireRelease(t *testing.T, factory Factory, name string) {
+	ctx := context.Background()
+	l1 := factory(t, name)
+	l2 := factory(t, name)
+
+	done1, err := l1.Lock(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, done1, "Expected to acquire lock")
+	require.True(t, l1.Done() == done1, "Expected Done() to return the lock channel")
+
+	done2, err := l2.Lock(ctx)
+	require.NoError(t, err)
+	require.Nil(t, done2, "Expected to not acquire lock")
+	require.Nil(t, l2.Done())
+
+	err = l1.Unlock(ctx)
+	require.NoError(t, err)
+	requireClosed(t, done1)
+	require.Nil(t, l1.Done())
+
+	done2, err = l2.Lock(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, done2, "Expected to acquire lock after release")
+	require.NoError(t, l2.Unlock(ctx))
+}
+
+func testTryLock(t *testing.T, factory Factory, name string) {
+	ctx := context.Background()
+	l1 := factory(t, name)
+	l2 := factory(t, name)
+
+	ok, err := l1.TryLock(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NotNil(t, l1.Done())
+
+	ok, err = l2.TryLock(ctx)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, l1.Unlock(ctx))
+}
+
+func testAlreadyAcquired(t *testing.T, factory Factory, name string) {
+	ctx := context.Background()
+	l := factory(t, name)
+
+	_, err := l.Lock(ctx)
+	require.NoError(t, err)
+	defer l.Unlock(ctx)
+
+	_, err = l.Lock(ctx)
+	require.True(t, errors.Is(err, lock.ErrAlreadyAcquired), "Expected ErrAlreadyAcquired, got %v", err)
+}
+
+func testUnlockNotHeld(t *testing.T, factory Factory, name string) {
+	ctx := context.Background()
+	l1 := factory(t, name)
+	l2 := factory(t, name)
+
+	require.NoError(t, l1.Unlock(ctx))
+
+	done, err := l1.Lock(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, done)
+
+	// a contender that does not hold the lock cannot release it
+	require.NoError(t, l2.Unlock(ctx))
+	done2, err := l2.Lock(ctx)
+	require.NoError(t, err)
+	require.Nil(t, done2)
+
+	require.NoError(t, l1.Unlock(ctx))
+}
+
+func testReacquire(t *testing.T, factory Factory, name string) {
+	ctx := context.Background()
+	l := factory(t, name)
+
+	for i := 0; i < 3; i++ {
+		done, err := l.Lock(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, done, "Expected to acquire lock on iteration %d", i)
+		require.NoError(t, l.Unlock(ctx))
+		requireClosed(t, done)
+	}
+}
+
+func testWaitForUnlock(t *testing.T, factory Factory, name string) {
+	ctx := context.Background()
+	l1 := factory(t, name)
+	l2 := factory(t, name)
+
+	done, err := l1.Lock(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, done)
+
+	wait := 2 * time.Second
+	start := time.Now()
+	go func() {
+		time.Sleep(wait)
+		l1.Unlock(ctx)
+	}()
+
+	err = l2.WaitForUnlock(ctx)
+	require.NoError(t, err)
+	require.True(t, time.Since(start) >= wait, "Waiting duration for lock was too short")
+
+	// waiting for a free lock returns immediately
+	ctx2, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	require.NoError(t, l2.WaitForUnlock(ctx2))
+}
+
+func testLockWait(t *testing.T, factory Factory, name string) {
+	ctx := context.Background()
+	l1 := factory(t, name)
+	l2 := factory(t, name)
+
+	done, err := l1.LockWait(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, done, "Expected to acquire free lock")
+
+	wait := time.Second
+	start := time.Now()
+	go func() {
+		time.Sleep(wait)
+		l1.Unlock(ctx)
+	}()
+
+	done, err = l2.LockWait(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, done, "Expected to acquire lock after release")
+	require.True(t, time.Since(start) >= wait, "Waiting duration for lock was too short")
+	require.NoError(t, l2.Unlock(ctx))
+}
+
+func testLockWaitTimeout(t *testing.T, factory Factory, name string) {
+	ctx := context.Background()
+	l1 := factory(t, name)
+	l2 := factory(t, name)
+
+	done, err := l1.Lock(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, done)
+	defer l1.Unlock(ctx)
+
+	ctx2, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	done, err = l2.LockWait(ctx2)
+	require.Nil(t, done)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "Expected deadline exceeded, got %v", err)
+}
+
+func requireClosed(t *testing.T, done <-chan struct{}) {
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected lock channel to be closed")
+	}
+}
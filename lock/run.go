@@ -0,0 +1,103 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotAcquired is returned by Run when the lock is held by someone else
+	ErrNotAcquired = errors.New("lock not acquired")
+	// ErrLockLost is returned by Run when the lock was lost while the function was running
+	ErrLockLost = errors.New("lock lost")
+)
+
+// LockLostError is returned by Run when the lock was lost while the function was running,
+// with the error returned by the function, if any.
+// It matches ErrLockLost with errors.Is and unwraps to the error of the function.
+type LockLostError struct {
+	Err error
+}
+
+func (e *LockLostError) Error() string {
+	if e.Err == nil {
+		return ErrLockLost.Error()
+	}
+	return ErrLockLost.Error() + ": " + e.Err.Error()
+}
+
+func (e *LockLostError) Is(target error) bool {
+	return target == ErrLockLost
+}
+
+func (e *LockLostError) Unwrap() error {
+	return e.Err
+}
+
+type runOptions struct {
+	wait bool
+}
+
+// RunOption configures Run
+type RunOption func(*runOptions)
+
+// RunWait sets if Run waits for the lock, with LockWait, when it is held by someone else.
+// Default is false, returning ErrNotAcquired.
+func RunWait(wait bool) RunOption {
+	return func(o *runOptions) {
+		o.wait = wait
+	}
+}
+
+// Run acquires the lock, calls fn and releases the lock when fn returns.
+//
+// The lease of the lock is extended by the Locker while fn runs.
+// If the lock is lost, the context passed to fn is cancelled and
+// Run returns a *LockLostError, matching ErrLockLost and wrapping the error of fn, if any.
+// Errors acquiring or releasing the lock are wrapped, while the errors of fn are returned as is.
+func Run(ctx context.Context, l Locker, fn func(context.Context) error, options ...RunOption) error {
+	opts := runOptions{}
+	for _, o := range options {
+		o(&opts)
+	}
+
+	var done <-chan struct{}
+	var err error
+	if opts.wait {
+		done, err = l.LockWait(ctx)
+	} else {
+		done, err = l.Lock(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("acquiring lock: %w", err)
+	}
+	if done == nil {
+		return ErrNotAcquired
+	}
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-fnCtx.Done():
+		}
+	}()
+
+	err = fn(fnCtx)
+
+	select {
+	case <-done:
+		// the lock was lost before being released
+		return &LockLostError{Err: err}
+	default:
+	}
+
+	// the context may no longer be usable
+	if errUnlock := l.Unlock(context.Background()); errUnlock != nil && err == nil {
+		return fmt.Errorf("releasing lock: %w", errUnlock)
+	}
+	return err
+}
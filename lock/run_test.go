@@ -0,0 +1,95 @@
+package lock_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/quintans/toolkit/leaktest"
+	"github.com/quintans/toolkit/locallock"
+	"github.com/quintans/toolkit/lock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	manager := locallock.NewManager()
+	l := manager.NewLock("job", time.Second)
+
+	ran := false
+	err := lock.Run(ctx, l, func(ctx context.Context) error {
+		ran = true
+		require.True(t, manager.IsLocked("job"))
+		return nil
+	})
+	require.NoError(t, err)
+	require.True(t, ran)
+	require.False(t, manager.IsLocked("job"), "Expected lock to be released")
+
+	errFn := errors.New("failed")
+	err = lock.Run(ctx, l, func(ctx context.Context) error {
+		return errFn
+	})
+	require.Equal(t, errFn, err)
+	require.False(t, manager.IsLocked("job"), "Expected lock to be released")
+}
+
+func TestRunNotAcquired(t *testing.T) {
+	ctx := context.Background()
+	manager := locallock.NewManager()
+	holder := manager.NewLock("job", time.Second)
+	l := manager.NewLock("job", time.Second)
+
+	_, err := holder.Lock(ctx)
+	require.NoError(t, err)
+
+	err = lock.Run(ctx, l, func(ctx context.Context) error {
+		t.Fatal("Expected function not to run")
+		return nil
+	})
+	require.Equal(t, lock.ErrNotAcquired, err)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		holder.Unlock(ctx)
+	}()
+	ran := false
+	err = lock.Run(ctx, l, func(ctx context.Context) error {
+		ran = true
+		return nil
+	}, lock.RunWait(true))
+	require.NoError(t, err)
+	require.True(t, ran)
+}
+
+func TestRunLockLost(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	ctx := context.Background()
+	manager := locallock.NewManager()
+	l := manager.NewLock("job", time.Second)
+
+	err := lock.Run(ctx, l, func(ctx context.Context) error {
+		manager.Expire("job")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	})
+	require.True(t, errors.Is(err, lock.ErrLockLost), "Expected lock lost, got %v", err)
+	require.True(t, errors.Is(err, context.Canceled), "Expected the error of the function, got %v", err)
+	var lost *lock.LockLostError
+	require.True(t, errors.As(err, &lost))
+	require.Equal(t, context.Canceled, lost.Err)
+
+	// lost while the function did not notice it
+	err = lock.Run(ctx, l, func(ctx context.Context) error {
+		manager.Expire("job")
+		return nil
+	})
+	require.True(t, errors.Is(err, lock.ErrLockLost), "Expected lock lost, got %v", err)
+	require.Equal(t, lock.ErrLockLost.Error(), err.Error())
+}
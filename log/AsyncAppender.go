@@ -0,0 +1,321 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var _ EventWriter = &AsyncAppender{}
+
+// BatchWriter is a LogWriter that writes many events at once, eg: with a single write to a file
+type BatchWriter interface {
+	LogWriter
+	LogBatch([]*Event)
+}
+
+// OverflowPolicy is what AsyncAppender does when its buffer is full
+type OverflowPolicy int
+
+const (
+	// Block waits for room in the buffer
+	Block OverflowPolicy = iota
+	// DropNewest discards the message being logged, unless it is FATAL
+	DropNewest
+	// DropOldest discards the oldest message in the buffer that is not FATAL
+	DropOldest
+)
+
+type asyncOptions struct {
+	bufferSize int
+	overflow   OverflowPolicy
+	batchSize  int
+}
+
+// AsyncOption configures an AsyncAppender
+type AsyncOption func(*asyncOptions)
+
+// AsyncBufferSize sets the number of messages waiting to be written. Default is 1024.
+func AsyncBufferSize(size int) AsyncOption {
+	return func(o *asyncOptions) {
+		o.bufferSize = size
+	}
+}
+
+// AsyncOverflow sets what happens when the buffer is full. Default is Block.
+func AsyncOverflow(policy OverflowPolicy) AsyncOption {
+	return func(o *asyncOptions) {
+		o.overflow = policy
+	}
+}
+
+// AsyncBatchSize sets the maximum number of messages passed at once to a BatchWriter. Default is 128.
+func AsyncBatchSize(size int) AsyncOption {
+	return func(o *asyncOptions) {
+		o.batchSize = size
+	}
+}
+
+type entry struct {
+	// event is nil for the messages logged with Log
+	event *Event
+	level LogLevel
+	msg   string
+	// position in the order of the queued messages
+	seq uint64
+}
+
+// AsyncAppender writes the messages to a LogWriter in a separate goroutine.
+//
+// Messages logged with the FATAL level are only returned when they are written, and are never dropped:
+// if the buffer is full of them, the caller waits for room whatever the overflow policy.
+// After Shutdown, or Discard, the writer is discarded, so the messages are dropped, whatever their level,
+// and counted by Dropped.
+type AsyncAppender struct {
+	writer LogWriter
+	opts   asyncOptions
+
+	mu sync.Mutex
+	// signaled when messages are queued or the appender is shut down
+	queued *sync.Cond
+	// signaled when messages are dequeued
+	dequeued *sync.Cond
+	// ring buffer
+	buffer []entry
+	head   int
+	size   int
+	// number of messages queued and position of the last message written
+	enqueued  uint64
+	processed uint64
+	dropped   uint64
+	// dropped messages not yet reported to the writer
+	unreported uint64
+	shutdown   bool
+	done       chan struct{}
+}
+
+// NewAsyncAppender creates an AsyncAppender writing to the writer
+func NewAsyncAppender(writer LogWriter, options ...AsyncOption) *AsyncAppender {
+	opts := asyncOptions{
+		bufferSize: 1024,
+		batchSize:  128,
+	}
+	for _, o := range options {
+		o(&opts)
+	}
+	if opts.bufferSize < 1 {
+		opts.bufferSize = 1
+	}
+	if opts.batchSize < 1 {
+		opts.batchSize = 1
+	}
+
+	a := &AsyncAppender{
+		writer: writer,
+		opts:   opts,
+		buffer: make([]entry, opts.bufferSize),
+		done:   make(chan struct{}),
+	}
+	a.queued = sync.NewCond(&a.mu)
+	a.dequeued = sync.NewCond(&a.mu)
+	go a.run()
+	return a
+}
+
+func (a *AsyncAppender) Log(level LogLevel, msg string) {
+	a.enqueue(entry{level: level, msg: msg})
+}
+
+func (a *AsyncAppender) LogEvent(e *Event) {
+	a.enqueue(entry{event: e, level: e.Level})
+}
+
+// Dropped returns the number of messages dropped because the buffer was full or the appender was shut down
+func (a *AsyncAppender) Dropped() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.dropped
+}
+
+// Discard writes all the queued messages and discards the writer
+func (a *AsyncAppender) Discard() {
+	a.Shutdown(context.Background())
+}
+
+// Shutdown stops the goroutine after writing all the queued messages and discards the writer.
+// If the context is done before, it returns the context error and the remaining messages are written in the background.
+func (a *AsyncAppender) Shutdown(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.shutdown {
+		a.shutdown = true
+		a.queued.Broadcast()
+		// unblocks the producers
+		a.dequeued.Broadcast()
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *AsyncAppender) enqueue(en entry) {
+	a.mu.Lock()
+	if a.shutdown {
+		a.drop()
+		a.mu.Unlock()
+		return
+	}
+
+	for a.size == len(a.buffer) && !a.shutdown {
+		switch {
+		case a.opts.overflow == DropNewest && en.level != FATAL:
+			a.drop()
+			a.mu.Unlock()
+			return
+		case a.opts.overflow == DropOldest && a.dropOldest():
+		default:
+			a.dequeued.Wait()
+		}
+	}
+	if a.shutdown {
+		a.drop()
+		a.mu.Unlock()
+		return
+	}
+
+	a.enqueued++
+	en.seq = a.enqueued
+	a.buffer[(a.head+a.size)%len(a.buffer)] = en
+	a.size++
+	a.queued.Signal()
+
+	if en.level == FATAL {
+		for a.processed < en.seq && !a.shutdown {
+			a.dequeued.Wait()
+		}
+	}
+	a.mu.Unlock()
+}
+
+// dropOldest removes the oldest message in the buffer that is not FATAL, returning false if there is none.
+// must be called with the lock held
+func (a *AsyncAppender) dropOldest() bool {
+	n := len(a.buffer)
+	for i := 0; i < a.size; i++ {
+		if a.buffer[(a.head+i)%n].level == FATAL {
+			continue
+		}
+		// the FATAL messages before it move one position
+		for j := i; j > 0; j-- {
+			a.buffer[(a.head+j)%n] = a.buffer[(a.head+j-1)%n]
+		}
+		a.buffer[a.head] = entry{}
+		a.head = (a.head + 1) % n
+		a.size--
+		a.drop()
+		return true
+	}
+	return false
+}
+
+// drop must be called with the lock held
+func (a *AsyncAppender) drop() {
+	a.dropped++
+	a.unreported++
+}
+
+func (a *AsyncAppender) run() {
+	defer close(a.done)
+
+	batch := make([]entry, 0, a.opts.batchSize)
+	for {
+		a.mu.Lock()
+		for a.size == 0 && !a.shutdown {
+			a.queued.Wait()
+		}
+		if a.size == 0 && a.shutdown {
+			a.mu.Unlock()
+			break
+		}
+		for a.size > 0 && len(batch) < cap(batch) {
+			batch = append(batch, a.buffer[a.head])
+			a.buffer[a.head] = entry{}
+			a.head = (a.head + 1) % len(a.buffer)
+			a.size--
+		}
+		unreported := a.unreported
+		a.unreported = 0
+		// there is room in the buffer
+		a.dequeued.Broadcast()
+		a.mu.Unlock()
+
+		if unreported > 0 {
+			a.write([]entry{droppedEntry(unreported)})
+		}
+		a.write(batch)
+
+		a.mu.Lock()
+		a.processed = batch[len(batch)-1].seq
+		a.dequeued.Broadcast()
+		a.mu.Unlock()
+
+		for k := range batch {
+			batch[k] = entry{}
+		}
+		batch = batch[:0]
+	}
+
+	a.mu.Lock()
+	unreported := a.unreported
+	a.unreported = 0
+	a.mu.Unlock()
+	if unreported > 0 {
+		a.write([]entry{droppedEntry(unreported)})
+	}
+
+	a.writer.Discard()
+}
+
+func droppedEntry(count uint64) entry {
+	e := &Event{
+		Time:      time.Now(),
+		Level:     WARN,
+		Namespace: "/",
+		Message:   fmt.Sprintf("%d log messages were dropped", count),
+	}
+	return entry{event: e, level: e.Level}
+}
+
+// write writes the entries, in batches of events if the writer supports it
+func (a *AsyncAppender) write(entries []entry) {
+	bw, batching := a.writer.(BatchWriter)
+	ew, events := a.writer.(EventWriter)
+	var pending []*Event
+	flushPending := func() {
+		if len(pending) > 0 {
+			bw.LogBatch(pending)
+			pending = pending[:0]
+		}
+	}
+	for _, en := range entries {
+		switch {
+		case en.event != nil && batching:
+			pending = append(pending, en.event)
+		case en.event != nil && events:
+			ew.LogEvent(en.event)
+		case en.event != nil:
+			flushPending()
+			a.writer.Log(en.level, string(en.event.Encode(nil, false)))
+		default:
+			flushPending()
+			a.writer.Log(en.level, en.msg)
+		}
+	}
+	flushPending()
+}
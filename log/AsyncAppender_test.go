@@ -0,0 +1,218 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingWriter blocks the writes until released
+type blockingWriter struct {
+	captureWriter
+	release   chan struct{}
+	discarded bool
+}
+
+func (w *blockingWriter) Log(level LogLevel, msg string) {
+	<-w.release
+	w.captureWriter.Log(level, msg)
+}
+
+func (w *blockingWriter) Discard() {
+	w.mu.Lock()
+	w.discarded = true
+	w.mu.Unlock()
+}
+
+func (w *blockingWriter) messages() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]string(nil), w.lines...)
+}
+
+func TestAsyncAppenderShutdown(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	a := NewAsyncAppender(w, AsyncBufferSize(100))
+	for i := 0; i < 10; i++ {
+		a.Log(INFO, "msg\n")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, a.Shutdown(ctx))
+
+	close(w.release)
+	require.NoError(t, a.Shutdown(context.Background()))
+	assert.Len(t, w.messages(), 10)
+	assert.True(t, w.discarded)
+
+	// after the shutdown, the writer is discarded and the messages are dropped
+	a.Log(INFO, "late\n")
+	a.Log(FATAL, "late\n")
+	assert.Len(t, w.messages(), 10)
+	assert.Equal(t, uint64(2), a.Dropped())
+}
+
+func TestAsyncAppenderDropNewest(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	a := NewAsyncAppender(w, AsyncBufferSize(2), AsyncBatchSize(1), AsyncOverflow(DropNewest))
+	a.Log(INFO, "1\n")
+	// waits for the writer to take the first message
+	assert.Eventually(t, func() bool {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return a.size == 0
+	}, time.Second, time.Millisecond)
+	for _, msg := range []string{"2\n", "3\n", "4\n", "5\n"} {
+		a.Log(INFO, msg)
+	}
+	assert.Equal(t, uint64(2), a.Dropped())
+
+	close(w.release)
+	a.Discard()
+	msgs := w.messages()
+	require.Len(t, msgs, 4)
+	assert.Equal(t, "1\n", msgs[0])
+	// the drops are reported before the next written messages
+	assert.Contains(t, msgs[1], "2 log messages were dropped")
+	assert.Equal(t, []string{"2\n", "3\n"}, msgs[2:])
+}
+
+func TestAsyncAppenderDropOldest(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	a := NewAsyncAppender(w, AsyncBufferSize(2), AsyncBatchSize(1), AsyncOverflow(DropOldest))
+	a.Log(INFO, "1\n")
+	assert.Eventually(t, func() bool {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return a.size == 0
+	}, time.Second, time.Millisecond)
+	for _, msg := range []string{"2\n", "3\n", "4\n", "5\n"} {
+		a.Log(INFO, msg)
+	}
+	assert.Equal(t, uint64(2), a.Dropped())
+
+	close(w.release)
+	a.Discard()
+	msgs := w.messages()
+	require.Len(t, msgs, 4)
+	assert.Equal(t, "1\n", msgs[0])
+	assert.Contains(t, msgs[1], "2 log messages were dropped")
+	assert.Equal(t, []string{"4\n", "5\n"}, msgs[2:])
+}
+
+func TestAsyncAppenderNeverDropsFatal(t *testing.T) {
+	expected := map[OverflowPolicy][]string{
+		DropNewest: {"f1\n", "2\n", "f2\n"},
+		DropOldest: {"f1\n", "f2\n"},
+	}
+	for policy, written := range expected {
+		w := &blockingWriter{release: make(chan struct{})}
+		a := NewAsyncAppender(w, AsyncBufferSize(2), AsyncBatchSize(1), AsyncOverflow(policy))
+		a.Log(INFO, "1\n")
+		assert.Eventually(t, func() bool {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			return a.size == 0
+		}, time.Second, time.Millisecond)
+
+		var wg sync.WaitGroup
+		fatal := func(msg string) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				a.Log(FATAL, msg)
+			}()
+			// waits for the message to be queued, or for room in the buffer
+			time.Sleep(20 * time.Millisecond)
+		}
+		fatal("f1\n")
+		a.Log(INFO, "2\n")
+		// the buffer is full
+		a.Log(INFO, "3\n")
+		fatal("f2\n")
+
+		close(w.release)
+		wg.Wait()
+		a.Discard()
+		msgs := w.messages()
+		require.Len(t, msgs, 2+len(written), "policy %d", policy)
+		assert.Equal(t, "1\n", msgs[0])
+		assert.Contains(t, msgs[1], "log messages were dropped")
+		assert.Equal(t, written, msgs[2:], "policy %d", policy)
+	}
+}
+
+func TestAsyncAppenderBlock(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	a := NewAsyncAppender(w, AsyncBufferSize(1), AsyncBatchSize(1))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			a.Log(INFO, "msg\n")
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, w.messages())
+	close(w.release)
+	wg.Wait()
+	a.Discard()
+	assert.Len(t, w.messages(), 5)
+	assert.Equal(t, uint64(0), a.Dropped())
+}
+
+func TestAsyncAppenderFatalWaits(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	close(w.release)
+	a := NewAsyncAppender(w)
+	defer a.Discard()
+
+	a.Log(INFO, "info\n")
+	a.Log(FATAL, "fatal\n")
+	assert.Equal(t, []string{"info\n", "fatal\n"}, w.messages())
+}
+
+type syncBuffer struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	writes int
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.writes++
+	return b.buf.Write(p)
+}
+
+func TestAsyncAppenderBatch(t *testing.T) {
+	out := &syncBuffer{}
+	root := &RootAppender{Writer: out}
+	a := NewAsyncAppender(root, AsyncBatchSize(100))
+	logger := register(t, "/test/async", a)
+
+	a.mu.Lock()
+	// holds the goroutine, so that the messages are batched
+	for i := 0; i < 3; i++ {
+		a.buffer[i] = entry{event: logger.event(INFO, "batched", nil), level: INFO}
+		a.size++
+		a.enqueued++
+	}
+	a.queued.Signal()
+	a.mu.Unlock()
+
+	require.NoError(t, a.Shutdown(context.Background()))
+	assert.Equal(t, 1, out.writes)
+	assert.Equal(t, 3, strings.Count(out.buf.String(), ": batched\n"))
+}
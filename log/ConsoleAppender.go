@@ -3,17 +3,20 @@ package log
 import (
 	"io"
 	"os"
+
+	"github.com/fatih/color"
 )
 
-// check if it implements LogWriter interface
-var _ LogWriter = &Console{}
+// check if it implements EventWriter interface
+var _ EventWriter = &Console{}
 
 func NewConsoleAppender(async bool) *Console {
 	this := new(Console)
 	this.Writer = io.Writer(os.Stdout)
+	// color.NoColor is set when stdout is not a terminal
+	this.Color = !color.NoColor
 	if async {
-		this.Channel = make(chan string, 10)
-		go AsyncWriter(this.Channel, this)
+		this.startAsync(this)
 	}
 	return this
 }
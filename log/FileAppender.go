@@ -29,8 +29,7 @@ func NewFileAppender(file string, size int64, resetOnStartup bool, async bool) *
 	}
 
 	if async {
-		this.Channel = make(chan string, 10)
-		go AsyncWriter(this.Channel, this)
+		this.startAsync(this)
 	}
 	return this
 }
@@ -0,0 +1,112 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/quintans/toolkit/faults"
+)
+
+var _ Encoder = &JournalEncoder{}
+
+// JournalSocket is the socket where journald receives the messages of its native protocol
+const JournalSocket = "/run/systemd/journal/socket"
+
+// JournalEncoder encodes an event with the native protocol of journald, with the fields:
+// MESSAGE, PRIORITY, SYSLOG_IDENTIFIER, NAMESPACE, CODE_FILE, CODE_LINE, ERROR, STACK and the fields of the event.
+//
+// The keys of the event fields are converted to valid journal field names: upper case letters, digits and underscores.
+type JournalEncoder struct {
+	// Identifier is the SYSLOG_IDENTIFIER. Default is the name of the executable.
+	Identifier string
+}
+
+func (enc *JournalEncoder) Encode(buf *bytes.Buffer, e *Event, color bool) {
+	writeJournalField(buf, "MESSAGE", e.Message)
+	writeJournalField(buf, "PRIORITY", strconv.Itoa(syslogSeverity(e.Level)))
+	identifier := enc.Identifier
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+	writeJournalField(buf, "SYSLOG_IDENTIFIER", identifier)
+	writeJournalField(buf, "NAMESPACE", e.Namespace)
+	if idx := strings.LastIndex(e.Caller, ":"); idx > 0 {
+		writeJournalField(buf, "CODE_FILE", e.Caller[:idx])
+		writeJournalField(buf, "CODE_LINE", e.Caller[idx+1:])
+	}
+	for _, f := range e.Fields {
+		writeJournalField(buf, journalFieldName(f.Key), f.text())
+	}
+	if e.Error != nil {
+		writeJournalField(buf, "ERROR", faults.Error(e.Error))
+		if stack := errorStack(e.Error); stack != "" {
+			writeJournalField(buf, "STACK", stack)
+		}
+	}
+}
+
+// writeJournalField writes NAME=value followed by a new line or,
+// if the value has new lines, the name, a new line, the little endian 64 bit size of the value, the value and a new line.
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if strings.IndexByte(value, '\n') < 0 {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	buf.Write(size[:])
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalFieldName converts the key to a field name that journald accepts:
+// at most 64 upper case letters, digits and underscores, not starting with an underscore or a digit
+func journalFieldName(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key) && b.Len() < 64; i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			c -= 'a' - 'A'
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		default:
+			c = '_'
+		}
+		if b.Len() == 0 && (c == '_' || c >= '0' && c <= '9') {
+			// underscores are reserved for the fields set by journald
+			if c == '_' {
+				continue
+			}
+			b.WriteByte('F')
+		}
+		b.WriteByte(c)
+	}
+	if b.Len() == 0 {
+		return "FIELD"
+	}
+	return b.String()
+}
+
+// NewJournalAppender creates a NetAppender sending the messages to journald, with its native protocol.
+// If the socket is empty, JournalSocket is used. If the encoder is nil, a JournalEncoder with the default values is used.
+//
+// Each message is sent in a single datagram, so messages larger than the maximum datagram size are not sent
+// and their error is passed to the error function.
+func NewJournalAppender(socket string, encoder *JournalEncoder, options ...NetOption) *NetAppender {
+	if socket == "" {
+		socket = JournalSocket
+	}
+	if encoder == nil {
+		encoder = &JournalEncoder{}
+	}
+	options = append([]NetOption{NetEncoder(encoder)}, options...)
+	return newNetAppender("unixgram", socket, frameRaw, options)
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fatih/color"
@@ -16,33 +18,80 @@ type Worker struct {
 	Level   LogLevel
 	Writers []LogWriter
 
+	// the writers are the ones of the parent worker
+	inherited    bool
 	showLevel    bool
 	showCaller   bool
 	timeFormater func(time.Time) string
+	// text is the encoder built from the settings above
+	text    TextEncoder
+	encoder Encoder
+	filter  Filter
+	// the filter needs the call site of the events
+	callSites bool
 }
 
 func (wrk *Worker) ShowLevel(show bool) {
 	wrk.showLevel = show
+	wrk.text.ShowLevel = show
 }
 
 func (wrk *Worker) ShowCaller(show bool) {
 	wrk.showCaller = show
 }
 
+// SetEncoder sets how the messages are encoded for the writers that do not have their own encoder.
+// If nil, the messages are encoded as text, according to the time format and to the level visibility of the worker.
+func (wrk *Worker) SetEncoder(encoder Encoder) {
+	wrk.encoder = encoder
+}
+
+// Encoder returns the encoder of the worker
+func (wrk *Worker) Encoder() Encoder {
+	if wrk.encoder != nil {
+		return wrk.encoder
+	}
+	return &wrk.text
+}
+
+// SetFilter sets the filter of the events, eg: a Sampler, a Deduplicator, a RateLimit or a FilterChain of them.
+// If nil, all the events are written.
+func (wrk *Worker) SetFilter(filter Filter) {
+	wrk.filter = filter
+	wrk.callSites = usesCallSite(filter)
+}
+
+// Filter returns the filter of the events
+func (wrk *Worker) Filter() Filter {
+	return wrk.filter
+}
+
 type LogHandler struct {
 	Message string
 	Worker  *Worker
 }
 
 type LogMaster struct {
+	mu      sync.RWMutex
 	workers []*Worker
-	loggers []*Logger
+	// refs has the worker of each namespace that has loggers
+	refs map[string]*workerRef
+}
+
+// workerRef holds the worker of a namespace, shared by the loggers of the namespace
+type workerRef struct {
+	tag    string
+	worker atomic.Value // *Worker
+}
+
+func (this *workerRef) load() *Worker {
+	return this.worker.Load().(*Worker)
 }
 
 var (
 	logMaster = &LogMaster{
 		workers: make([]*Worker, 0),
-		loggers: make([]*Logger, 0),
+		refs:    map[string]*workerRef{},
 	}
 )
 
@@ -71,45 +120,40 @@ func normalizeNamespace(namespace string) string {
 	return namespace
 }
 
+// Register adds, or replaces, the worker of the namespace.
+//
+// Without writers, the worker uses the writers of its parent. When these change, eg: by Configure,
+// the worker is replaced by a copy with the new writers, so the returned worker should no longer be changed.
 func Register(namespace string, level LogLevel, writers ...LogWriter) *Worker {
 	namespace = normalizeNamespace(namespace)
+	worker := newWorker(namespace, level, writers)
+
+	logMaster.mu.Lock()
+	defer logMaster.mu.Unlock()
 
 	// if there are no supplied writers use the ones from the parent
+	if len(writers) == 0 {
+		wrk := logMaster.findWorker(namespace)
+		worker.Writers = wrk.Writers
+		worker.inherited = true
+	}
+	logMaster.putWorker(worker)
+
+	return worker
+}
+
+const defaultTimeFormat = "%Y-%02M-%02D %02h:%02m:%02s.%03x"
+
+func newWorker(namespace string, level LogLevel, writers []LogWriter) *Worker {
 	worker := &Worker{
 		Prefix:    namespace,
 		Level:     level,
 		Writers:   writers,
 		showLevel: true,
+		text:      TextEncoder{ShowLevel: true},
 	}
-	if len(writers) == 0 {
-		wrk := logMaster.fetchWorker(namespace)
-		worker.Writers = wrk.Writers
-	}
-
-	if len(logMaster.workers) == 0 {
-		logMaster.workers = append(logMaster.workers, worker)
-	} else {
-		for k, v := range logMaster.workers {
-			if namespace > v.Prefix {
-				// insert. Worker are inserted in descending order by Prefix
-				var s = append(logMaster.workers, nil)
-				copy(s[k+1:], s[k:])
-				s[k] = worker
-				logMaster.workers = s
-				break
-			} else if v.Prefix == namespace {
-				// replace on match
-				logMaster.workers[k] = worker
-				break
-			}
-		}
-	}
-
 	// default timestamp
-	worker.SetTimeFormat("%Y-%02M-%02D %02h:%02m:%02s.%03x")
-
-	logMaster.fireWorkerListeners(worker)
-
+	worker.SetTimeFormat(defaultTimeFormat)
 	return worker
 }
 
@@ -121,13 +165,20 @@ func LoggerFor(namespace string) *Logger {
 	namespace = normalizeNamespace(namespace)
 	logger := new(Logger)
 	logger.tag = namespace
+	logger.ref = logMaster.ref(namespace)
 	return logger
 }
 
 func (this *LogMaster) fetchWorker(tag string) *Worker {
-	namespace := normalizeNamespace(tag)
+	this.mu.RLock()
+	defer this.mu.RUnlock()
 
-	for _, v := range logMaster.workers {
+	return this.findWorker(normalizeNamespace(tag))
+}
+
+// findWorker must be called with the lock held
+func (this *LogMaster) findWorker(namespace string) *Worker {
+	for _, v := range this.workers {
 		if strings.HasPrefix(namespace, v.Prefix) {
 			return v
 		}
@@ -136,13 +187,117 @@ func (this *LogMaster) fetchWorker(tag string) *Worker {
 	panic(fmt.Sprintf("No Worker was found for %s", namespace))
 }
 
+// putWorker adds the worker, or replaces the one with the same prefix.
+// It must be called with the lock held.
+func (this *LogMaster) putWorker(worker *Worker) {
+	if len(this.workers) == 0 {
+		this.workers = append(this.workers, worker)
+	} else {
+		for k, v := range this.workers {
+			if worker.Prefix > v.Prefix {
+				// insert. Worker are inserted in descending order by Prefix
+				var s = append(this.workers, nil)
+				copy(s[k+1:], s[k:])
+				s[k] = worker
+				this.workers = s
+				break
+			} else if v.Prefix == worker.Prefix {
+				// replace on match
+				this.workers[k] = worker
+				break
+			}
+		}
+	}
+
+	this.fireWorkerListeners(worker)
+	this.inheritWriters(worker.Prefix)
+}
+
+// removeWorker removes the worker with the prefix, so that its namespace uses the worker of the parent.
+// It must be called with the lock held.
+func (this *LogMaster) removeWorker(prefix string) {
+	for k, v := range this.workers {
+		if v.Prefix == prefix {
+			this.workers = append(this.workers[:k], this.workers[k+1:]...)
+			this.fireWorkerListeners(v)
+			this.inheritWriters(v.Prefix)
+			return
+		}
+	}
+}
+
+// ref returns the holder of the worker of the namespace, creating it if needed
+func (this *LogMaster) ref(namespace string) *workerRef {
+	this.mu.RLock()
+	ref := this.refs[namespace]
+	this.mu.RUnlock()
+	if ref != nil {
+		return ref
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	ref = this.refs[namespace]
+	if ref == nil {
+		ref = &workerRef{tag: namespace}
+		ref.worker.Store(this.findWorker(namespace))
+		this.refs[namespace] = ref
+	}
+	return ref
+}
+
+// fireWorkerListeners updates the worker of the namespaces affected by the added, replaced or removed worker.
+// It must be called with the lock held.
 func (this *LogMaster) fireWorkerListeners(worker *Worker) {
-	for _, v := range logMaster.loggers {
-		v.workerListener(worker)
+	for _, v := range this.refs {
+		if strings.HasPrefix(v.tag, worker.Prefix) {
+			v.worker.Store(this.findWorker(v.tag))
+		}
 	}
 }
 
+// inheritWriters updates the workers below the prefix that use the writers of their parent,
+// replacing them by copies, since they may be in use.
+// It must be called with the lock held.
+func (this *LogMaster) inheritWriters(prefix string) {
+	// parents first, since the workers are in descending order by prefix
+	for k := len(this.workers) - 1; k >= 0; k-- {
+		v := this.workers[k]
+		if !v.inherited || v.Prefix == prefix || !strings.HasPrefix(v.Prefix, prefix) {
+			continue
+		}
+		parent := this.parentWorker(k)
+		if parent == nil || sameWriters(v.Writers, parent.Writers) {
+			continue
+		}
+		worker := *v
+		worker.Writers = parent.Writers
+		this.workers[k] = &worker
+		this.fireWorkerListeners(&worker)
+	}
+}
+
+// parentWorker returns the closest worker above the worker at index k, or nil if none.
+// It must be called with the lock held.
+func (this *LogMaster) parentWorker(k int) *Worker {
+	prefix := this.workers[k].Prefix
+	for _, v := range this.workers[k+1:] {
+		if strings.HasPrefix(prefix, v.Prefix) {
+			return v
+		}
+	}
+	return nil
+}
+
+func sameWriters(a, b []LogWriter) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
 func Shutdown() {
+	logMaster.mu.RLock()
+	defer logMaster.mu.RUnlock()
+
 	for _, v := range logMaster.workers {
 		for _, w := range v.Writers {
 			w.Discard()
@@ -158,9 +313,16 @@ const (
 // available formats: Y,M,D,h,m,s,x.
 // these format will be replaced by 'd' and used normaly with fmt.Sprintf
 func (wrk *Worker) SetTimeFormat(format string) {
+	wrk.timeFormater = TimeFormatter(format)
+	wrk.text.TimeFormat = wrk.timeFormater
+}
+
+// TimeFormatter returns a function formatting a time according to the format.
+// Available formats: Y,M,D,h,m,s,x, eg: %Y-%02M-%02D %02h:%02m:%02s.%03x
+// If the format is empty it returns nil.
+func TimeFormatter(format string) func(time.Time) string {
 	if format == "" {
-		wrk.timeFormater = nil
-		return
+		return nil
 	}
 
 	newFormat := format
@@ -186,7 +348,7 @@ func (wrk *Worker) SetTimeFormat(format string) {
 			last = false
 		}
 	}
-	wrk.timeFormater = func(t time.Time) string {
+	return func(t time.Time) string {
 		params := make([]interface{}, 0)
 		for _, v := range keys {
 			switch v {
@@ -224,17 +386,24 @@ type LogLevel int
 
 var logLevels = [...]string{"ALL", "TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL", "NONE"}
 
+// the colors are always enabled because only the writers know if they write to a terminal
 var logLevelColors = [...]func(a ...interface{}) string{
 	nil,
-	nil,                                      // TRACE
-	color.New(color.FgMagenta).SprintFunc(),  // DEBUG
-	color.New(color.FgHiCyan).SprintFunc(),   // INFO
-	color.New(color.FgHiYellow).SprintFunc(), // WARN
-	color.New(color.FgHiRed).SprintFunc(),    // ERROR
-	color.New(color.FgHiRed).SprintFunc(),    // FATAL
+	nil, // TRACE
+	enabledColor(color.FgMagenta).SprintFunc(),  // DEBUG
+	enabledColor(color.FgHiCyan).SprintFunc(),   // INFO
+	enabledColor(color.FgHiYellow).SprintFunc(), // WARN
+	enabledColor(color.FgHiRed).SprintFunc(),    // ERROR
+	enabledColor(color.FgHiRed).SprintFunc(),    // FATAL
 	nil,
 }
 
+func enabledColor(attr color.Attribute) *color.Color {
+	c := color.New(attr)
+	c.EnableColor()
+	return c
+}
+
 func (this LogLevel) String() string {
 	var level = int(this)
 	if level >= 0 && level <= len(logLevels) {
@@ -280,36 +449,31 @@ type Logger struct {
 	sync.Mutex
 
 	tag       string
-	worker    *Worker
+	ref       *workerRef
 	calldepth int
+	fields    []Field
 }
 
 var _ ILogger = &Logger{}
 
-// workerListener is called when a worker is Registered.
-// this way we keep all worker loggers updated when they are later redefined
-func (this *Logger) workerListener(worker *Worker) {
-	this.Lock()
-	if strings.HasPrefix(this.tag, worker.Prefix) && worker.Prefix > this.worker.Prefix {
-		this.worker = worker
-	}
-	this.Unlock()
-}
-
-func (this *Logger) loadWorker() {
+func (this *Logger) loadWorker() *workerRef {
 	this.Lock()
 	defer this.Unlock()
 
-	if this.worker == nil {
-		this.worker = logMaster.fetchWorker(this.tag)
+	if this.ref == nil {
+		this.ref = logMaster.ref(this.tag)
 	}
+	return this.ref
 }
 
+// getWorker returns the current worker of the logger namespace,
+// kept updated by fireWorkerListeners when the workers change
 func (this *Logger) getWorker() *Worker {
-	if this.worker == nil {
-		this.loadWorker()
+	if ref := this.ref; ref != nil {
+		return ref.load()
 	}
-	return this.worker
+	// a Logger not created by LoggerFor
+	return this.loadWorker().load()
 }
 
 func (this *Logger) Level() LogLevel {
@@ -329,57 +493,78 @@ func (this *Logger) CallerAt(depth int) ILogger {
 	// creates a temporary logger
 	tmp := LoggerFor(this.tag)
 	tmp.calldepth = depth
+	tmp.fields = this.fields
 	return tmp
 }
 
-func (this *Logger) logStamp(level LogLevel) string {
-	t := time.Now()
-	var wrk = logMaster.fetchWorker(this.tag)
+// With returns a child logger that adds the fields to every message.
+// The arguments are Field values or key/value pairs, eg: With("user", id, log.Int("attempt", n))
+func (this *Logger) With(keysAndValues ...interface{}) *Logger {
+	tmp := LoggerFor(this.tag)
+	tmp.calldepth = this.calldepth
+	fields := toFields(keysAndValues)
+	// the fields of the parent are shared, so the child must never append to them
+	tmp.fields = make([]Field, 0, len(this.fields)+len(fields))
+	tmp.fields = append(tmp.fields, this.fields...)
+	tmp.fields = append(tmp.fields, fields...)
+	return tmp
+}
 
-	var result bytes.Buffer
-	if wrk.timeFormater != nil {
-		result.WriteString(wrk.timeFormater(t))
-	}
+// Fields returns the fields added by With
+func (this *Logger) Fields() []Field {
+	return this.fields
+}
 
-	if wrk.showLevel {
-		if result.Len() > 0 {
-			result.WriteString(" ")
+// newEvent must be called by the logging methods of Logger, for the caller to be right
+func (this *Logger) newEvent(level LogLevel, msg string, fields []Field) *Event {
+	e := this.event(level, msg, fields)
+	if e.worker.showCaller || e.worker.callSites {
+		_, file, line, ok := runtime.Caller(this.calldepth + 3)
+		if !ok {
+			file = "???"
+			line = 0
 		}
-		// left padding level
-		var s = level.String()
-		s = strings.Repeat(" ", 5-len(s)) + s
-
-		var colorFunc = logLevelColors[level]
-		if colorFunc != nil {
-			s = colorFunc(s)
+		e.site = file + ":" + strconv.Itoa(line)
+		if e.worker.showCaller {
+			e.Caller = shortCaller(file, line)
 		}
-		result.WriteString(s)
 	}
+	return e
+}
 
-	if wrk.showCaller {
-		if result.Len() > 0 {
-			result.WriteString(" ")
-		}
-		_, file, line, ok := runtime.Caller(this.calldepth + 3)
-		if ok {
-			short := file
-			for i := len(file) - 1; i > 0; i-- {
-				if file[i] == '/' {
-					short = file[i+1:]
-					break
-				}
-			}
-			file = short
-		} else {
-			file = "???"
-			line = 0
+func (this *Logger) event(level LogLevel, msg string, fields []Field) *Event {
+	e := &Event{
+		Time:      time.Now(),
+		Level:     level,
+		Namespace: this.tag,
+		Message:   msg,
+		Fields:    fields,
+		worker:    this.getWorker(),
+	}
+
+	// the error is taken apart so that the encoders can add its stack
+	for k, f := range fields {
+		if f.Type == ErrorType && f.Key == "error" {
+			e.Error = f.Interface.(error)
+			e.errorAt = k + 1
+			e.Fields = make([]Field, 0, len(fields)-1)
+			e.Fields = append(e.Fields, fields[:k]...)
+			e.Fields = append(e.Fields, fields[k+1:]...)
+			break
 		}
-		if result.Len() > 0 {
-			result.WriteString(fmt.Sprintf("[%s:%d]", file, line))
+	}
+	return e
+}
+
+func shortCaller(file string, line int) string {
+	short := file
+	for i := len(file) - 1; i > 0; i-- {
+		if file[i] == '/' {
+			short = file[i+1:]
+			break
 		}
 	}
-	result.WriteString(": ")
-	return result.String()
+	return short + ":" + strconv.Itoa(line)
 }
 
 func (this *Logger) IsActive(level LogLevel) bool {
@@ -388,27 +573,34 @@ func (this *Logger) IsActive(level LogLevel) bool {
 
 func (this *Logger) logf(level LogLevel, format string, what ...interface{}) {
 	if this.IsActive(level) {
-		str := this.logStamp(level)
+		var str string
 		if len(what) > 0 {
 			for k, v := range what {
 				if f, ok := v.(func() string); ok {
 					what[k] = f()
 				}
 			}
-			str += fmt.Sprintf(format+"\n", what...)
+			str = fmt.Sprintf(format, what...)
 		} else {
-			str += format + "\n"
+			str = format
 		}
-		flush(level, str, this.getWorker().Writers)
+		write(this.newEvent(level, str, this.fields))
 	}
 }
 
 func (this *Logger) log(level LogLevel, a ...interface{}) {
 	if this.IsActive(level) {
-		var arr = []interface{}{this.logStamp(level)}
-		arr = append(arr, a...)
-		arr = append(arr, "\n")
-		flush(level, fmt.Sprint(arr...), this.getWorker().Writers)
+		write(this.newEvent(level, fmt.Sprint(a...), this.fields))
+	}
+}
+
+func (this *Logger) logw(level LogLevel, msg string, keysAndValues []interface{}) {
+	if this.IsActive(level) {
+		fields := this.fields
+		if len(keysAndValues) > 0 {
+			fields = append(fields[:len(fields):len(fields)], toFields(keysAndValues)...)
+		}
+		write(this.newEvent(level, msg, fields))
 	}
 }
 
@@ -417,12 +609,71 @@ type LogWriter interface {
 	Log(LogLevel, string)
 }
 
-func flush(msgLevel LogLevel, msg string, workers []LogWriter) {
-	for _, v := range workers {
-		v.Log(msgLevel, msg)
+// EventWriter is a LogWriter that receives the structured event instead of the encoded message
+type EventWriter interface {
+	LogWriter
+	LogEvent(*Event)
+}
+
+// FieldWriter is a LogWriter that receives the fields of a message apart from it,
+// to render them in its own way.
+// The message does not end with a new line.
+type FieldWriter interface {
+	LogWriter
+	LogFields(LogLevel, string, []Field)
+}
+
+// write flushes the event to the writers of its worker, after being filtered
+func write(e *Event) {
+	worker := e.worker
+	if worker.filter == nil || e.Level == FATAL {
+		flush(e, worker.Writers)
+		return
+	}
+	for _, v := range worker.filter.Filter(e) {
+		flush(v, worker.Writers)
+	}
+}
+
+func flush(e *Event, writers []LogWriter) {
+	var msg string
+	for _, v := range writers {
+		if ew, ok := v.(EventWriter); ok {
+			ew.LogEvent(e)
+			continue
+		}
+		if fw, ok := v.(FieldWriter); ok {
+			fw.LogFields(e.Level, fieldsMessage(e), e.fields())
+			continue
+		}
+		if msg == "" {
+			msg = string(e.Encode(nil, false))
+		}
+		v.Log(e.Level, msg)
 	}
 }
 
+// fieldsMessage encodes the event without its fields, error and ending new line, for a FieldWriter
+func fieldsMessage(e *Event) string {
+	tmp := *e
+	tmp.Fields = nil
+	tmp.Error = nil
+	return strings.TrimSuffix(string(tmp.Encode(nil, false)), "\n")
+}
+
+// TextLine renders the fields after the message as key=value pairs, ending with a new line
+func TextLine(msg string, fields []Field) string {
+	if len(fields) == 0 {
+		return msg + "\n"
+	}
+	var buf bytes.Buffer
+	buf.WriteString(msg)
+	buf.WriteByte(' ')
+	appendText(&buf, fields)
+	buf.WriteByte('\n')
+	return buf.String()
+}
+
 func (this *Logger) Tracef(format string, what ...interface{}) {
 	this.logf(TRACE, format, what...)
 }
@@ -447,6 +698,31 @@ func (this *Logger) Fatalf(format string, what ...interface{}) {
 	this.logf(FATAL, format, what...)
 }
 
+// Tracew logs a message with fields, given as Field values or key/value pairs
+func (this *Logger) Tracew(msg string, keysAndValues ...interface{}) {
+	this.logw(TRACE, msg, keysAndValues)
+}
+
+func (this *Logger) Debugw(msg string, keysAndValues ...interface{}) {
+	this.logw(DEBUG, msg, keysAndValues)
+}
+
+func (this *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	this.logw(INFO, msg, keysAndValues)
+}
+
+func (this *Logger) Warnw(msg string, keysAndValues ...interface{}) {
+	this.logw(WARN, msg, keysAndValues)
+}
+
+func (this *Logger) Errorw(msg string, keysAndValues ...interface{}) {
+	this.logw(ERROR, msg, keysAndValues)
+}
+
+func (this *Logger) Fatalw(msg string, keysAndValues ...interface{}) {
+	this.logw(FATAL, msg, keysAndValues)
+}
+
 func (this *Logger) Trace(a ...interface{}) {
 	this.log(DEBUG, a...)
 }
@@ -0,0 +1,282 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ EventWriter = &NetAppender{}
+
+type framing int
+
+const (
+	// the encoded message is sent as is, eg: a line
+	frameRaw framing = iota
+	// the message, without the trailing new line, is prefixed with its length and a space, as in RFC 6587
+	frameOctetCounting
+	// the message is sent without the trailing new line
+	frameTrimmed
+)
+
+type netOptions struct {
+	encoder      Encoder
+	bufferSize   int
+	dialTimeout  time.Duration
+	writeTimeout time.Duration
+	minDelay     time.Duration
+	maxDelay     time.Duration
+	onError      func(error)
+}
+
+// NetOption configures a NetAppender
+type NetOption func(*netOptions)
+
+// NetEncoder sets the encoder of the events. If nil, the encoder of the worker is used.
+func NetEncoder(encoder Encoder) NetOption {
+	return func(o *netOptions) {
+		o.encoder = encoder
+	}
+}
+
+// NetBufferSize sets the number of messages kept while disconnected, dropping the oldest. Default is 1000.
+func NetBufferSize(size int) NetOption {
+	return func(o *netOptions) {
+		o.bufferSize = size
+	}
+}
+
+// NetDialTimeout sets the timeout of the connection. Default is 1s.
+func NetDialTimeout(d time.Duration) NetOption {
+	return func(o *netOptions) {
+		o.dialTimeout = d
+	}
+}
+
+// NetWriteTimeout sets the timeout of each write. Default is 1s.
+// A write that times out, eg: because the peer stopped reading, is handled as a lost connection,
+// so the message is kept to be sent with a new connection. 0 is no timeout.
+func NetWriteTimeout(d time.Duration) NetOption {
+	return func(o *netOptions) {
+		o.writeTimeout = d
+	}
+}
+
+// NetReconnectDelay sets the delay before reconnecting, doubled after each failure up to max.
+// Default is between 100ms and 30s.
+func NetReconnectDelay(min, max time.Duration) NetOption {
+	return func(o *netOptions) {
+		o.minDelay = min
+		o.maxDelay = max
+	}
+}
+
+// NetOnError sets the function called with the connection and write errors. By default they are written to stderr.
+func NetOnError(fn func(error)) NetOption {
+	return func(o *netOptions) {
+		o.onError = fn
+	}
+}
+
+// NetAppender writes the messages to a network connection: tcp, udp, unix or unixgram.
+//
+// The connection is established on the first message and, if lost, reestablished on a later message,
+// after a delay that grows with each failure.
+// While disconnected, the messages are buffered and then sent when the connection is reestablished.
+// Messages are written synchronously, so it is usually wrapped by an AsyncAppender.
+type NetAppender struct {
+	network string
+	address string
+	framing framing
+	opts    netOptions
+
+	mu     sync.Mutex
+	conn   net.Conn
+	buffer [][]byte
+	// reconnection
+	failures    int
+	nextAttempt time.Time
+	dropped     int
+	// errors to report after releasing the lock
+	errs []error
+}
+
+// NewNetAppender creates a NetAppender sending the encoded messages, one line each, to the address
+func NewNetAppender(network, address string, options ...NetOption) *NetAppender {
+	return newNetAppender(network, address, frameRaw, options)
+}
+
+func newNetAppender(network, address string, framing framing, options []NetOption) *NetAppender {
+	a := &NetAppender{
+		network: network,
+		address: address,
+		framing: framing,
+		opts: netOptions{
+			bufferSize:   1000,
+			dialTimeout:  time.Second,
+			writeTimeout: time.Second,
+			minDelay:     100 * time.Millisecond,
+			maxDelay:     30 * time.Second,
+		},
+	}
+	for _, o := range options {
+		o(&a.opts)
+	}
+	if a.opts.onError == nil {
+		a.opts.onError = func(err error) {
+			fmt.Fprintf(os.Stderr, "log: %s\n", err)
+		}
+	}
+	return a
+}
+
+// Log sends the message as is or, if the appender has an encoder, encoded as an event of the root namespace
+func (a *NetAppender) Log(level LogLevel, msg string) {
+	if a.opts.encoder == nil {
+		a.send([]byte(msg))
+		return
+	}
+	a.LogEvent(&Event{
+		Time:      time.Now(),
+		Level:     level,
+		Namespace: "/",
+		Message:   strings.TrimSuffix(msg, "\n"),
+	})
+}
+
+func (a *NetAppender) LogEvent(e *Event) {
+	a.send(e.Encode(a.opts.encoder, false))
+}
+
+// Discard closes the connection. Buffered messages that could not be sent are lost.
+func (a *NetAppender) Discard() {
+	a.mu.Lock()
+	defer a.unlock()
+
+	if len(a.buffer) > 0 {
+		a.flush(time.Now())
+	}
+	if len(a.buffer) > 0 {
+		a.report(fmt.Errorf("%d log messages to %s were not sent", len(a.buffer), a.address))
+		a.buffer = nil
+	}
+	a.close()
+}
+
+func (a *NetAppender) send(msg []byte) {
+	msg = a.frame(msg)
+
+	a.mu.Lock()
+	defer a.unlock()
+
+	a.buffer = append(a.buffer, msg)
+	if len(a.buffer) > a.opts.bufferSize {
+		a.buffer[0] = nil
+		a.buffer = a.buffer[1:]
+		a.dropped++
+	}
+	a.flush(time.Now())
+}
+
+func (a *NetAppender) frame(msg []byte) []byte {
+	switch a.framing {
+	case frameOctetCounting:
+		msg = bytes.TrimSuffix(msg, []byte("\n"))
+		framed := make([]byte, 0, len(msg)+8)
+		framed = strconv.AppendInt(framed, int64(len(msg)), 10)
+		framed = append(framed, ' ')
+		return append(framed, msg...)
+	case frameTrimmed:
+		return bytes.TrimSuffix(msg, []byte("\n"))
+	default:
+		return msg
+	}
+}
+
+// flush sends the buffered messages, connecting if needed.
+// It must be called with the lock held.
+func (a *NetAppender) flush(now time.Time) {
+	fresh := false
+	for len(a.buffer) > 0 {
+		if a.conn == nil {
+			if now.Before(a.nextAttempt) {
+				return
+			}
+			conn, err := net.DialTimeout(a.network, a.address, a.opts.dialTimeout)
+			if err != nil {
+				a.failed(now, err)
+				return
+			}
+			a.conn = conn
+			a.failures = 0
+			fresh = true
+			if a.dropped > 0 {
+				a.report(fmt.Errorf("%d log messages to %s were dropped while disconnected", a.dropped, a.address))
+				a.dropped = 0
+			}
+		}
+
+		if a.opts.writeTimeout > 0 {
+			a.conn.SetWriteDeadline(time.Now().Add(a.opts.writeTimeout))
+		}
+		if _, err := a.conn.Write(a.buffer[0]); err != nil {
+			a.close()
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				// the peer is not reading, so it waits for the reconnection delay
+				a.failed(now, fmt.Errorf("sending log message to %s: %w", a.address, err))
+				return
+			}
+			if !fresh {
+				// the connection was lost, so the message is sent again with a new one
+				continue
+			}
+			// failing with a new connection, it would always fail, eg: a datagram too large
+			a.report(fmt.Errorf("sending log message to %s: %w", a.address, err))
+		}
+		a.buffer[0] = nil
+		a.buffer = a.buffer[1:]
+	}
+}
+
+// must be called with the lock held
+func (a *NetAppender) failed(now time.Time, err error) {
+	delay := a.opts.minDelay << uint(a.failures)
+	if delay > a.opts.maxDelay || delay <= 0 {
+		delay = a.opts.maxDelay
+	} else {
+		a.failures++
+	}
+	a.nextAttempt = now.Add(delay)
+	a.report(err)
+}
+
+// report records an error to report after releasing the lock,
+// so that the error handler can log, even through this appender.
+// must be called with the lock held
+func (a *NetAppender) report(err error) {
+	a.errs = append(a.errs, err)
+}
+
+// unlock releases the lock and then reports the errors recorded while it was held
+func (a *NetAppender) unlock() {
+	errs := a.errs
+	a.errs = nil
+	a.mu.Unlock()
+
+	for _, err := range errs {
+		a.opts.onError(err)
+	}
+}
+
+// must be called with the lock held
+func (a *NetAppender) close() {
+	if a.conn != nil {
+		a.conn.Close()
+		a.conn = nil
+	}
+}
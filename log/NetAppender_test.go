@@ -0,0 +1,317 @@
+package log
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// acceptLines returns the lines received by the listener
+func acceptLines(t *testing.T, l net.Listener) <-chan string {
+	t.Helper()
+	lines := make(chan string, 100)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	return lines
+}
+
+func receive(t *testing.T, ch <-chan string) string {
+	t.Helper()
+	select {
+	case s := <-ch:
+		return s
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing received")
+		return ""
+	}
+}
+
+type errorCollector struct {
+	mu     sync.Mutex
+	errors []string
+}
+
+func (c *errorCollector) collect(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errors = append(c.errors, err.Error())
+}
+
+func TestNetAppender(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	lines := acceptLines(t, l)
+
+	a := NewNetAppender("tcp", l.Addr().String(), NetEncoder(&LogfmtEncoder{}))
+	defer a.Discard()
+	logger := register(t, "/net", a)
+	defer unregister("/net")
+
+	logger.Infow("hello", "id", 1)
+	assert.Contains(t, receive(t, lines), `level=INFO namespace=/net/ msg=hello id=1`)
+
+	a.Log(WARN, "plain\n")
+	assert.Contains(t, receive(t, lines), `level=WARN namespace=/ msg=plain`)
+}
+
+func TestNetAppenderReconnect(t *testing.T) {
+	// reserves an address with nothing listening
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	errs := &errorCollector{}
+	a := NewNetAppender("tcp", addr,
+		NetBufferSize(2),
+		NetReconnectDelay(time.Millisecond, time.Millisecond),
+		NetOnError(errs.collect),
+	)
+	defer a.Discard()
+
+	a.Log(INFO, "one\n")
+	a.Log(INFO, "two\n")
+	a.Log(INFO, "three\n")
+	errs.mu.Lock()
+	assert.NotEmpty(t, errs.errors)
+	errs.mu.Unlock()
+
+	l, err = net.Listen("tcp", addr)
+	require.NoError(t, err)
+	defer l.Close()
+	lines := acceptLines(t, l)
+	time.Sleep(5 * time.Millisecond)
+
+	a.Log(INFO, "four\n")
+	// the oldest did not fit in the buffer
+	assert.Equal(t, "three", receive(t, lines))
+	assert.Equal(t, "four", receive(t, lines))
+	errs.mu.Lock()
+	assert.Contains(t, errs.errors[len(errs.errors)-1], "2 log messages")
+	errs.mu.Unlock()
+}
+
+func TestNetAppenderOnErrorLogs(t *testing.T) {
+	// reserves an address with nothing listening
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	errs := &errorCollector{}
+	var a *NetAppender
+	a = NewNetAppender("tcp", addr,
+		NetReconnectDelay(time.Hour, time.Hour),
+		NetOnError(func(err error) {
+			errs.collect(err)
+			// logging the error through the same appender must not deadlock
+			a.Log(ERROR, err.Error()+"\n")
+		}),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.Log(INFO, "one\n")
+		a.Discard()
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the error handler to be able to log through the appender")
+	}
+	errs.mu.Lock()
+	defer errs.mu.Unlock()
+	require.Len(t, errs.errors, 2)
+	assert.Contains(t, errs.errors[1], "2 log messages")
+}
+
+func TestNetAppenderWriteTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	// accepts but never reads
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			<-stop
+		}
+	}()
+
+	errs := &errorCollector{}
+	a := NewNetAppender("tcp", l.Addr().String(),
+		NetWriteTimeout(50*time.Millisecond),
+		NetReconnectDelay(time.Hour, time.Hour),
+		NetOnError(errs.collect),
+	)
+	defer a.Discard()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		msg := strings.Repeat("x", 1<<20) + "\n"
+		for i := 0; i < 64; i++ {
+			a.Log(INFO, msg)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the writes to time out")
+	}
+
+	errs.mu.Lock()
+	defer errs.mu.Unlock()
+	require.NotEmpty(t, errs.errors)
+	assert.Contains(t, errs.errors[0], "timeout")
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// the connection is considered lost and the messages are kept
+	assert.Nil(t, a.conn)
+	assert.NotEmpty(t, a.buffer)
+}
+
+func syslogEvent() *Event {
+	return &Event{
+		Time:      time.Date(2020, 3, 4, 10, 20, 30, 123456000, time.UTC),
+		Level:     ERROR,
+		Namespace: "/db",
+		Message:   "query failed",
+		Fields:    []Field{String("sql", `select "x"]`), Int("rows", 0)},
+		Error:     errors.New("timeout"),
+	}
+}
+
+func TestSyslogAppenderUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	a := NewSyslogAppender("udp", conn.LocalAddr().String(), &SyslogEncoder{Facility: Local0, Hostname: "host", AppName: "app"})
+	defer a.Discard()
+	a.LogEvent(syslogEvent())
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	expected := fmt.Sprintf(`<131>1 2020-03-04T10:20:30.123456Z host app %d - `+
+		`[fields@32473 namespace="/db" sql="select \"x\"\]" rows="0" error="timeout"] query failed`, os.Getpid())
+	assert.Equal(t, expected, string(buf[:n]))
+}
+
+func TestSyslogAppenderTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			size, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(size))
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				return
+			}
+			received <- string(msg)
+		}
+	}()
+
+	a := NewSyslogAppender("tcp", l.Addr().String(), &SyslogEncoder{Hostname: "host", AppName: "app"})
+	defer a.Discard()
+	a.Log(DEBUG, "first line\nsecond line\n")
+
+	msg := receive(t, received)
+	assert.True(t, strings.HasPrefix(msg, "<15>1 "), msg)
+	assert.True(t, strings.HasSuffix(msg, `[fields@32473 namespace="/"] first line`+"\nsecond line"), msg)
+}
+
+// parseJournal decodes the native protocol of journald
+func parseJournal(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	fields := map[string]string{}
+	for len(data) > 0 {
+		eol := strings.IndexByte(string(data), '\n')
+		require.True(t, eol > 0)
+		line := string(data[:eol])
+		data = data[eol+1:]
+		if idx := strings.IndexByte(line, '='); idx >= 0 {
+			fields[line[:idx]] = line[idx+1:]
+			continue
+		}
+		size := binary.LittleEndian.Uint64(data[:8])
+		fields[line] = string(data[8 : 8+size])
+		data = data[8+size+1:]
+	}
+	return fields
+}
+
+func TestJournalAppender(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+	socket := filepath.Join(dir, "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	a := NewJournalAppender(socket, &JournalEncoder{Identifier: "app"})
+	defer a.Discard()
+	e := syslogEvent()
+	e.Caller = "db/query.go:42"
+	e.Fields = append(e.Fields, String("multi-line", "a\nb"), Int("_hidden", 1), Int("2nd", 2))
+	a.LogEvent(e)
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"MESSAGE":           "query failed",
+		"PRIORITY":          "3",
+		"SYSLOG_IDENTIFIER": "app",
+		"NAMESPACE":         "/db",
+		"CODE_FILE":         "db/query.go",
+		"CODE_LINE":         "42",
+		"SQL":               `select "x"]`,
+		"ROWS":              "0",
+		"MULTI_LINE":        "a\nb",
+		"HIDDEN":            "1",
+		"F2ND":              "2",
+		"ERROR":             "timeout",
+	}, parseJournal(t, buf[:n]))
+}
@@ -1,58 +1,141 @@
 package log
 
 import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/quintans/toolkit/clock"
 )
 
 var _ LogWriter = &RollingFileAppender{}
 
-func NewRollingFileAppender(file string, size int64, count int, async bool) *RollingFileAppender {
+// Period is the interval of the time based rotation
+type Period int
+
+const (
+	Hourly Period = iota + 1
+	Daily
+)
+
+// start returns the start of the period containing t
+func (p Period) start(t time.Time) time.Time {
+	switch p {
+	case Hourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case Daily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	default:
+		return time.Time{}
+	}
+}
+
+type rollingOptions struct {
+	every        Period
+	compress     bool
+	maxAge       time.Duration
+	maxTotalSize int64
+	onError      func(error)
+	clock        clock.Clock
+}
+
+// RollingOption configures a RollingFileAppender
+type RollingOption func(*rollingOptions)
+
+// RollingEvery rolls the file when the period changes, besides rolling by size
+func RollingEvery(p Period) RollingOption {
+	return func(o *rollingOptions) {
+		o.every = p
+	}
+}
+
+// RollingCompress compresses the rolled files with gzip, adding the .gz extension
+func RollingCompress(compress bool) RollingOption {
+	return func(o *rollingOptions) {
+		o.compress = compress
+	}
+}
+
+// RollingMaxAge removes the rolled files older than the duration
+func RollingMaxAge(d time.Duration) RollingOption {
+	return func(o *rollingOptions) {
+		o.maxAge = d
+	}
+}
+
+// RollingMaxTotalSize removes the oldest rolled files while their total size, in bytes, is over the limit
+func RollingMaxTotalSize(size int64) RollingOption {
+	return func(o *rollingOptions) {
+		o.maxTotalSize = size
+	}
+}
+
+// RollingOnError sets the function called with the I/O errors. By default they are written to stderr.
+// It is called without any lock of the appender held, so it can log through the appender.
+func RollingOnError(fn func(error)) RollingOption {
+	return func(o *rollingOptions) {
+		o.onError = fn
+	}
+}
+
+// RollingClock sets the clock used for the time based rotation and retention
+func RollingClock(c clock.Clock) RollingOption {
+	return func(o *rollingOptions) {
+		o.clock = c
+	}
+}
+
+func NewRollingFileAppender(file string, size int64, count int, async bool, options ...RollingOption) *RollingFileAppender {
 	this := new(RollingFileAppender)
 	//RootAppender uses it this.Writer
 	this.Writer = this
 
-	this.name, this.ext = splitNameExt(file)
+	for _, o := range options {
+		o(&this.opts)
+	}
+	this.opts.clock = clock.OrDefault(this.opts.clock)
+	if this.opts.onError == nil {
+		this.opts.onError = func(err error) {
+			fmt.Fprintf(os.Stderr, "log: %s\n", err)
+		}
+	}
+
+	log, err := filepath.Abs(file)
+	if err != nil {
+		log = file
+	}
+	this.dir = filepath.Dir(log)
+	this.name, this.ext = splitNameExt(filepath.Base(log))
 
 	this.maxsize = size
 	this.count = count
 
 	// finds the last modified file to determine the current backup number
-	log, err := filepath.Abs(file)
-	if err != nil {
-		panic(err)
-	}
-	folder := filepath.Dir(log)
-	var maxtime time.Time
-	var lastName string
-	filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
-		if !info.IsDir() && strings.HasPrefix(info.Name(), this.name) && strings.HasSuffix(info.Name(), "."+this.ext) && info.ModTime().After(maxtime) {
-			maxtime = info.ModTime()
-			lastName = info.Name()
-		}
-		return nil
-	})
-	if lastName != "" {
-		name, _ := splitNameExt(lastName)
-		parts := strings.Split(name, COUNTER_SEP)
-		this.currentCount, err = strconv.Atoi(parts[len(parts)-1])
-		if err != nil {
-			panic(err)
-		}
-		// check size of the current log
-		finfo, err := os.Stat(lastName)
-		if err == nil {
-			this.written = finfo.Size()
+	var last os.FileInfo
+	for _, b := range this.backups(this.opts.onError) {
+		if !b.compressed && (last == nil || b.info.ModTime().After(last.ModTime())) {
+			last = b.info
+			this.currentCount = b.count
 		}
 	}
+	if last != nil {
+		this.written = last.Size()
+		this.period = this.opts.every.start(last.ModTime())
+	} else {
+		this.period = this.opts.every.start(this.opts.clock.Now())
+	}
 	this.currentFilename = this.fullName()
 
 	if async {
-		this.Channel = make(chan string, 10)
-		go AsyncWriter(this.Channel, this)
+		this.startAsync(this)
 	}
 	return this
 }
@@ -68,30 +151,95 @@ func splitNameExt(file string) (string, string) {
 }
 
 /*
-Roll the log file over a range of files once they go over the maxsize.
-If maxsize == 0, then the log file will never rool.
+Roll the log file over a range of files once they go over the maxsize or, if set, when the period changes.
+If maxsize == 0, then the log file will never roll by size.
 If count == 0, then the backup log files will be infinite.
-The format of the backup log files will be <name>-<counter>.<extension>
+The format of the backup log files will be <name>-<counter>.<extension>, with the .gz extension if compressed.
 */
 type RollingFileAppender struct {
 	RootAppender
+	opts rollingOptions
+
+	// guards the fields below, since Write is called concurrently in sync mode
+	// and by the draining of the channel in async mode
+	mu              sync.Mutex
+	dir             string
 	name            string
 	ext             string
 	currentFilename string
+	file            *os.File
 	maxsize         int64
 	written         int64
 	count           int
 	currentCount    int
+	// start of the current period of the time based rotation
+	period time.Time
+	// after being discarded, each write opens and closes the file
+	closed bool
+	// errors to report after releasing the lock
+	errs []error
+	// compression and retention of the rolled files
+	housekeeping sync.WaitGroup
+}
+
+// fail records an error to report after releasing the lock.
+// must be called with the lock held
+func (this *RollingFileAppender) fail(err error) {
+	this.errs = append(this.errs, err)
+}
+
+// unlock releases the lock and then reports the errors recorded while it was held
+func (this *RollingFileAppender) unlock() {
+	errs := this.errs
+	this.errs = nil
+	this.mu.Unlock()
+
+	for _, err := range errs {
+		this.opts.onError(err)
+	}
 }
 
-func (this *RollingFileAppender) rollFile() {
+// must be called with the lock held
+func (this *RollingFileAppender) rollFile(now time.Time) {
+	this.closeFile()
+	rolled := this.currentFilename
+
 	this.written = 0
 	this.currentCount++
 	if this.currentCount == this.count {
 		this.currentCount = 0
 	}
 	this.currentFilename = this.fullName()
-	os.Remove(this.currentFilename)
+	this.period = this.opts.every.start(now)
+
+	// the previous housekeeping may be using the next file.
+	// It reports its errors after being done, so it does not wait for the lock.
+	this.housekeeping.Wait()
+	for _, f := range []string{this.currentFilename, this.currentFilename + ".gz"} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			this.fail(err)
+		}
+	}
+
+	current := this.currentFilename
+	this.housekeeping.Add(1)
+	go func() {
+		var errs []error
+		onError := func(err error) {
+			errs = append(errs, err)
+		}
+		if this.opts.compress {
+			if err := compress(rolled); err != nil {
+				onError(err)
+			}
+		}
+		this.retain(now, current, onError)
+		this.housekeeping.Done()
+
+		for _, err := range errs {
+			this.opts.onError(err)
+		}
+	}()
 }
 
 func (this *RollingFileAppender) fullName() string {
@@ -99,31 +247,177 @@ func (this *RollingFileAppender) fullName() string {
 	if this.ext != "" {
 		name += "." + this.ext
 	}
-	return name
+	return filepath.Join(this.dir, name)
+}
+
+// must be called with the lock held
+func (this *RollingFileAppender) closeFile() {
+	if this.file != nil {
+		if err := this.file.Close(); err != nil {
+			this.fail(err)
+		}
+		this.file = nil
+	}
 }
 
 func (this *RollingFileAppender) Write(p []byte) (n int, err error) {
-	if this.maxsize > 0 && this.written > this.maxsize {
-		this.rollFile()
+	this.mu.Lock()
+	defer this.unlock()
+
+	now := this.opts.clock.Now()
+	if (this.maxsize > 0 && this.written > this.maxsize) ||
+		(this.opts.every != 0 && !this.opts.every.start(now).Equal(this.period)) {
+		this.rollFile(now)
 	}
 
-	fo, err := os.OpenFile(this.currentFilename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if this.file == nil {
+		this.file, err = os.OpenFile(this.currentFilename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			this.fail(err)
+			return 0, err
+		}
+	}
+
+	n, err = this.file.Write(p)
+	this.written += int64(n)
 	if err != nil {
-		panic(err)
+		this.fail(err)
+	}
+	if this.closed {
+		this.closeFile()
 	}
-	defer func() {
-		if err := fo.Close(); err != nil {
-			panic(err)
+	return n, err
+}
+
+// Discard writes the queued messages and closes the file, waiting for the compression of the rolled files.
+// Later writes still reach the file, opening and closing it each time.
+func (this *RollingFileAppender) Discard() {
+	this.RootAppender.Discard()
+
+	this.mu.Lock()
+	this.closed = true
+	this.closeFile()
+	this.unlock()
+
+	this.housekeeping.Wait()
+}
+
+type backup struct {
+	path       string
+	info       os.FileInfo
+	count      int
+	compressed bool
+}
+
+// backups returns the files of the appender, including the current one
+func (this *RollingFileAppender) backups(onError func(error)) []backup {
+	files, err := ioutil.ReadDir(this.dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			onError(err)
 		}
-	}()
+		return nil
+	}
+	var backups []backup
+	prefix := this.name + COUNTER_SEP
+	suffix := ""
+	if this.ext != "" {
+		suffix = "." + this.ext
+	}
+	for _, info := range files {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		b := backup{
+			path: filepath.Join(this.dir, name),
+			info: info,
+		}
+		if strings.HasSuffix(name, ".gz") {
+			b.compressed = true
+			name = strings.TrimSuffix(name, ".gz")
+		}
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		b.count, err = strconv.Atoi(name[len(prefix) : len(name)-len(suffix)])
+		if err != nil {
+			continue
+		}
+		backups = append(backups, b)
+	}
+	return backups
+}
+
+// retain removes the rolled files over the age and total size limits
+func (this *RollingFileAppender) retain(now time.Time, current string, onError func(error)) {
+	if this.opts.maxAge <= 0 && this.opts.maxTotalSize <= 0 {
+		return
+	}
+
+	var backups []backup
+	for _, b := range this.backups(onError) {
+		if b.path != current {
+			backups = append(backups, b)
+		}
+	}
+	// newest first
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].info.ModTime().After(backups[j].info.ModTime())
+	})
+
+	var total int64
+	for _, b := range backups {
+		total += b.info.Size()
+		expired := this.opts.maxAge > 0 && now.Sub(b.info.ModTime()) > this.opts.maxAge
+		oversized := this.opts.maxTotalSize > 0 && total > this.opts.maxTotalSize
+		if expired || oversized {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				onError(err)
+			}
+		}
+	}
+}
+
+// compress replaces the file by its gzip version
+func compress(file string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer in.Close()
 
-	n, err = fo.Write(p)
-	if this.maxsize > 0 {
-		this.written += int64(n)
+	info, err := in.Stat()
+	if err != nil {
+		return err
 	}
+
+	tmp := file + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
 	if err != nil {
-		panic(err)
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err == nil {
+		err = gz.Close()
+	}
+	if errClose := out.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("compressing %s: %w", file, err)
 	}
 
-	return n, nil
+	// keeps the modification time for the retention
+	os.Chtimes(tmp, info.ModTime(), info.ModTime())
+	if err := os.Rename(tmp, file+".gz"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	in.Close()
+	return os.Remove(file)
 }
@@ -0,0 +1,228 @@
+package log
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quintans/toolkit/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "rolling")
+	require.NoError(t, err)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func gunzip(t *testing.T, file string) string {
+	t.Helper()
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestRollingBySize(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	a := NewRollingFileAppender(filepath.Join(dir, "app.log"), 5, 3, false)
+	for _, msg := range []string{"one\n", "two\n", "three\n", "four\n"} {
+		a.Log(INFO, msg)
+	}
+	a.Discard()
+
+	assert.Equal(t, []string{"app-0.log", "app-1.log", "app-2.log"}, listDir(t, dir))
+	assert.Equal(t, "one\ntwo\n", readFile(t, filepath.Join(dir, "app-0.log")))
+	assert.Equal(t, "three\n", readFile(t, filepath.Join(dir, "app-1.log")))
+	assert.Equal(t, "four\n", readFile(t, filepath.Join(dir, "app-2.log")))
+
+	// restarting continues the last modified file
+	mtime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "app-2.log"), mtime, mtime))
+	a = NewRollingFileAppender(filepath.Join(dir, "app.log"), 5, 3, false)
+	a.Log(INFO, "five\n")
+	a.Log(INFO, "six\n")
+	a.Discard()
+	assert.Equal(t, "four\nfive\n", readFile(t, filepath.Join(dir, "app-2.log")))
+	assert.Equal(t, "six\n", readFile(t, filepath.Join(dir, "app-0.log")))
+}
+
+func TestRollingByTimeCompressed(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	clk := clock.NewFake(time.Date(2020, 1, 1, 10, 0, 0, 0, time.Local))
+	a := NewRollingFileAppender(filepath.Join(dir, "app.log"), 0, 0, false,
+		RollingEvery(Daily),
+		RollingCompress(true),
+		RollingClock(clk),
+	)
+	a.Log(INFO, "day 1\n")
+	clk.Advance(time.Hour)
+	a.Log(INFO, "day 1 again\n")
+	clk.Advance(24 * time.Hour)
+	a.Log(INFO, "day 2\n")
+	a.Discard()
+
+	assert.Equal(t, []string{"app-0.log.gz", "app-1.log"}, listDir(t, dir))
+	assert.Equal(t, "day 1\nday 1 again\n", gunzip(t, filepath.Join(dir, "app-0.log.gz")))
+	assert.Equal(t, "day 2\n", readFile(t, filepath.Join(dir, "app-1.log")))
+}
+
+func TestRollingRetention(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	for k, content := range []string{"expired", "oversized", "kept"} {
+		file := filepath.Join(dir, "app-"+string(rune('3'+k))+".log")
+		writeFile(t, file, content)
+		// older files first
+		mtime := now.Add(time.Duration(k-3) * time.Minute)
+		if k == 0 {
+			mtime = old
+		}
+		require.NoError(t, os.Chtimes(file, mtime, mtime))
+	}
+
+	a := NewRollingFileAppender(filepath.Join(dir, "app.log"), 5, 0, false,
+		RollingMaxAge(24*time.Hour),
+		RollingMaxTotalSize(12),
+	)
+	// continues app-5.log, the newest
+	a.Log(INFO, "rolls\n")
+	a.Log(INFO, "new\n")
+	a.Discard()
+
+	assert.Equal(t, []string{"app-5.log", "app-6.log"}, listDir(t, dir))
+	assert.Equal(t, "keptrolls\n", readFile(t, filepath.Join(dir, "app-5.log")))
+	assert.Equal(t, "new\n", readFile(t, filepath.Join(dir, "app-6.log")))
+}
+
+func TestRollingErrors(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	var mu sync.Mutex
+	var errs []error
+	a := NewRollingFileAppender(filepath.Join(dir, "missing", "app.log"), 0, 0, false,
+		RollingOnError(func(err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}),
+	)
+	assert.NotPanics(t, func() {
+		a.Log(INFO, "lost\n")
+	})
+	a.Discard()
+	require.Len(t, errs, 1)
+	assert.True(t, os.IsNotExist(errs[0]))
+}
+
+func TestRollingErrorsLogged(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	var a *RollingFileAppender
+	var reported int32
+	a = NewRollingFileAppender(filepath.Join(dir, "app.log"), 5, 3, false,
+		RollingOnError(func(err error) {
+			// logging through the appender does not deadlock
+			if atomic.AddInt32(&reported, 1) == 1 {
+				a.Log(ERROR, "rolling failed\n")
+			}
+		}),
+	)
+	// a directory in place of the next file makes the roll fail
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "app-1.log", "x"), 0755))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, msg := range []string{"one\n", "two two\n", "three\n"} {
+			a.Log(INFO, msg)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the errors to be reported without the lock held")
+	}
+	a.Discard()
+	assert.True(t, atomic.LoadInt32(&reported) > 1)
+}
+
+func TestRollingWriteAfterDiscard(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	a := NewRollingFileAppender(filepath.Join(dir, "app.log"), 0, 0, false)
+	a.Log(INFO, "one\n")
+	a.Discard()
+
+	a.Log(INFO, "late\n")
+	assert.Equal(t, "one\nlate\n", readFile(t, filepath.Join(dir, "app-0.log")))
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	assert.Nil(t, a.file, "Expected the file to be closed")
+}
+
+func TestRollingAsyncConcurrent(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	a := NewRollingFileAppender(filepath.Join(dir, "app.log"), 100, 0, true, RollingCompress(true))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				a.Log(INFO, "0123456789\n")
+			}
+			// FATAL drains the channel in the calling goroutine
+			a.Log(FATAL, "fatal\n")
+		}()
+	}
+	wg.Wait()
+	a.Discard()
+
+	var total int
+	for _, name := range listDir(t, dir) {
+		file := filepath.Join(dir, name)
+		if filepath.Ext(name) == ".gz" {
+			total += len(gunzip(t, file))
+		} else {
+			total += len(readFile(t, file))
+		}
+	}
+	assert.Equal(t, 4*(50*11+6), total)
+}
@@ -1,12 +1,23 @@
 package log
 
 import (
+	"bytes"
 	"io"
+	"sync"
 )
 
 type RootAppender struct {
 	io.Writer
 	Channel chan string
+	// Encoder encodes the events. If nil, the encoder of the worker is used.
+	Encoder Encoder
+	// Color enables colors in the encoded events, for terminal output
+	Color bool
+
+	mu        sync.RWMutex
+	discarded bool
+	// closed when the async writer has written all the messages of the channel
+	drained chan struct{}
 }
 
 func AsyncWriter(ch chan string, writer io.Writer) {
@@ -15,12 +26,29 @@ func AsyncWriter(ch chan string, writer io.Writer) {
 	}
 }
 
+// startAsync creates the channel and starts writing its messages to the writer
+func (this *RootAppender) startAsync(writer io.Writer) {
+	this.Channel = make(chan string, 10)
+	this.drained = make(chan struct{})
+	go func() {
+		AsyncWriter(this.Channel, writer)
+		close(this.drained)
+	}()
+}
+
 func (this *RootAppender) Log(msgLevel LogLevel, msg string) {
 	if this.Channel != nil {
-		if msgLevel == FATAL {
+		this.mu.RLock()
+		if this.discarded {
+			this.mu.RUnlock()
+			// late messages are written after the ones still in the channel
+			this.waitDrained()
+		} else if msgLevel == FATAL {
 			this.DrainChannel()
+			this.mu.RUnlock()
 		} else {
 			this.Channel <- msg
+			this.mu.RUnlock()
 			return
 		}
 	}
@@ -29,16 +57,53 @@ func (this *RootAppender) Log(msgLevel LogLevel, msg string) {
 
 }
 
+func (this *RootAppender) LogEvent(e *Event) {
+	this.Log(e.Level, string(e.Encode(this.Encoder, this.Color)))
+}
+
+// LogBatch writes the events with a single write
+func (this *RootAppender) LogBatch(events []*Event) {
+	if this.Channel != nil {
+		for _, e := range events {
+			this.LogEvent(e)
+		}
+		return
+	}
+
+	var buf bytes.Buffer
+	for _, e := range events {
+		buf.Write(e.Encode(this.Encoder, this.Color))
+	}
+	this.Write(buf.Bytes())
+}
+
+// Discard stops the asynchronous writing, returning after all the queued messages are written
 func (this *RootAppender) Discard() {
 	if this.Channel != nil {
-		close(this.Channel)
+		this.mu.Lock()
+		if !this.discarded {
+			this.discarded = true
+			close(this.Channel)
+		}
+		this.mu.Unlock()
+		this.waitDrained()
+	}
+}
+
+func (this *RootAppender) waitDrained() {
+	// drained is nil if the channel was not created by startAsync
+	if this.drained != nil {
+		<-this.drained
 	}
 }
 
 func (this *RootAppender) DrainChannel() {
 	for {
 		select {
-		case msg := <-this.Channel:
+		case msg, ok := <-this.Channel:
+			if !ok {
+				return
+			}
 			this.Write([]byte(msg))
 		default:
 			return
@@ -0,0 +1,191 @@
+package log
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/quintans/toolkit/faults"
+)
+
+var _ Encoder = &SyslogEncoder{}
+
+// Facility is the syslog facility of the messages
+type Facility int
+
+const (
+	// Kern is not used by user processes, so the zero value of Facility means User
+	Kern Facility = iota
+	User
+	Mail
+	Daemon
+	Auth
+	Syslog
+	Lpr
+	News
+	Uucp
+	Cron
+	AuthPriv
+	Ftp
+	_
+	_
+	_
+	_
+	Local0
+	Local1
+	Local2
+	Local3
+	Local4
+	Local5
+	Local6
+	Local7
+)
+
+// syslogSeverity maps the level to the syslog severity
+func syslogSeverity(level LogLevel) int {
+	switch level {
+	case FATAL:
+		// critical
+		return 2
+	case ERROR:
+		return 3
+	case WARN:
+		return 4
+	case INFO:
+		return 6
+	default:
+		// debug
+		return 7
+	}
+}
+
+// SyslogEncoder encodes an event as a RFC 5424 syslog message:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID - [fields@ENTERPRISE-ID namespace=".." caller=".." key="value"...] MESSAGE
+// with the stack of the error, if any, after the message.
+type SyslogEncoder struct {
+	// Facility is the syslog facility. Default is User.
+	Facility Facility
+	// Hostname defaults to the host name
+	Hostname string
+	// AppName defaults to the name of the executable
+	AppName string
+	// EnterpriseID identifies the structured data element with the fields. Default is 32473, reserved for documentation.
+	EnterpriseID string
+}
+
+func (enc *SyslogEncoder) Encode(buf *bytes.Buffer, e *Event, color bool) {
+	facility := enc.Facility
+	if facility == Kern {
+		facility = User
+	}
+	buf.WriteByte('<')
+	buf.WriteString(strconv.Itoa(int(facility)*8 + syslogSeverity(e.Level)))
+	buf.WriteString(">1 ")
+	buf.WriteString(e.Time.Format("2006-01-02T15:04:05.000000Z07:00"))
+	buf.WriteByte(' ')
+	hostname := enc.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	writeSyslogHeader(buf, hostname, 255)
+	buf.WriteByte(' ')
+	appName := enc.AppName
+	if appName == "" {
+		appName = filepath.Base(os.Args[0])
+	}
+	writeSyslogHeader(buf, appName, 48)
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.Itoa(os.Getpid()))
+	// no MSGID
+	buf.WriteString(" - [fields@")
+	id := enc.EnterpriseID
+	if id == "" {
+		id = "32473"
+	}
+	buf.WriteString(id)
+	writeSyslogParam(buf, "namespace", e.Namespace)
+	if e.Caller != "" {
+		writeSyslogParam(buf, "caller", e.Caller)
+	}
+	for _, f := range e.Fields {
+		writeSyslogParam(buf, f.Key, f.text())
+	}
+	if e.Error != nil {
+		writeSyslogParam(buf, "error", faults.Error(e.Error))
+	}
+	buf.WriteString("] ")
+	buf.WriteString(e.Message)
+	if e.Error != nil {
+		if stack := errorStack(e.Error); stack != "" {
+			buf.WriteByte('\n')
+			buf.WriteString(stack)
+		}
+	}
+	buf.WriteByte('\n')
+}
+
+// writeSyslogHeader writes a header field, that can only have printable ASCII characters
+func writeSyslogHeader(buf *bytes.Buffer, s string, max int) {
+	if s == "" {
+		buf.WriteByte('-')
+		return
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c > ' ' && c < 0x7f {
+			buf.WriteByte(c)
+		} else {
+			buf.WriteByte('_')
+		}
+	}
+}
+
+// writeSyslogParam writes a structured data parameter, replacing the invalid characters of the name
+// and escaping '"', '\' and ']' in the value
+func writeSyslogParam(buf *bytes.Buffer, name, value string) {
+	buf.WriteByte(' ')
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	if name == "" {
+		buf.WriteByte('_')
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c > ' ' && c < 0x7f && c != '=' && c != ']' && c != '"' {
+			buf.WriteByte(c)
+		} else {
+			buf.WriteByte('_')
+		}
+	}
+	buf.WriteString(`="`)
+	for _, r := range value {
+		if r == '"' || r == '\\' || r == ']' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(r)
+	}
+	buf.WriteByte('"')
+}
+
+// NewSyslogAppender creates a NetAppender sending RFC 5424 messages to a syslog server.
+// The network is one of: tcp, udp, unix or unixgram. With tcp and unix, the messages are framed by octet counting (RFC 6587).
+// If the network and address are empty, the messages are sent to the local syslog, at /dev/log.
+// If the encoder is nil, a SyslogEncoder with the default values is used.
+func NewSyslogAppender(network, address string, encoder *SyslogEncoder, options ...NetOption) *NetAppender {
+	if network == "" && address == "" {
+		network, address = "unixgram", "/dev/log"
+	}
+	if encoder == nil {
+		encoder = &SyslogEncoder{}
+	}
+	framing := frameTrimmed
+	if strings.HasPrefix(network, "tcp") || network == "unix" {
+		framing = frameOctetCounting
+	}
+	options = append([]NetOption{NetEncoder(encoder)}, options...)
+	return newNetAppender(network, address, framing, options)
+}
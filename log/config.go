@@ -0,0 +1,428 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	tk "github.com/quintans/toolkit"
+)
+
+// Config is the declarative configuration of the log.
+//
+// eg:
+//
+//	{
+//		"appenders": {
+//			"console": {"type": "console"},
+//			"file": {"type": "rolling", "file": "app.log", "maxSize": 10485760, "count": 5, "async": true, "encoder": "json"}
+//		},
+//		"namespaces": [
+//			{"namespace": "/", "level": "INFO", "appenders": ["console", "file"]},
+//			{"namespace": "/db", "level": "DEBUG", "showCaller": true}
+//		]
+//	}
+type Config struct {
+	Appenders  map[string]AppenderConfig `json:"appenders"`
+	Namespaces []NamespaceConfig         `json:"namespaces"`
+}
+
+// AppenderConfig configures an appender
+type AppenderConfig struct {
+	// Type is one of: console, file, rolling, net, syslog, journal, null
+	Type string `json:"type"`
+	// Async writes the messages in a separate goroutine, with an AsyncAppender
+	Async bool `json:"async"`
+	// BufferSize is the number of messages waiting to be written by the async appender
+	BufferSize int `json:"bufferSize"`
+	// Overflow is what the async appender does when the buffer is full: block, dropNewest or dropOldest
+	Overflow string `json:"overflow"`
+	// Encoder is one of: text, json, logfmt. If empty, the encoder of the worker is used. Ignored by syslog and journal.
+	Encoder string `json:"encoder"`
+	// File is the log file of the file and rolling appenders
+	File string `json:"file"`
+	// MaxSize is the size, in bytes, at which the file is reset or rolled. 0 is no limit.
+	MaxSize int64 `json:"maxSize"`
+	// Count is the number of files of the rolling appender
+	Count int `json:"count"`
+	// Reset removes the file of the file appender on startup
+	Reset bool `json:"reset"`
+	// Every is the period of the time based rotation of the rolling appender: hourly or daily
+	Every string `json:"every"`
+	// Compress compresses the rolled files of the rolling appender
+	Compress bool `json:"compress"`
+	// MaxAge is the age of the rolled files after which they are removed, eg: 168h
+	MaxAge string `json:"maxAge"`
+	// MaxTotalSize is the total size, in bytes, of the rolled files after which the oldest are removed
+	MaxTotalSize int64 `json:"maxTotalSize"`
+	// Network of the net and syslog appenders: tcp, udp, unix or unixgram
+	Network string `json:"network"`
+	// Address of the net and syslog appenders, or the socket of the journal appender
+	Address string `json:"address"`
+}
+
+// NamespaceConfig configures the worker of a namespace
+type NamespaceConfig struct {
+	Namespace string `json:"namespace"`
+	Level     string `json:"level"`
+	// Appenders are the names of the appenders. If empty, the appenders of the parent namespace are used.
+	Appenders []string `json:"appenders"`
+	// TimeFormat is the time format of the text encoding, eg: %Y-%02M-%02D %02h:%02m:%02s.%03x
+	TimeFormat *string `json:"timeFormat"`
+	ShowLevel  *bool   `json:"showLevel"`
+	ShowCaller bool    `json:"showCaller"`
+	// Encoder is one of: text, json, logfmt
+	Encoder string `json:"encoder"`
+	// Dedup is the window, eg: 10s, in which repeated messages are suppressed
+	Dedup    string          `json:"dedup"`
+	Sampling *SamplingConfig `json:"sampling"`
+	// RateLimits is the maximum number of messages per second of each level, eg: {"ERROR": 10}.
+	// Bursts of up to that number of messages are allowed.
+	RateLimits map[string]int64 `json:"rateLimits"`
+}
+
+// SamplingConfig writes, in each interval, the first messages of each level and then 1 in every Thereafter messages
+type SamplingConfig struct {
+	// Interval eg: 1s
+	Interval   string `json:"interval"`
+	First      int    `json:"first"`
+	Thereafter int    `json:"thereafter"`
+	// PerCallSite counts the messages of each call site apart
+	PerCallSite bool `json:"perCallSite"`
+}
+
+// configured holds what was created by the last applied configuration
+var configured = struct {
+	sync.Mutex
+	appenders  map[string]configuredAppender
+	namespaces map[string]bool
+}{}
+
+type configuredAppender struct {
+	config AppenderConfig
+	writer LogWriter
+}
+
+// LoadConfig reads a JSON configuration file
+func LoadConfig(file string) (*Config, error) {
+	if _, err := os.Stat(file); err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := tk.LoadConfiguration(cfg, file, false); err != nil {
+		return nil, fmt.Errorf("reading log configuration '%s': %w", file, err)
+	}
+	return cfg, nil
+}
+
+// ConfigureFile applies the configuration of a JSON file
+func ConfigureFile(file string) error {
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		return err
+	}
+	return Configure(cfg)
+}
+
+// Configure applies the configuration, replacing the one applied before.
+//
+// Appenders whose configuration did not change are kept, others are discarded after all their queued messages are written.
+// Namespaces from the previous configuration that are not in this one are removed.
+// Nothing changes if the configuration is invalid.
+func Configure(cfg *Config) error {
+	configured.Lock()
+	defer configured.Unlock()
+
+	// validate everything before changing anything
+	for name, ac := range cfg.Appenders {
+		if _, err := parseEncoder(ac.Encoder); err != nil {
+			return fmt.Errorf("appender '%s': %w", name, err)
+		}
+		if _, err := asyncOptionsOf(ac); err != nil {
+			return fmt.Errorf("appender '%s': %w", name, err)
+		}
+		switch ac.Type {
+		case "console", "null", "syslog", "journal":
+		case "net":
+			if ac.Network == "" || ac.Address == "" {
+				return fmt.Errorf("appender '%s': missing network or address", name)
+			}
+		case "file", "rolling":
+			if ac.File == "" {
+				return fmt.Errorf("appender '%s': missing file", name)
+			}
+			if _, err := rollingOptionsOf(ac); err != nil {
+				return fmt.Errorf("appender '%s': %w", name, err)
+			}
+		default:
+			return fmt.Errorf("appender '%s': unknown type '%s'", name, ac.Type)
+		}
+	}
+	namespaces := make([]NamespaceConfig, len(cfg.Namespaces))
+	seen := map[string]bool{}
+	for k, nc := range cfg.Namespaces {
+		nc.Namespace = normalizeNamespace(nc.Namespace)
+		if seen[nc.Namespace] {
+			return fmt.Errorf("namespace '%s': duplicated", nc.Namespace)
+		}
+		seen[nc.Namespace] = true
+		if ParseLevel(nc.Level, -1) < 0 {
+			return fmt.Errorf("namespace '%s': invalid level '%s'", nc.Namespace, nc.Level)
+		}
+		if _, err := parseEncoder(nc.Encoder); err != nil {
+			return fmt.Errorf("namespace '%s': %w", nc.Namespace, err)
+		}
+		if _, err := filterOf(nc); err != nil {
+			return fmt.Errorf("namespace '%s': %w", nc.Namespace, err)
+		}
+		for _, a := range nc.Appenders {
+			if _, ok := cfg.Appenders[a]; !ok {
+				return fmt.Errorf("namespace '%s': unknown appender '%s'", nc.Namespace, a)
+			}
+		}
+		namespaces[k] = nc
+	}
+	// parents first, so that the children can inherit their appenders
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Namespace < namespaces[j].Namespace
+	})
+
+	appenders := map[string]configuredAppender{}
+	for name, ac := range cfg.Appenders {
+		if old, ok := configured.appenders[name]; ok && reflect.DeepEqual(old.config, ac) {
+			appenders[name] = old
+			continue
+		}
+		appenders[name] = configuredAppender{
+			config: ac,
+			writer: newAppender(ac),
+		}
+	}
+
+	logMaster.mu.Lock()
+	// removed first, so that they are not inherited
+	for ns := range configured.namespaces {
+		// the root worker can not be removed
+		if !seen[ns] && ns != "/" {
+			logMaster.removeWorker(ns)
+		}
+	}
+	for _, nc := range namespaces {
+		writers := make([]LogWriter, len(nc.Appenders))
+		for k, a := range nc.Appenders {
+			writers[k] = appenders[a].writer
+		}
+		worker := newWorker(nc.Namespace, ParseLevel(nc.Level, -1), writers)
+		if len(writers) == 0 {
+			worker.Writers = logMaster.findWorker(nc.Namespace).Writers
+			worker.inherited = true
+		}
+		if nc.TimeFormat != nil {
+			worker.SetTimeFormat(*nc.TimeFormat)
+		}
+		if nc.ShowLevel != nil {
+			worker.ShowLevel(*nc.ShowLevel)
+		}
+		worker.ShowCaller(nc.ShowCaller)
+		encoder, _ := parseEncoder(nc.Encoder)
+		worker.SetEncoder(encoder)
+		filter, _ := filterOf(nc)
+		worker.SetFilter(filter)
+		logMaster.putWorker(worker)
+	}
+	logMaster.mu.Unlock()
+
+	// the replaced appenders are no longer used by the workers
+	for name, old := range configured.appenders {
+		if a, ok := appenders[name]; !ok || a.writer != old.writer {
+			old.writer.Discard()
+		}
+	}
+
+	configured.appenders = appenders
+	configured.namespaces = seen
+	return nil
+}
+
+func parseEncoder(name string) (Encoder, error) {
+	switch name {
+	case "", "text":
+		return nil, nil
+	case "json":
+		return &JSONEncoder{}, nil
+	case "logfmt":
+		return &LogfmtEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("unknown encoder '%s'", name)
+	}
+}
+
+// newAppender creates the appender of a validated configuration
+func newAppender(ac AppenderConfig) LogWriter {
+	var root *RootAppender
+	var writer LogWriter
+	switch ac.Type {
+	case "console":
+		a := NewConsoleAppender(false)
+		root, writer = &a.RootAppender, a
+	case "file":
+		a := NewFileAppender(ac.File, ac.MaxSize, ac.Reset, false)
+		root, writer = &a.RootAppender, a
+	case "rolling":
+		options, _ := rollingOptionsOf(ac)
+		a := NewRollingFileAppender(ac.File, ac.MaxSize, ac.Count, false, options...)
+		root, writer = &a.RootAppender, a
+	case "net":
+		encoder, _ := parseEncoder(ac.Encoder)
+		writer = NewNetAppender(ac.Network, ac.Address, NetEncoder(encoder))
+	case "syslog":
+		writer = NewSyslogAppender(ac.Network, ac.Address, nil)
+	case "journal":
+		writer = NewJournalAppender(ac.Address, nil)
+	default:
+		return NewNullAppender()
+	}
+	if root != nil {
+		root.Encoder, _ = parseEncoder(ac.Encoder)
+	}
+	if ac.Async {
+		options, _ := asyncOptionsOf(ac)
+		return NewAsyncAppender(writer, options...)
+	}
+	return writer
+}
+
+func asyncOptionsOf(ac AppenderConfig) ([]AsyncOption, error) {
+	var options []AsyncOption
+	switch ac.Overflow {
+	case "", "block":
+	case "dropNewest":
+		options = append(options, AsyncOverflow(DropNewest))
+	case "dropOldest":
+		options = append(options, AsyncOverflow(DropOldest))
+	default:
+		return nil, fmt.Errorf("invalid overflow '%s'", ac.Overflow)
+	}
+	if ac.BufferSize > 0 {
+		options = append(options, AsyncBufferSize(ac.BufferSize))
+	}
+	return options, nil
+}
+
+func rollingOptionsOf(ac AppenderConfig) ([]RollingOption, error) {
+	var options []RollingOption
+	switch ac.Every {
+	case "":
+	case "hourly":
+		options = append(options, RollingEvery(Hourly))
+	case "daily":
+		options = append(options, RollingEvery(Daily))
+	default:
+		return nil, fmt.Errorf("invalid period '%s'", ac.Every)
+	}
+	if ac.MaxAge != "" {
+		d, err := time.ParseDuration(ac.MaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max age '%s'", ac.MaxAge)
+		}
+		options = append(options, RollingMaxAge(d))
+	}
+	options = append(options, RollingCompress(ac.Compress), RollingMaxTotalSize(ac.MaxTotalSize))
+	return options, nil
+}
+
+// filterOf returns the filter of the namespace, nil if none.
+// Repeated messages are suppressed before being sampled, and sampled before being rate limited.
+func filterOf(nc NamespaceConfig) (Filter, error) {
+	var chain FilterChain
+	if nc.Dedup != "" {
+		d, err := time.ParseDuration(nc.Dedup)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dedup window '%s'", nc.Dedup)
+		}
+		chain = append(chain, NewDeduplicator(d))
+	}
+	if sc := nc.Sampling; sc != nil {
+		d, err := time.ParseDuration(sc.Interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid sampling interval '%s'", sc.Interval)
+		}
+		var options []FilterOption
+		if sc.PerCallSite {
+			options = append(options, FilterPerCallSite())
+		}
+		chain = append(chain, NewSampler(d, sc.First, sc.Thereafter, options...))
+	}
+	if len(nc.RateLimits) > 0 {
+		rates := map[LogLevel]int64{}
+		for name, rate := range nc.RateLimits {
+			level := ParseLevel(name, -1)
+			if level < 0 {
+				return nil, fmt.Errorf("invalid rate limit level '%s'", name)
+			}
+			rates[level] = rate
+		}
+		chain = append(chain, NewRateLimit(rates))
+	}
+	switch len(chain) {
+	case 0:
+		return nil, nil
+	case 1:
+		return chain[0], nil
+	default:
+		return chain, nil
+	}
+}
+
+// WatchConfig applies the configuration of a JSON file and re-applies it whenever the file changes,
+// checking it at every interval.
+// Errors reading or applying a changed file are passed to onError, if not nil, and the current configuration is kept.
+// It returns a function to stop watching.
+func WatchConfig(file string, interval time.Duration, onError func(error)) (func(), error) {
+	stat, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := ConfigureFile(file); err != nil {
+		return nil, err
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		modTime, size := stat.ModTime(), stat.Size()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			stat, err := os.Stat(file)
+			if err != nil {
+				// the file may be being replaced
+				continue
+			}
+			if stat.ModTime().Equal(modTime) && stat.Size() == size {
+				continue
+			}
+			modTime, size = stat.ModTime(), stat.Size()
+			if err := ConfigureFile(file); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+		})
+	}, nil
+}
@@ -0,0 +1,167 @@
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, file, content string) {
+	t.Helper()
+	require.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+}
+
+func readFile(t *testing.T, file string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestConfigure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logFile := filepath.Join(dir, "app.log")
+	err = Configure(&Config{
+		Appenders: map[string]AppenderConfig{
+			"file": {Type: "file", File: logFile, Async: true, Encoder: "logfmt"},
+		},
+		Namespaces: []NamespaceConfig{
+			{Namespace: "/cfg/child", Level: "WARN"},
+			{Namespace: "/cfg", Level: "INFO", Appenders: []string{"file"}},
+		},
+	})
+	require.NoError(t, err)
+
+	LoggerFor("/cfg").Debug("filtered")
+	LoggerFor("/cfg").Infow("parent", "a", 1)
+	LoggerFor("/cfg/child").Info("filtered")
+	LoggerFor("/cfg/child").Warn("child")
+
+	// applying a configuration without the namespaces discards the async appender, writing its messages
+	require.NoError(t, Configure(&Config{}))
+	content := readFile(t, logFile)
+	assert.Contains(t, content, "level=INFO namespace=/cfg/ msg=parent a=1\n")
+	assert.Contains(t, content, "level=WARN namespace=/cfg/child/ msg=child\n")
+	assert.NotContains(t, content, "filtered")
+
+	for _, wrk := range Workers() {
+		assert.False(t, strings.HasPrefix(wrk.Prefix, "/cfg/"), wrk.Prefix)
+	}
+}
+
+func TestConfigureInherited(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := func(file string) *Config {
+		return &Config{
+			Appenders: map[string]AppenderConfig{
+				"file": {Type: "file", File: filepath.Join(dir, file)},
+			},
+			Namespaces: []NamespaceConfig{
+				{Namespace: "/inherit", Level: "INFO", Appenders: []string{"file"}},
+			},
+		}
+	}
+	require.NoError(t, Configure(config("a.log")))
+	defer Configure(&Config{})
+
+	// registered in code, with the writers of the parent
+	wrk := Register("/inherit/child", INFO)
+	wrk.SetTimeFormat("")
+	wrk.ShowLevel(false)
+	defer unregister("/inherit/child")
+	logger := LoggerFor("/inherit/child")
+	logger.Info("first")
+
+	// the discarded appender is no longer used
+	require.NoError(t, Configure(config("b.log")))
+	logger.Info("second")
+
+	assert.Equal(t, ": first\n", readFile(t, filepath.Join(dir, "a.log")))
+	assert.Equal(t, ": second\n", readFile(t, filepath.Join(dir, "b.log")))
+}
+
+func TestConfigureInvalid(t *testing.T) {
+	cases := map[string]*Config{
+		"level":    {Namespaces: []NamespaceConfig{{Namespace: "/a", Level: "LOUD"}}},
+		"appender": {Namespaces: []NamespaceConfig{{Namespace: "/a", Level: "INFO", Appenders: []string{"x"}}}},
+		"type":     {Appenders: map[string]AppenderConfig{"x": {Type: "printer"}}},
+		"file":     {Appenders: map[string]AppenderConfig{"x": {Type: "rolling"}}},
+		"encoder":  {Appenders: map[string]AppenderConfig{"x": {Type: "console", Encoder: "xml"}}},
+		"overflow": {Appenders: map[string]AppenderConfig{"x": {Type: "console", Async: true, Overflow: "spill"}}},
+		"every":    {Appenders: map[string]AppenderConfig{"x": {Type: "rolling", File: "x.log", Every: "weekly"}}},
+		"maxAge":   {Appenders: map[string]AppenderConfig{"x": {Type: "rolling", File: "x.log", MaxAge: "1 week"}}},
+		"address":  {Appenders: map[string]AppenderConfig{"x": {Type: "net", Network: "tcp"}}},
+		"dedup":    {Namespaces: []NamespaceConfig{{Namespace: "/a", Level: "INFO", Dedup: "1 minute"}}},
+		"sampling": {Namespaces: []NamespaceConfig{{Namespace: "/a", Level: "INFO", Sampling: &SamplingConfig{First: 1}}}},
+		"rate":     {Namespaces: []NamespaceConfig{{Namespace: "/a", Level: "INFO", RateLimits: map[string]int64{"LOUD": 1}}}},
+		"duplicated": {Namespaces: []NamespaceConfig{
+			{Namespace: "/a", Level: "INFO"},
+			{Namespace: "a/", Level: "INFO"},
+		}},
+	}
+	for name, cfg := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, Configure(cfg))
+		})
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfgFile := filepath.Join(dir, "log.json")
+	logFile := filepath.ToSlash(filepath.Join(dir, "app.log"))
+	config := `{
+		"appenders": {"file": {"type": "file", "file": "` + logFile + `", "async": true}},
+		"namespaces": [{"namespace": "/watch", "level": "%s", "appenders": ["file"], "timeFormat": "", "showLevel": false}]
+	}`
+	writeFile(t, cfgFile, strings.Replace(config, "%s", "ERROR", 1))
+
+	var mu sync.Mutex
+	var errs []error
+	stop, err := WatchConfig(cfgFile, 10*time.Millisecond, func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+	require.NoError(t, err)
+	defer Configure(&Config{})
+	defer stop()
+
+	logger := LoggerFor("/watch")
+	assert.False(t, logger.IsActive(INFO))
+
+	// a broken file is reported and the configuration is kept
+	writeFile(t, cfgFile, "{")
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(errs) > 0
+	}, time.Second, 10*time.Millisecond)
+	assert.False(t, logger.IsActive(INFO))
+
+	writeFile(t, cfgFile, strings.Replace(config, "%s", "DEBUG", 1))
+	assert.Eventually(t, func() bool {
+		return logger.IsActive(INFO)
+	}, time.Second, 10*time.Millisecond)
+
+	// the queued messages are written when the appender is discarded
+	logger.Info("kept")
+	require.NoError(t, Configure(&Config{}))
+	assert.Equal(t, ": kept\n", readFile(t, logFile))
+}
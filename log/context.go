@@ -0,0 +1,56 @@
+package log
+
+import "context"
+
+// keys of the request scoped fields
+const (
+	RequestIDKey = "requestId"
+	UserKey      = "user"
+	TraceIDKey   = "traceId"
+	SpanIDKey    = "spanId"
+)
+
+type contextKey struct{}
+
+// WithContext returns a copy of the context carrying the logger, eg: a logger with the fields of a request
+func WithContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by the context or, if none, the root logger
+func FromContext(ctx context.Context) *Logger {
+	if logger, ok := loggerOf(ctx); ok {
+		return logger
+	}
+	return RootLogger()
+}
+
+// ContextWith returns a copy of the context carrying the logger of the context with more fields,
+// given as Field values or key/value pairs.
+//
+// eg: ctx = log.ContextWith(ctx, log.UserKey, user)
+func ContextWith(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	return WithContext(ctx, FromContext(ctx).With(keysAndValues...))
+}
+
+func loggerOf(ctx context.Context) (*Logger, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	logger, ok := ctx.Value(contextKey{}).(*Logger)
+	return logger, ok && logger != nil
+}
+
+// Ctx returns a copy of the logger with the fields of the logger carried by the context, if any.
+// It is used by loggers of other namespaces to log the request scoped fields.
+//
+// eg: logger.Ctx(ctx).Infow("saved", "id", id)
+func (this *Logger) Ctx(ctx context.Context) *Logger {
+	other, ok := loggerOf(ctx)
+	if !ok || other == this || len(other.fields) == 0 {
+		return this
+	}
+	tmp := this.With()
+	tmp.fields = append(tmp.fields, other.fields...)
+	return tmp
+}
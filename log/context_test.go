@@ -0,0 +1,27 @@
+package log
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext(t *testing.T) {
+	w := &captureWriter{}
+	register(t, "/ctx", w)
+	defer unregister("/ctx")
+
+	assert.Equal(t, RootLogger().tag, FromContext(context.Background()).tag)
+
+	ctx := WithContext(context.Background(), LoggerFor("/ctx").With(RequestIDKey, "r1"))
+	ctx = ContextWith(ctx, UserKey, "ana")
+	FromContext(ctx).Info("hello")
+	assert.Equal(t, ": hello requestId=r1 user=ana\n", w.last())
+
+	// other namespaces pick up the fields of the context
+	logger := LoggerFor("/ctx/other").With("a", 1)
+	logger.Ctx(ctx).Infow("saved", "id", 2)
+	assert.Equal(t, ": saved a=1 requestId=r1 user=ana id=2\n", w.last())
+	assert.Len(t, logger.Ctx(context.Background()).Fields(), 1)
+}
@@ -0,0 +1,244 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/quintans/toolkit/faults"
+)
+
+var (
+	_ Encoder = &TextEncoder{}
+	_ Encoder = &JSONEncoder{}
+	_ Encoder = &LogfmtEncoder{}
+)
+
+// TextEncoder encodes an event as: <time> <level> [<caller>]: <message> <key=value...>
+// with the error in the position it was logged, followed by the stack of the error, if any.
+type TextEncoder struct {
+	// TimeFormat formats the time of the event. If nil, the time is not written.
+	TimeFormat func(time.Time) string
+	ShowLevel  bool
+}
+
+func (enc *TextEncoder) Encode(buf *bytes.Buffer, e *Event, color bool) {
+	start := buf.Len()
+	if enc.TimeFormat != nil {
+		buf.WriteString(enc.TimeFormat(e.Time))
+	}
+
+	if enc.ShowLevel {
+		if buf.Len() > start {
+			buf.WriteString(" ")
+		}
+		// left padding level
+		var s = e.Level.String()
+		s = strings.Repeat(" ", 5-len(s)) + s
+
+		if color {
+			if colorFunc := logLevelColors[e.Level]; colorFunc != nil {
+				s = colorFunc(s)
+			}
+		}
+		buf.WriteString(s)
+	}
+
+	if e.Caller != "" {
+		if buf.Len() > start {
+			buf.WriteString(" ")
+		}
+		buf.WriteString("[")
+		buf.WriteString(e.Caller)
+		buf.WriteString("]")
+	}
+	buf.WriteString(": ")
+	buf.WriteString(e.Message)
+
+	if fields := e.fields(); len(fields) > 0 {
+		buf.WriteByte(' ')
+		appendText(buf, fields)
+	}
+	if e.Error != nil {
+		if stack := errorStack(e.Error); stack != "" {
+			buf.WriteByte('\n')
+			buf.WriteString(stack)
+		}
+	}
+	buf.WriteByte('\n')
+}
+
+// JSONEncoder encodes an event as a JSON object in a single line, with the keys:
+// time, level, namespace, caller, msg, the fields, error and stack.
+// Fields with the same key as one of the others are prefixed with "fields.", eg: fields.time
+type JSONEncoder struct {
+	// TimeLayout is the layout of the time. Default is time.RFC3339Nano.
+	TimeLayout string
+}
+
+func (enc *JSONEncoder) Encode(buf *bytes.Buffer, e *Event, color bool) {
+	layout := enc.TimeLayout
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	buf.WriteString(`{"time":`)
+	writeJSONString(buf, e.Time.Format(layout))
+	buf.WriteString(`,"level":`)
+	writeJSONString(buf, e.Level.String())
+	buf.WriteString(`,"namespace":`)
+	writeJSONString(buf, e.Namespace)
+	if e.Caller != "" {
+		buf.WriteString(`,"caller":`)
+		writeJSONString(buf, e.Caller)
+	}
+	buf.WriteString(`,"msg":`)
+	writeJSONString(buf, e.Message)
+	for _, f := range e.Fields {
+		buf.WriteByte(',')
+		writeJSONString(buf, fieldKey(e, f.Key))
+		buf.WriteByte(':')
+		writeJSONValue(buf, f)
+	}
+	if e.Error != nil {
+		buf.WriteString(`,"error":`)
+		writeJSONString(buf, faults.Error(e.Error))
+		if stack := errorStack(e.Error); stack != "" {
+			buf.WriteString(`,"stack":`)
+			writeJSONString(buf, stack)
+		}
+	}
+	buf.WriteString("}\n")
+}
+
+// fieldKey returns the key of a field, prefixed with "fields." if it is one of the keys of the event
+func fieldKey(e *Event, key string) string {
+	switch key {
+	case "time", "level", "namespace", "caller", "msg":
+		return "fields." + key
+	case "error", "stack":
+		if e.Error != nil {
+			return "fields." + key
+		}
+	}
+	return key
+}
+
+func writeJSONValue(buf *bytes.Buffer, f Field) {
+	switch f.Type {
+	case StringType:
+		writeJSONString(buf, f.String)
+	case IntType:
+		buf.WriteString(strconv.FormatInt(f.Integer, 10))
+	case UintType:
+		buf.WriteString(strconv.FormatUint(uint64(f.Integer), 10))
+	case FloatType:
+		v := math.Float64frombits(uint64(f.Integer))
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			writeJSONString(buf, strconv.FormatFloat(v, 'g', -1, 64))
+		} else {
+			buf.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	case BoolType:
+		buf.WriteString(strconv.FormatBool(f.Integer == 1))
+	case DurationType:
+		writeJSONString(buf, time.Duration(f.Integer).String())
+	case TimeType:
+		writeJSONString(buf, f.Value().(time.Time).Format(time.RFC3339Nano))
+	case ErrorType:
+		writeJSONString(buf, faults.Error(f.Interface.(error)))
+	default:
+		b, err := json.Marshal(f.Interface)
+		if err != nil {
+			writeJSONString(buf, fmt.Sprint(f.Interface))
+			return
+		}
+		buf.Write(b)
+	}
+}
+
+const hex = "0123456789abcdef"
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				buf.WriteString(`\ufffd`)
+			} else {
+				buf.WriteString(s[i : i+size])
+			}
+			i += size
+			continue
+		}
+		switch c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[c>>4])
+				buf.WriteByte(hex[c&0xf])
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+		i++
+	}
+	buf.WriteByte('"')
+}
+
+// LogfmtEncoder encodes an event as key=value pairs in a single line, with the keys:
+// time, level, namespace, caller, msg, the fields, error and stack.
+// As with JSONEncoder, fields with the same key as one of the others are prefixed with "fields."
+type LogfmtEncoder struct {
+	// TimeLayout is the layout of the time. Default is time.RFC3339Nano.
+	TimeLayout string
+}
+
+func (enc *LogfmtEncoder) Encode(buf *bytes.Buffer, e *Event, color bool) {
+	layout := enc.TimeLayout
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	buf.WriteString("time=")
+	writeQuoted(buf, e.Time.Format(layout))
+	buf.WriteString(" level=")
+	buf.WriteString(e.Level.String())
+	buf.WriteString(" namespace=")
+	writeQuoted(buf, e.Namespace)
+	if e.Caller != "" {
+		buf.WriteString(" caller=")
+		writeQuoted(buf, e.Caller)
+	}
+	buf.WriteString(" msg=")
+	writeQuoted(buf, e.Message)
+	for _, f := range e.Fields {
+		buf.WriteByte(' ')
+		buf.WriteString(fieldKey(e, f.Key))
+		buf.WriteByte('=')
+		writeQuoted(buf, f.text())
+	}
+	if e.Error != nil {
+		buf.WriteString(" error=")
+		writeQuoted(buf, faults.Error(e.Error))
+		if stack := errorStack(e.Error); stack != "" {
+			buf.WriteString(" stack=")
+			writeQuoted(buf, stack)
+		}
+	}
+	buf.WriteByte('\n')
+}
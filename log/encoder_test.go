@@ -0,0 +1,123 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quintans/toolkit/faults"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEvent() *Event {
+	return &Event{
+		Time:      time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC),
+		Level:     INFO,
+		Namespace: "/app/",
+		Caller:    "main.go:10",
+		Message:   `say "hi"`,
+		Fields:    []Field{String("user", "john doe"), Int("n", 1), Bool("ok", true)},
+	}
+}
+
+func encode(enc Encoder, e *Event, color bool) string {
+	var buf bytes.Buffer
+	enc.Encode(&buf, e, color)
+	return buf.String()
+}
+
+func TestTextEncoder(t *testing.T) {
+	enc := &TextEncoder{TimeFormat: TimeFormatter("%Y-%02M-%02D %02h:%02m:%02s.%03x"), ShowLevel: true}
+	e := testEvent()
+	assert.Equal(t, `2020-01-02 03:04:05.006  INFO [main.go:10]: say "hi" user="john doe" n=1 ok=true`+"\n", encode(enc, e, false))
+
+	colored := encode(enc, e, true)
+	assert.Contains(t, colored, "\x1b[")
+	assert.Contains(t, colored, "INFO")
+
+	e.Caller = ""
+	e.Fields = nil
+	enc = &TextEncoder{}
+	assert.Equal(t, ": say \"hi\"\n", encode(enc, e, false))
+}
+
+func TestJSONEncoder(t *testing.T) {
+	e := testEvent()
+	e.Fields = append(e.Fields, Any("list", []int{1, 2}), Duration("took", time.Second))
+	e.Error = faults.Wrapf(errors.New("boom"), "failed")
+
+	line := encode(&JSONEncoder{}, e, true)
+	require.True(t, strings.HasSuffix(line, "}\n"))
+	require.Equal(t, 1, strings.Count(line, "\n"))
+
+	m := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(line), &m))
+	assert.Equal(t, "2020-01-02T03:04:05.006Z", m["time"])
+	assert.Equal(t, "INFO", m["level"])
+	assert.Equal(t, "/app/", m["namespace"])
+	assert.Equal(t, "main.go:10", m["caller"])
+	assert.Equal(t, `say "hi"`, m["msg"])
+	assert.Equal(t, "john doe", m["user"])
+	assert.Equal(t, 1.0, m["n"])
+	assert.Equal(t, true, m["ok"])
+	assert.Equal(t, []interface{}{1.0, 2.0}, m["list"])
+	assert.Equal(t, "1s", m["took"])
+	assert.Equal(t, "failed > boom", m["error"])
+	assert.Contains(t, m["stack"], "encoder_test.go")
+}
+
+func TestJSONEncoderKeyCollisions(t *testing.T) {
+	e := testEvent()
+	e.Fields = []Field{String("msg", "other"), String("time", "later"), Err(errors.New("second"))}
+	e.Error = errors.New("boom")
+	line := encode(&JSONEncoder{}, e, false)
+	assert.Equal(t, 1, strings.Count(line, `"msg":`))
+	assert.Equal(t, 1, strings.Count(line, `"error":`))
+
+	m := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(line), &m))
+	assert.Equal(t, `say "hi"`, m["msg"])
+	assert.Equal(t, "other", m["fields.msg"])
+	assert.Equal(t, "2020-01-02T03:04:05.006Z", m["time"])
+	assert.Equal(t, "later", m["fields.time"])
+	assert.Equal(t, "boom", m["error"])
+	assert.Equal(t, "second", m["fields.error"])
+
+	// without an error, the key is free
+	e.Error = nil
+	m = map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(encode(&JSONEncoder{}, e, false)), &m))
+	assert.Equal(t, "second", m["error"])
+}
+
+func TestLogfmtEncoder(t *testing.T) {
+	e := testEvent()
+	e.Error = errors.New("boom")
+	assert.Equal(t,
+		`time=2020-01-02T03:04:05.006Z level=INFO namespace=/app/ caller=main.go:10 msg="say \"hi\"" user="john doe" n=1 ok=true error=boom`+"\n",
+		encode(&LogfmtEncoder{}, e, true),
+	)
+}
+
+func TestWorkerEncoder(t *testing.T) {
+	w := &captureWriter{}
+	logger := register(t, "/test/encoder", w)
+	LoggerFor("/test/encoder").getWorker().SetEncoder(&JSONEncoder{})
+
+	logger.Infow("hello", "a", 1)
+	m := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(w.last()), &m))
+	assert.Equal(t, "hello", m["msg"])
+	assert.Equal(t, 1.0, m["a"])
+
+	// an appender encoder takes precedence over the worker one
+	var buf bytes.Buffer
+	a := &RootAppender{Writer: &buf, Encoder: &LogfmtEncoder{TimeLayout: "-"}}
+	Register("/test/encoder/appender", DEBUG, a)
+	LoggerFor("/test/encoder/appender").Info("hi")
+	assert.Equal(t, "time=- level=INFO namespace=/test/encoder/appender/ msg=hi\n", buf.String())
+}
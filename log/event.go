@@ -0,0 +1,77 @@
+package log
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/quintans/toolkit/faults"
+)
+
+// Event is a logged message
+type Event struct {
+	Time      time.Time
+	Level     LogLevel
+	Namespace string
+	// Caller is file:line of the log call. Empty if the worker does not show the caller.
+	Caller  string
+	Message string
+	Fields  []Field
+	// Error is the value of the first error field with the key "error", which is not in Fields
+	Error error
+	// errorAt is the position, plus one, of the error field among the logged fields. 0 if at the end.
+	errorAt int
+
+	worker *Worker
+	// site is file:line of the log call, if the worker shows the caller or its filter samples by call site
+	site string
+}
+
+// CallSite returns the full file:line of the log call, if the worker shows the caller or its filter samples by call site
+func (e *Event) CallSite() string {
+	return e.site
+}
+
+// Encoder encodes events for the writers
+type Encoder interface {
+	// Encode appends the event to the buffer, ending with a new line.
+	// color tells if the output is a terminal, where colors can be used.
+	Encode(buf *bytes.Buffer, e *Event, color bool)
+}
+
+// Encode encodes the event with the encoder.
+// If the encoder is nil, it uses the encoder of the worker that logged the event.
+func (e *Event) Encode(encoder Encoder, color bool) []byte {
+	if encoder == nil {
+		if e.worker != nil {
+			encoder = e.worker.Encoder()
+		} else {
+			encoder = &TextEncoder{ShowLevel: true}
+		}
+	}
+	var buf bytes.Buffer
+	encoder.Encode(&buf, e, color)
+	return buf.Bytes()
+}
+
+// fields returns the fields with the error field in the position it was logged
+func (e *Event) fields() []Field {
+	if e.Error == nil {
+		return e.Fields
+	}
+	k := e.errorAt - 1
+	if k < 0 || k > len(e.Fields) {
+		k = len(e.Fields)
+	}
+	fields := make([]Field, 0, len(e.Fields)+1)
+	fields = append(fields, e.Fields[:k]...)
+	fields = append(fields, Err(e.Error))
+	return append(fields, e.Fields[k:]...)
+}
+
+// errorStack returns the stack of the error, if it was created by the faults package
+func errorStack(err error) string {
+	if f, ok := err.(*faults.Fault); ok {
+		return f.Stack()
+	}
+	return ""
+}
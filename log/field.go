@@ -0,0 +1,238 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/quintans/toolkit/faults"
+)
+
+// FieldType tells how the value of a Field is stored
+type FieldType uint8
+
+const (
+	UnknownType FieldType = iota
+	StringType
+	IntType
+	UintType
+	FloatType
+	BoolType
+	DurationType
+	TimeType
+	ErrorType
+	AnyType
+)
+
+// Field is a key/value pair of a structured log message.
+// The typed constructors store primitive values without allocating.
+type Field struct {
+	Key       string
+	Type      FieldType
+	Integer   int64
+	String    string
+	Interface interface{}
+}
+
+func String(key string, value string) Field {
+	return Field{Key: key, Type: StringType, String: value}
+}
+
+func Int(key string, value int) Field {
+	return Field{Key: key, Type: IntType, Integer: int64(value)}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Type: IntType, Integer: value}
+}
+
+func Uint64(key string, value uint64) Field {
+	return Field{Key: key, Type: UintType, Integer: int64(value)}
+}
+
+func Float64(key string, value float64) Field {
+	return Field{Key: key, Type: FloatType, Integer: int64(math.Float64bits(value))}
+}
+
+func Bool(key string, value bool) Field {
+	var i int64
+	if value {
+		i = 1
+	}
+	return Field{Key: key, Type: BoolType, Integer: i}
+}
+
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Type: DurationType, Integer: int64(value)}
+}
+
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, Type: TimeType, Integer: value.UnixNano(), Interface: value.Location()}
+}
+
+// Err creates a field with the key "error". A nil error is logged as nil.
+func Err(err error) Field {
+	return NamedErr("error", err)
+}
+
+func NamedErr(key string, err error) Field {
+	if err == nil {
+		return Field{Key: key, Type: AnyType}
+	}
+	return Field{Key: key, Type: ErrorType, Interface: err}
+}
+
+// Any creates a field choosing the typed constructor from the type of the value
+func Any(key string, value interface{}) Field {
+	switch v := value.(type) {
+	case Field:
+		v.Key = key
+		return v
+	case string:
+		return String(key, v)
+	case int:
+		return Int(key, v)
+	case int8:
+		return Int64(key, int64(v))
+	case int16:
+		return Int64(key, int64(v))
+	case int32:
+		return Int64(key, int64(v))
+	case int64:
+		return Int64(key, v)
+	case uint:
+		return Uint64(key, uint64(v))
+	case uint8:
+		return Uint64(key, uint64(v))
+	case uint16:
+		return Uint64(key, uint64(v))
+	case uint32:
+		return Uint64(key, uint64(v))
+	case uint64:
+		return Uint64(key, v)
+	case float32:
+		return Float64(key, float64(v))
+	case float64:
+		return Float64(key, v)
+	case bool:
+		return Bool(key, v)
+	case time.Duration:
+		return Duration(key, v)
+	case time.Time:
+		return Time(key, v)
+	case error:
+		return NamedErr(key, v)
+	default:
+		return Field{Key: key, Type: AnyType, Interface: value}
+	}
+}
+
+// Value returns the value of the field
+func (f Field) Value() interface{} {
+	switch f.Type {
+	case StringType:
+		return f.String
+	case IntType:
+		return f.Integer
+	case UintType:
+		return uint64(f.Integer)
+	case FloatType:
+		return math.Float64frombits(uint64(f.Integer))
+	case BoolType:
+		return f.Integer == 1
+	case DurationType:
+		return time.Duration(f.Integer)
+	case TimeType:
+		t := time.Unix(0, f.Integer)
+		if loc, ok := f.Interface.(*time.Location); ok {
+			t = t.In(loc)
+		}
+		return t
+	default:
+		return f.Interface
+	}
+}
+
+// badKey is the key of a value without key in a list of key/value pairs
+const badKey = "!BADKEY"
+
+// toFields converts a list of fields and key/value pairs into fields.
+// A Field in the list takes no key.
+func toFields(keysAndValues []interface{}) []Field {
+	if len(keysAndValues) == 0 {
+		return nil
+	}
+	fields := make([]Field, 0, len(keysAndValues))
+	for i := 0; i < len(keysAndValues); i++ {
+		switch k := keysAndValues[i].(type) {
+		case Field:
+			fields = append(fields, k)
+		case string:
+			if i == len(keysAndValues)-1 {
+				fields = append(fields, String(badKey, k))
+			} else {
+				i++
+				fields = append(fields, Any(k, keysAndValues[i]))
+			}
+		default:
+			fields = append(fields, Any(badKey, k))
+		}
+	}
+	return fields
+}
+
+// appendText writes the fields as space separated key=value pairs, quoting the values when needed
+func appendText(buf *bytes.Buffer, fields []Field) {
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		writeQuoted(buf, f.text())
+	}
+}
+
+// text returns the value of the field as text, without quotes
+func (f Field) text() string {
+	switch f.Type {
+	case StringType:
+		return f.String
+	case IntType:
+		return strconv.FormatInt(f.Integer, 10)
+	case UintType:
+		return strconv.FormatUint(uint64(f.Integer), 10)
+	case FloatType:
+		return strconv.FormatFloat(math.Float64frombits(uint64(f.Integer)), 'g', -1, 64)
+	case BoolType:
+		return strconv.FormatBool(f.Integer == 1)
+	case TimeType:
+		return f.Value().(time.Time).Format(time.RFC3339Nano)
+	case ErrorType:
+		return faults.Error(f.Interface.(error))
+	default:
+		return fmt.Sprint(f.Value())
+	}
+}
+
+func writeQuoted(buf *bytes.Buffer, s string) {
+	if needsQuote(s) {
+		buf.WriteString(strconv.Quote(s))
+	} else {
+		buf.WriteString(s)
+	}
+}
+
+func needsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r >= 0x7f {
+			return true
+		}
+	}
+	return false
+}
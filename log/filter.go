@@ -0,0 +1,284 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	tk "github.com/quintans/toolkit"
+	"github.com/quintans/toolkit/clock"
+	"github.com/quintans/toolkit/faults"
+)
+
+var (
+	_ Filter = FilterChain{}
+	_ Filter = &Sampler{}
+	_ Filter = &Deduplicator{}
+	_ Filter = &RateLimit{}
+)
+
+// Filter decides which events of a worker are written, to protect the writers against log storms.
+// FATAL events are never filtered.
+type Filter interface {
+	// Filter returns the events to write in place of the event:
+	// none if it is suppressed, or the event preceded by the summaries of the events suppressed before
+	Filter(e *Event) []*Event
+}
+
+// FilterChain applies the filters in order, each to the events returned by the previous one
+type FilterChain []Filter
+
+func (c FilterChain) Filter(e *Event) []*Event {
+	events := []*Event{e}
+	for _, f := range c {
+		var filtered []*Event
+		for _, e := range events {
+			filtered = append(filtered, f.Filter(e)...)
+		}
+		events = filtered
+	}
+	return events
+}
+
+type filterOptions struct {
+	clock       clock.Clock
+	perCallSite bool
+}
+
+// FilterOption configures a Sampler, a Deduplicator or a RateLimit
+type FilterOption func(*filterOptions)
+
+// FilterClock sets the clock used to measure the intervals
+func FilterClock(c clock.Clock) FilterOption {
+	return func(o *filterOptions) {
+		o.clock = c
+	}
+}
+
+// FilterPerCallSite makes a Sampler count the events of each call site apart, instead of all the events of the worker
+func FilterPerCallSite() FilterOption {
+	return func(o *filterOptions) {
+		o.perCallSite = true
+	}
+}
+
+func newFilterOptions(options []FilterOption) filterOptions {
+	var opts filterOptions
+	for _, o := range options {
+		o(&opts)
+	}
+	opts.clock = clock.OrDefault(opts.clock)
+	return opts
+}
+
+// usesCallSite tells if the filter needs the call site of the events
+func usesCallSite(filter Filter) bool {
+	switch f := filter.(type) {
+	case *Sampler:
+		return f.opts.perCallSite
+	case FilterChain:
+		for _, v := range f {
+			if usesCallSite(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// summarize returns the event preceded by a summary of the events suppressed before, with their level
+func summarize(e *Event, level LogLevel, msg string, fields ...Field) []*Event {
+	summary := &Event{
+		Time:      e.Time,
+		Level:     level,
+		Namespace: e.Namespace,
+		Message:   msg,
+		Fields:    fields,
+		worker:    e.worker,
+	}
+	return []*Event{summary, e}
+}
+
+type samplerKey struct {
+	level LogLevel
+	site  string
+}
+
+type sampleCounter struct {
+	start      time.Time
+	count      int
+	suppressed int
+	// suppressed in the previous intervals
+	unreported int
+}
+
+// Sampler writes, in each interval, the first events of each level and then 1 in every thereafter events.
+// With the FilterPerCallSite option, the events of each call site are counted apart.
+//
+// The number of events sampled out in an interval is written before the next event written with the same level,
+// in a later interval.
+type Sampler struct {
+	interval   time.Duration
+	first      int
+	thereafter int
+	opts       filterOptions
+
+	mu       sync.Mutex
+	counters map[samplerKey]*sampleCounter
+}
+
+// NewSampler creates a Sampler. If thereafter is 0, the events after the first ones are all sampled out.
+func NewSampler(interval time.Duration, first, thereafter int, options ...FilterOption) *Sampler {
+	return &Sampler{
+		interval:   interval,
+		first:      first,
+		thereafter: thereafter,
+		opts:       newFilterOptions(options),
+		counters:   map[samplerKey]*sampleCounter{},
+	}
+}
+
+func (s *Sampler) Filter(e *Event) []*Event {
+	key := samplerKey{level: e.Level}
+	if s.opts.perCallSite {
+		key.site = e.site
+	}
+	now := s.opts.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.counters[key]
+	if c == nil {
+		c = &sampleCounter{start: now}
+		s.counters[key] = c
+	}
+	if now.Sub(c.start) >= s.interval {
+		c.start = now
+		c.count = 0
+		c.unreported += c.suppressed
+		c.suppressed = 0
+	}
+	c.count++
+	if c.count > s.first && (s.thereafter <= 0 || (c.count-s.first)%s.thereafter != 0) {
+		c.suppressed++
+		return nil
+	}
+	if c.unreported == 0 {
+		return []*Event{e}
+	}
+	events := summarize(e, e.Level, fmt.Sprintf("sampled out %d messages", c.unreported))
+	c.unreported = 0
+	return events
+}
+
+// Deduplicator suppresses the events equal to the previous one, in level, message, fields and error,
+// during a window starting at the first of them.
+//
+// The number of suppressed events is written before the next different event, or the next equal one after the window.
+type Deduplicator struct {
+	window time.Duration
+	opts   filterOptions
+
+	mu         sync.Mutex
+	last       string
+	lastLevel  LogLevel
+	lastMsg    string
+	since      time.Time
+	suppressed int
+}
+
+// NewDeduplicator creates a Deduplicator
+func NewDeduplicator(window time.Duration, options ...FilterOption) *Deduplicator {
+	return &Deduplicator{
+		window: window,
+		opts:   newFilterOptions(options),
+	}
+}
+
+func (d *Deduplicator) Filter(e *Event) []*Event {
+	key := dedupKey(e)
+	now := d.opts.clock.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if key == d.last && now.Sub(d.since) < d.window {
+		d.suppressed++
+		return nil
+	}
+
+	events := []*Event{e}
+	if d.suppressed > 0 {
+		events = summarize(e, d.lastLevel, fmt.Sprintf("suppressed %d messages", d.suppressed), String("message", d.lastMsg))
+		d.suppressed = 0
+	}
+	d.last = key
+	d.lastLevel = e.Level
+	d.lastMsg = e.Message
+	d.since = now
+	return events
+}
+
+func dedupKey(e *Event) string {
+	var buf bytes.Buffer
+	buf.WriteString(e.Level.String())
+	buf.WriteByte(0)
+	buf.WriteString(e.Message)
+	buf.WriteByte(0)
+	appendText(&buf, e.Fields)
+	if e.Error != nil {
+		buf.WriteByte(0)
+		buf.WriteString(faults.Error(e.Error))
+	}
+	return buf.String()
+}
+
+// RateLimit limits the number of events per second of each level, with a toolkit.RateLimiter
+// allowing bursts of as many events as the rate, like a token bucket with that capacity.
+//
+// The number of dropped events is written before the next event written with the same level.
+type RateLimit struct {
+	limiters map[LogLevel]*tk.RateLimiter
+
+	mu         sync.Mutex
+	suppressed map[LogLevel]int
+}
+
+// NewRateLimit creates a RateLimit with the number of events per second of each level.
+// The levels without a positive rate are not limited.
+func NewRateLimit(rates map[LogLevel]int64, options ...FilterOption) *RateLimit {
+	opts := newFilterOptions(options)
+	r := &RateLimit{
+		limiters:   map[LogLevel]*tk.RateLimiter{},
+		suppressed: map[LogLevel]int{},
+	}
+	for level, rate := range rates {
+		if rate > 0 {
+			r.limiters[level] = tk.NewRateLimiter(rate, tk.RateLimiterClock(opts.clock), tk.RateLimiterBurst(rate))
+		}
+	}
+	return r
+}
+
+func (r *RateLimit) Filter(e *Event) []*Event {
+	limiter := r.limiters[e.Level]
+	if limiter == nil {
+		return []*Event{e}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !limiter.TryTake() {
+		r.suppressed[e.Level]++
+		return nil
+	}
+	suppressed := r.suppressed[e.Level]
+	if suppressed == 0 {
+		return []*Event{e}
+	}
+	delete(r.suppressed, e.Level)
+	return summarize(e, e.Level, fmt.Sprintf("%d messages over the rate limit were dropped", suppressed))
+}
@@ -0,0 +1,99 @@
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quintans/toolkit/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func messages(events []*Event) []string {
+	var msgs []string
+	for _, e := range events {
+		msgs = append(msgs, e.Message)
+	}
+	return msgs
+}
+
+func filterAll(f Filter, events ...*Event) []string {
+	var out []*Event
+	for _, e := range events {
+		out = append(out, f.Filter(e)...)
+	}
+	return messages(out)
+}
+
+func event(level LogLevel, msg string, fields ...Field) *Event {
+	return &Event{Level: level, Namespace: "/", Message: msg, Fields: fields}
+}
+
+func TestSampler(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	s := NewSampler(time.Second, 2, 3, FilterClock(clk))
+
+	var events []*Event
+	for i := 0; i < 8; i++ {
+		events = append(events, event(INFO, string(rune('a'+i))))
+	}
+	// first 2, then 1 in 3
+	assert.Equal(t, []string{"a", "b", "e", "h"}, filterAll(s, events...))
+	// levels are counted apart
+	assert.Equal(t, []string{"warn"}, filterAll(s, event(WARN, "warn")))
+
+	clk.Advance(time.Second)
+	assert.Equal(t, []string{"sampled out 4 messages", "i", "j"}, filterAll(s, event(INFO, "i"), event(INFO, "j")))
+}
+
+func TestDeduplicator(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	d := NewDeduplicator(time.Second, FilterClock(clk))
+
+	out := d.Filter(event(ERROR, "boom", Int("id", 1)))
+	out = append(out, d.Filter(event(ERROR, "boom", Int("id", 1)))...)
+	out = append(out, d.Filter(event(ERROR, "boom", Int("id", 1)))...)
+	// different fields
+	out = append(out, d.Filter(event(ERROR, "boom", Int("id", 2)))...)
+	assert.Equal(t, []string{"boom", "suppressed 2 messages", "boom"}, messages(out))
+	assert.Equal(t, ERROR, out[1].Level)
+	assert.Equal(t, []Field{String("message", "boom")}, out[1].Fields)
+
+	d.Filter(event(ERROR, "boom", Int("id", 2)))
+	clk.Advance(time.Second)
+	// the window is over
+	assert.Equal(t, []string{"suppressed 1 messages", "boom"}, filterAll(d, event(ERROR, "boom", Int("id", 2))))
+}
+
+func TestRateLimit(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	r := NewRateLimit(map[LogLevel]int64{ERROR: 2}, FilterClock(clk))
+
+	// bursts of up to the rate
+	assert.Equal(t, []string{"a", "b", "x", "y"}, filterAll(r, event(ERROR, "a"), event(ERROR, "b"), event(ERROR, "c"), event(INFO, "x"), event(INFO, "y")))
+	clk.Advance(500 * time.Millisecond)
+	assert.Equal(t, []string{"1 messages over the rate limit were dropped", "d"}, filterAll(r, event(ERROR, "d"), event(ERROR, "e")))
+	clk.Advance(500 * time.Millisecond)
+	assert.Equal(t, []string{"1 messages over the rate limit were dropped", "f"}, filterAll(r, event(ERROR, "f")))
+}
+
+func TestWorkerFilter(t *testing.T) {
+	w := &captureWriter{}
+	logger := register(t, "/filter", w)
+	defer unregister("/filter")
+	logger.getWorker().SetFilter(FilterChain{
+		NewDeduplicator(time.Hour),
+		NewSampler(time.Hour, 1, 0, FilterPerCallSite()),
+	})
+
+	for i := 0; i < 3; i++ {
+		logger.Infow("loop", "i", i)
+	}
+	for i := 0; i < 3; i++ {
+		logger.Info("repeated")
+	}
+	// never filtered
+	logger.Fatal("fatal")
+	logger.Fatal("fatal")
+
+	assert.Equal(t, []string{": loop i=0\n", ": repeated\n", ": fatal\n", ": fatal\n"}, w.lines)
+}
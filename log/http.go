@@ -0,0 +1,182 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/quintans/toolkit/clock"
+)
+
+var _ http.Handler = &LevelHandler{}
+
+// WorkerInfo describes a worker in the responses of LevelHandler
+type WorkerInfo struct {
+	Namespace string   `json:"namespace"`
+	Level     string   `json:"level"`
+	Writers   []string `json:"writers"`
+	// RevertAt is when a level changed with a TTL is reverted
+	RevertAt *time.Time `json:"revertAt,omitempty"`
+}
+
+// LevelRequest is the body of a PUT to LevelHandler
+type LevelRequest struct {
+	Namespace string `json:"namespace"`
+	Level     string `json:"level"`
+	// TTL, if set, is the duration after which the level change is reverted. eg: 10m
+	TTL string `json:"ttl,omitempty"`
+}
+
+// LevelHandler manages the log levels at runtime.
+//
+// GET lists the workers with their levels and writers.
+// PUT changes the level of a namespace, with a LevelRequest body, and replies with the changed worker.
+type LevelHandler struct {
+	mu      sync.Mutex
+	reverts map[string]*revert
+	clock   clock.Clock
+}
+
+type revert struct {
+	stop chan struct{}
+	at   time.Time
+}
+
+// LevelHandlerOption configures a LevelHandler
+type LevelHandlerOption func(*LevelHandler)
+
+// LevelHandlerClock sets the clock used to revert the level changes with a TTL
+func LevelHandlerClock(c clock.Clock) LevelHandlerOption {
+	return func(h *LevelHandler) {
+		h.clock = c
+	}
+}
+
+func NewLevelHandler(options ...LevelHandlerOption) *LevelHandler {
+	h := &LevelHandler{
+		reverts: map[string]*revert{},
+	}
+	for _, o := range options {
+		o(h)
+	}
+	h.clock = clock.OrDefault(h.clock)
+	return h
+}
+
+func (h *LevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		infos := []WorkerInfo{}
+		for _, wrk := range Workers() {
+			infos = append(infos, h.info(wrk))
+		}
+		writeJSON(w, http.StatusOK, infos)
+	case http.MethodPut:
+		var req LevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid body: %s", err), http.StatusBadRequest)
+			return
+		}
+		wrk, err := h.change(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, h.info(wrk))
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *LevelHandler) change(req LevelRequest) (*Worker, error) {
+	if req.Namespace == "" {
+		return nil, fmt.Errorf("missing namespace")
+	}
+	level := ParseLevel(req.Level, -1)
+	if level < 0 {
+		return nil, fmt.Errorf("invalid level '%s'", req.Level)
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid ttl '%s'", req.TTL)
+		}
+	}
+
+	namespace := normalizeNamespace(req.Namespace)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// a new change replaces a pending revert
+	if rv := h.reverts[namespace]; rv != nil {
+		close(rv.stop)
+		delete(h.reverts, namespace)
+	}
+
+	worker, previous := SetLevel(namespace, level)
+	if ttl > 0 {
+		rv := &revert{
+			stop: make(chan struct{}),
+			at:   h.clock.Now().Add(ttl),
+		}
+		timer := h.clock.NewTimer(ttl)
+		go func() {
+			select {
+			case <-rv.stop:
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+
+			h.mu.Lock()
+			// replaced by a new change
+			if h.reverts[namespace] != rv {
+				h.mu.Unlock()
+				return
+			}
+			delete(h.reverts, namespace)
+			err := restoreLevel(worker, previous)
+			h.mu.Unlock()
+
+			if err != nil {
+				RootLogger().Warnf("log level of %s not reverted after %s: %s", namespace, ttl, err)
+			} else {
+				RootLogger().Infof("log level of %s reverted after %s", namespace, ttl)
+			}
+		}()
+		h.reverts[namespace] = rv
+	}
+	return worker, nil
+}
+
+func (h *LevelHandler) info(wrk *Worker) WorkerInfo {
+	info := WorkerInfo{
+		Namespace: wrk.Prefix,
+		Level:     wrk.Level.String(),
+		Writers:   make([]string, len(wrk.Writers)),
+	}
+	for k, v := range wrk.Writers {
+		info.Writers[k] = fmt.Sprintf("%T", v)
+	}
+
+	h.mu.Lock()
+	if rv := h.reverts[wrk.Prefix]; rv != nil {
+		at := rv.at
+		info.RevertAt = &at
+	}
+	h.mu.Unlock()
+
+	return info
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,165 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quintans/toolkit/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func put(t *testing.T, h http.Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/log/levels", strings.NewReader(body)))
+	return rec
+}
+
+func TestLevelHandler(t *testing.T) {
+	w := &captureWriter{}
+	register(t, "/test/http", w)
+	child := LoggerFor("/test/http/child")
+	h := NewLevelHandler()
+	defer unregister("/test/http/child")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/log/levels", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var infos []WorkerInfo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &infos))
+	var found bool
+	for _, info := range infos {
+		if info.Namespace == "/test/http/" {
+			found = true
+			assert.Equal(t, "DEBUG", info.Level)
+			assert.Equal(t, []string{"*log.captureWriter"}, info.Writers)
+		}
+	}
+	require.True(t, found)
+
+	// the existing loggers pick up the change
+	assert.True(t, child.IsActive(DEBUG))
+	rec = put(t, h, `{"namespace":"/test/http/child","level":"warn"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var info WorkerInfo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	assert.Equal(t, "/test/http/child/", info.Namespace)
+	assert.Equal(t, "WARN", info.Level)
+	assert.Nil(t, info.RevertAt)
+	assert.False(t, child.IsActive(INFO))
+	child.Warn("written")
+	assert.Equal(t, ": written\n", w.last())
+
+	// the parent is not affected
+	assert.True(t, LoggerFor("/test/http").IsActive(DEBUG))
+
+	rec = put(t, h, `{"namespace":"/test/http","level":"ERROR","ttl":"50ms"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	assert.NotNil(t, info.RevertAt)
+	assert.False(t, LoggerFor("/test/http/other").IsActive(WARN))
+	assert.Eventually(t, func() bool {
+		return LoggerFor("/test/http/other").IsActive(DEBUG)
+	}, time.Second, 10*time.Millisecond)
+	// the child keeps its own level
+	assert.False(t, child.IsActive(INFO))
+}
+
+func TestLevelHandlerRevertToParent(t *testing.T) {
+	register(t, "/test/revert", &captureWriter{})
+	logger := LoggerFor("/test/revert/inherited")
+	h := NewLevelHandler()
+
+	rec := put(t, h, `{"namespace":"/test/revert/inherited","level":"NONE","ttl":"50ms"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.False(t, logger.IsActive(FATAL))
+	assert.Eventually(t, func() bool {
+		return logger.IsActive(DEBUG)
+	}, time.Second, 10*time.Millisecond)
+	for _, wrk := range Workers() {
+		assert.NotEqual(t, "/test/revert/inherited/", wrk.Prefix)
+	}
+}
+
+func TestLevelHandlerErrors(t *testing.T) {
+	h := NewLevelHandler()
+	assert.Equal(t, http.StatusBadRequest, put(t, h, `{"namespace":"/a","level":"LOUD"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, put(t, h, `{"level":"INFO"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, put(t, h, `{"namespace":"/a","level":"INFO","ttl":"soon"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, put(t, h, `not json`).Code)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestSetLevelConcurrent(t *testing.T) {
+	register(t, "/test/concurrent", &captureWriter{})
+	logger := LoggerFor("/test/concurrent")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			SetLevel("/test/concurrent", LogLevel(i%int(NONE)))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		logger.Infow("msg", "i", i)
+	}
+	<-done
+}
+
+func TestLevelHandlerRevertAfterInherit(t *testing.T) {
+	register(t, "/test/inherit", &captureWriter{})
+	logger := LoggerFor("/test/inherit/child")
+	clk := clock.NewFake(time.Now())
+	h := NewLevelHandler(LevelHandlerClock(clk))
+
+	rec := put(t, h, `{"namespace":"/test/inherit/child","level":"NONE","ttl":"1m"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.False(t, logger.IsActive(FATAL))
+
+	// the worker of the child is replaced to inherit the new writers of the parent
+	w := &captureWriter{}
+	register(t, "/test/inherit", w)
+	assert.False(t, logger.IsActive(FATAL))
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	assert.Eventually(t, func() bool {
+		return logger.IsActive(DEBUG)
+	}, time.Second, 10*time.Millisecond)
+	logger.Info("written")
+	assert.Equal(t, ": written\n", w.last())
+	for _, wrk := range Workers() {
+		assert.NotEqual(t, "/test/inherit/child/", wrk.Prefix)
+	}
+}
+
+func TestLevelHandlerRevertSkipped(t *testing.T) {
+	register(t, "/test/skipped", &captureWriter{})
+	logger := LoggerFor("/test/skipped")
+	clk := clock.NewFake(time.Now())
+	h := NewLevelHandler(LevelHandlerClock(clk))
+
+	rec := put(t, h, `{"namespace":"/test/skipped","level":"ERROR","ttl":"1m"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	// changed outside the handler
+	SetLevel("/test/skipped", WARN)
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	assert.Eventually(t, func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return len(h.reverts) == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, logger.IsActive(WARN))
+	assert.False(t, logger.IsActive(INFO))
+}
@@ -0,0 +1,71 @@
+package log
+
+import "fmt"
+
+// Workers returns the registered workers, in descending order of namespace
+func Workers() []*Worker {
+	logMaster.mu.RLock()
+	defer logMaster.mu.RUnlock()
+
+	workers := make([]*Worker, len(logMaster.workers))
+	copy(workers, logMaster.workers)
+	return workers
+}
+
+// SetLevel changes the level of a namespace.
+//
+// The worker of the namespace is replaced by a copy with the new level, keeping its writers and settings,
+// so the old worker should no longer be changed.
+// If the namespace has no worker of its own, a copy of the worker of its parent is registered.
+// It returns the new worker and the replaced one, nil if the namespace had no worker of its own.
+func SetLevel(namespace string, level LogLevel) (*Worker, *Worker) {
+	namespace = normalizeNamespace(namespace)
+
+	logMaster.mu.Lock()
+	defer logMaster.mu.Unlock()
+
+	current := logMaster.findWorker(namespace)
+	worker := *current
+	worker.Prefix = namespace
+	worker.Level = level
+	if current.Prefix != namespace {
+		worker.inherited = true
+	}
+	logMaster.putWorker(&worker)
+
+	if current.Prefix != namespace {
+		return &worker, nil
+	}
+	return &worker, current
+}
+
+// restoreLevel undoes a SetLevel on the current worker of the namespace,
+// keeping any other change made since, like the writers inherited from its parent.
+// If previous is nil, the namespace goes back to the level of its parent.
+// It returns an error, telling why, if the level was not restored.
+func restoreLevel(worker, previous *Worker) error {
+	logMaster.mu.Lock()
+	defer logMaster.mu.Unlock()
+
+	for k, current := range logMaster.workers {
+		if current.Prefix != worker.Prefix {
+			continue
+		}
+		if current.Level != worker.Level {
+			return fmt.Errorf("the level was changed to %s since", current.Level)
+		}
+		if previous == nil && current.inherited {
+			logMaster.removeWorker(current.Prefix)
+			return nil
+		}
+		restored := *current
+		if previous != nil {
+			restored.Level = previous.Level
+		} else if parent := logMaster.parentWorker(k); parent != nil {
+			restored.Level = parent.Level
+		}
+		logMaster.putWorker(&restored)
+		return nil
+	}
+	return fmt.Errorf("the worker was removed since")
+}
@@ -0,0 +1,160 @@
+package log
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type captureWriter struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (w *captureWriter) Log(level LogLevel, msg string) {
+	w.mu.Lock()
+	w.lines = append(w.lines, msg)
+	w.mu.Unlock()
+}
+
+func (w *captureWriter) Discard() {}
+
+func (w *captureWriter) last() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.lines) == 0 {
+		return ""
+	}
+	return w.lines[len(w.lines)-1]
+}
+
+type captureEventWriter struct {
+	captureWriter
+	events []*Event
+}
+
+func (w *captureEventWriter) LogEvent(e *Event) {
+	w.mu.Lock()
+	w.events = append(w.events, e)
+	w.mu.Unlock()
+}
+
+type captureFieldWriter struct {
+	captureWriter
+	fields []Field
+}
+
+func (w *captureFieldWriter) LogFields(level LogLevel, msg string, fields []Field) {
+	w.Log(level, msg)
+	w.fields = fields
+}
+
+func register(t *testing.T, namespace string, writers ...LogWriter) *Logger {
+	t.Helper()
+	wrk := Register(namespace, DEBUG, writers...)
+	wrk.SetTimeFormat("")
+	wrk.ShowLevel(false)
+	return LoggerFor(namespace)
+}
+
+func unregister(namespace string) {
+	logMaster.mu.Lock()
+	logMaster.removeWorker(normalizeNamespace(namespace))
+	logMaster.mu.Unlock()
+}
+
+func TestStructuredFields(t *testing.T) {
+	w := &captureWriter{}
+	logger := register(t, "/test/fields", w)
+
+	logger.Infow("login", "user", "john", Int("attempt", 2), "ok", true)
+	assert.Equal(t, ": login user=john attempt=2 ok=true\n", w.last())
+
+	logger.Infow("spaces", "msg", "hello world", "empty", "", "dangling")
+	assert.Equal(t, `: spaces msg="hello world" empty="" !BADKEY=dangling`+"\n", w.last())
+
+	logger.Errorw("failed", Err(errors.New("boom")), Duration("took", 1500*time.Millisecond), Float64("ratio", 0.5))
+	assert.Equal(t, ": failed error=boom took=1.5s ratio=0.5\n", w.last())
+
+	logger.Debugw("trace only")
+	assert.Equal(t, ": trace only\n", w.last())
+
+	logger.Tracew("filtered", "a", 1)
+	assert.Equal(t, ": trace only\n", w.last())
+}
+
+func TestWith(t *testing.T) {
+	w := &captureWriter{}
+	logger := register(t, "/test/with", w)
+
+	child := logger.With("request", "abc")
+	child.Infof("hello %s", "world")
+	assert.Equal(t, ": hello world request=abc\n", w.last())
+
+	// children do not share fields
+	a := child.With("a", 1)
+	b := child.With("b", 2)
+	a.Infow("msg", "x", 1)
+	assert.Equal(t, ": msg request=abc a=1 x=1\n", w.last())
+	b.Info("msg")
+	assert.Equal(t, ": msg request=abc b=2\n", w.last())
+
+	logger.Info("no fields")
+	assert.Equal(t, ": no fields\n", w.last())
+}
+
+func TestFieldWriter(t *testing.T) {
+	w := &captureFieldWriter{}
+	logger := register(t, "/test/fieldwriter", w)
+
+	logger.With("user", "john").Warnw("denied", Err(errors.New("boom")), "code", 403)
+	assert.Equal(t, ": denied", w.last())
+	require.Len(t, w.fields, 3)
+	assert.Equal(t, "user", w.fields[0].Key)
+	assert.Equal(t, "john", w.fields[0].Value())
+	// the error is kept in its position
+	assert.Equal(t, "error", w.fields[1].Key)
+	assert.Equal(t, "boom", w.fields[1].Value().(error).Error())
+	assert.Equal(t, "code", w.fields[2].Key)
+	assert.Equal(t, int64(403), w.fields[2].Value())
+}
+
+func TestEventWriter(t *testing.T) {
+	w := &captureEventWriter{}
+	logger := register(t, "/test/eventwriter", w)
+	logger.getWorker().ShowCaller(true)
+
+	err := errors.New("boom")
+	logger.With("user", "john").Warnw("denied", "code", 403, Err(err))
+	require.Len(t, w.events, 1)
+	e := w.events[0]
+	assert.Equal(t, WARN, e.Level)
+	assert.Equal(t, "/test/eventwriter/", e.Namespace)
+	assert.Equal(t, "denied", e.Message)
+	assert.Contains(t, e.Caller, "log_test.go:")
+	assert.Equal(t, err, e.Error)
+	require.Len(t, e.Fields, 2)
+	assert.Equal(t, "user", e.Fields[0].Key)
+	assert.Equal(t, "john", e.Fields[0].Value())
+	assert.Equal(t, "code", e.Fields[1].Key)
+	assert.Equal(t, int64(403), e.Fields[1].Value())
+	// the writer did not get the encoded message
+	assert.Empty(t, w.last())
+}
+
+func TestFieldValue(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, true, Any("k", true).Value())
+	assert.Equal(t, uint64(7), Any("k", uint8(7)).Value())
+	assert.Equal(t, 1.25, Any("k", float32(1.25)).Value())
+	assert.True(t, now.Equal(Any("k", now).Value().(time.Time)))
+	assert.Equal(t, []int{1}, Any("k", []int{1}).Value())
+	assert.Nil(t, Err(nil).Value())
+	assert.True(t, strings.HasPrefix(TextLine("m", []Field{Any("k", []int{1})}), "m k=[1]"))
+}
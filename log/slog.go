@@ -0,0 +1,146 @@
+//go:build go1.21
+// +build go1.21
+
+package log
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strconv"
+)
+
+var _ slog.Handler = &SlogHandler{}
+
+// SlogHandler is a slog.Handler that logs the records with a Logger,
+// honouring the level and the writers of its namespace.
+//
+// eg: slog.SetDefault(slog.New(log.NewSlogHandler(log.LoggerFor("/thirdparty"))))
+type SlogHandler struct {
+	logger *Logger
+	// fields added by WithAttrs
+	fields []Field
+	// prefix of the keys, from WithGroup. eg: "request.headers."
+	group string
+}
+
+// NewSlogHandler creates a slog.Handler logging with the logger
+func NewSlogHandler(logger *Logger) *SlogHandler {
+	return &SlogHandler{logger: logger}
+}
+
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.logger.IsActive(FromSlogLevel(level))
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	fields := make([]Field, 0, len(h.logger.fields)+len(h.fields)+r.NumAttrs())
+	fields = append(fields, h.logger.fields...)
+	fields = append(fields, h.fields...)
+	// request scoped fields
+	if logger, ok := loggerOf(ctx); ok && logger != h.logger {
+		fields = append(fields, logger.fields...)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendAttr(fields, h.group, a)
+		return true
+	})
+
+	e := h.logger.event(FromSlogLevel(r.Level), r.Message, fields)
+	if !r.Time.IsZero() {
+		e.Time = r.Time
+	}
+	if (e.worker.showCaller || e.worker.callSites) && r.PC != 0 {
+		frames := runtime.CallersFrames([]uintptr{r.PC})
+		f, _ := frames.Next()
+		e.site = f.File + ":" + strconv.Itoa(f.Line)
+		if e.worker.showCaller {
+			e.Caller = shortCaller(f.File, f.Line)
+		}
+	}
+	write(e)
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	fields := make([]Field, 0, len(h.fields)+len(attrs))
+	fields = append(fields, h.fields...)
+	for _, a := range attrs {
+		fields = appendAttr(fields, h.group, a)
+	}
+	return &SlogHandler{
+		logger: h.logger,
+		fields: fields,
+		group:  h.group,
+	}
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SlogHandler{
+		logger: h.logger,
+		fields: h.fields,
+		group:  h.group + name + ".",
+	}
+}
+
+// FromSlogLevel converts a slog level to the closest level below or equal to it
+func FromSlogLevel(level slog.Level) LogLevel {
+	switch {
+	case level < slog.LevelDebug:
+		return TRACE
+	case level < slog.LevelInfo:
+		return DEBUG
+	case level < slog.LevelWarn:
+		return INFO
+	case level < slog.LevelError:
+		return WARN
+	case level < slog.LevelError+4:
+		return ERROR
+	default:
+		return FATAL
+	}
+}
+
+// appendAttr converts the attribute into fields, flattening the groups with dot separated keys
+func appendAttr(fields []Field, prefix string, a slog.Attr) []Field {
+	v := a.Value.Resolve()
+	// attributes with empty key and value are ignored, as in the slog handlers
+	if a.Key == "" && v.Any() == nil {
+		return fields
+	}
+
+	key := prefix + a.Key
+	switch v.Kind() {
+	case slog.KindString:
+		return append(fields, String(key, v.String()))
+	case slog.KindInt64:
+		return append(fields, Int64(key, v.Int64()))
+	case slog.KindUint64:
+		return append(fields, Uint64(key, v.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, Float64(key, v.Float64()))
+	case slog.KindBool:
+		return append(fields, Bool(key, v.Bool()))
+	case slog.KindDuration:
+		return append(fields, Duration(key, v.Duration()))
+	case slog.KindTime:
+		return append(fields, Time(key, v.Time()))
+	case slog.KindGroup:
+		// a group with an empty key is inlined
+		if a.Key != "" {
+			prefix = key + "."
+		}
+		for _, ga := range v.Group() {
+			fields = appendAttr(fields, prefix, ga)
+		}
+		return fields
+	default:
+		return append(fields, Any(key, v.Any()))
+	}
+}
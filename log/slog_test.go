@@ -0,0 +1,66 @@
+//go:build go1.21
+// +build go1.21
+
+package log
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlogHandler(t *testing.T) {
+	w := &captureEventWriter{}
+	logger := register(t, "/test/slog", w)
+	logger.getWorker().Level = INFO
+	logger.getWorker().ShowCaller(true)
+
+	sl := slog.New(NewSlogHandler(logger.With("app", "x")))
+	sl.Debug("filtered")
+	require.Empty(t, w.events)
+
+	err := errors.New("boom")
+	sl.With("user", "john").WithGroup("req").Warn("slow", "ms", 200, slog.Group("h", "k", "v"), "error", err)
+	require.Len(t, w.events, 1)
+	e := w.events[0]
+	assert.Equal(t, WARN, e.Level)
+	assert.Equal(t, "slow", e.Message)
+	assert.Equal(t, "/test/slog/", e.Namespace)
+	assert.Contains(t, e.Caller, "slog_test.go:")
+	assert.Equal(t, []Field{
+		String("app", "x"),
+		String("user", "john"),
+		Int64("req.ms", 200),
+		String("req.h.k", "v"),
+		NamedErr("req.error", err),
+	}, e.Fields)
+
+	sl.Error("failed", "error", err)
+	require.Len(t, w.events, 2)
+	assert.Equal(t, ERROR, w.events[1].Level)
+	assert.Equal(t, err, w.events[1].Error)
+}
+
+func TestFromSlogLevel(t *testing.T) {
+	assert.Equal(t, TRACE, FromSlogLevel(slog.LevelDebug-1))
+	assert.Equal(t, DEBUG, FromSlogLevel(slog.LevelDebug))
+	assert.Equal(t, INFO, FromSlogLevel(slog.LevelInfo+1))
+	assert.Equal(t, WARN, FromSlogLevel(slog.LevelWarn))
+	assert.Equal(t, ERROR, FromSlogLevel(slog.LevelError))
+	assert.Equal(t, FATAL, FromSlogLevel(slog.LevelError+4))
+}
+
+func TestSlogHandlerContext(t *testing.T) {
+	w := &captureEventWriter{}
+	logger := register(t, "/test/slogctx", w)
+	defer unregister("/test/slogctx")
+
+	ctx := ContextWith(context.Background(), RequestIDKey, "r1")
+	slog.New(NewSlogHandler(logger)).InfoContext(ctx, "hello", "a", 1)
+	require.Len(t, w.events, 1)
+	assert.Equal(t, []Field{String(RequestIDKey, "r1"), Int64("a", 1)}, w.events[0].Fields)
+}
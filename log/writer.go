@@ -0,0 +1,63 @@
+package log
+
+import (
+	"io"
+	stdlog "log"
+	"strings"
+)
+
+var _ io.Writer = &Writer{}
+
+// Writer is an io.Writer logging each write as a message, for libraries that only accept a writer.
+// A trailing new line is removed, and writes with many lines are logged as a single message.
+type Writer struct {
+	logger *Logger
+	level  LogLevel
+}
+
+// NewWriter creates a Writer logging with the logger at the level
+func NewWriter(logger *Logger, level LogLevel) *Writer {
+	return &Writer{
+		logger: logger,
+		level:  level,
+	}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	w.logger.logw(w.level, msg, nil)
+	return len(p), nil
+}
+
+// stdCallDepth skips the standard logger functions, Writer.Write included, to reach its caller
+const stdCallDepth = 2
+
+// NewStdLogger creates a standard library logger that logs with the logger at the level
+func NewStdLogger(logger *Logger, level LogLevel) *stdlog.Logger {
+	return stdlog.New(NewWriter(stdCaller(logger), level), "", 0)
+}
+
+// RedirectStdLog sends the output of the standard library logger, from the log.Print functions,
+// to the logger at the level.
+// It returns a function that restores the previous output and flags.
+func RedirectStdLog(logger *Logger, level LogLevel) func() {
+	flags := stdlog.Flags()
+	prefix := stdlog.Prefix()
+	out := stdlog.Writer()
+
+	stdlog.SetFlags(0)
+	stdlog.SetPrefix("")
+	stdlog.SetOutput(NewWriter(stdCaller(logger), level))
+
+	return func() {
+		stdlog.SetFlags(flags)
+		stdlog.SetPrefix(prefix)
+		stdlog.SetOutput(out)
+	}
+}
+
+func stdCaller(logger *Logger) *Logger {
+	l := logger.With()
+	l.calldepth += stdCallDepth
+	return l
+}
@@ -0,0 +1,36 @@
+package log
+
+import (
+	stdlog "log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStdLogger(t *testing.T) {
+	w := &captureEventWriter{}
+	logger := register(t, "/test/stdlog", w)
+	logger.getWorker().ShowCaller(true)
+
+	NewStdLogger(logger, WARN).Printf("hello %s", "world")
+	require.Len(t, w.events, 1)
+	assert.Equal(t, WARN, w.events[0].Level)
+	assert.Equal(t, "hello world", w.events[0].Message)
+	assert.Contains(t, w.events[0].Caller, "writer_test.go:")
+
+	restore := RedirectStdLog(logger, INFO)
+	stdlog.Println("from std")
+	restore()
+
+	require.Len(t, w.events, 2)
+	assert.Equal(t, INFO, w.events[1].Level)
+	assert.Equal(t, "from std", w.events[1].Message)
+	assert.Contains(t, w.events[1].Caller, "writer_test.go:")
+
+	_, err := NewWriter(logger, ERROR).Write([]byte("line\n"))
+	require.NoError(t, err)
+	require.Len(t, w.events, 3)
+	assert.Equal(t, "line", w.events[2].Message)
+	assert.Contains(t, w.events[2].Caller, "writer_test.go:")
+}
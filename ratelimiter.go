@@ -3,6 +3,8 @@ package toolkit
 import (
 	"sync"
 	"time"
+
+	"github.com/quintans/toolkit/clock"
 )
 
 type Rate interface {
@@ -23,14 +25,42 @@ type RateLimiter struct {
 	sync.Mutex
 	nextTake time.Time
 	perTake  int64
+	burst    int64
+	clock    clock.Clock
+}
+
+type RateLimiterOption func(*RateLimiter)
+
+// RateLimiterClock sets the clock used to measure and wait
+func RateLimiterClock(c clock.Clock) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.clock = clock.OrDefault(c)
+	}
+}
+
+// RateLimiterBurst sets how many takes can occur at once, after being idle, without breaking the rate limit.
+// Default is 1.
+func RateLimiterBurst(burst int64) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		if burst < 1 {
+			burst = 1
+		}
+		rl.burst = burst
+	}
 }
 
 // NewRateLimiter creates an instance of RateLimiter
 // rate sets the number of takes that can occur per second
-func NewRateLimiter(rate int64) *RateLimiter {
-	return &RateLimiter{
+func NewRateLimiter(rate int64, options ...RateLimiterOption) *RateLimiter {
+	rl := &RateLimiter{
 		perTake: int64(time.Second) / rate,
+		burst:   1,
+		clock:   clock.New(),
+	}
+	for _, o := range options {
+		o(rl)
 	}
+	return rl
 }
 
 // TakeN enforces the rate limit.
@@ -47,13 +77,13 @@ func (rl *RateLimiter) TakeN(amount int64) time.Duration {
 	rl.Lock()
 	defer rl.Unlock()
 
-	var now = time.Now()
+	var now = rl.clock.Now()
 	var t time.Duration
-	if now.Before(rl.nextTake) {
-		t = rl.nextTake.Sub(now)
-		time.Sleep(t)
+	if next := rl.allowedAt(); now.Before(next) {
+		t = next.Sub(now)
+		rl.clock.Sleep(t)
 	}
-	rl.nextTake = time.Now().Add(time.Duration(rl.perTake * amount))
+	rl.take(rl.clock.Now(), amount)
 	return t
 }
 
@@ -61,3 +91,35 @@ func (rl *RateLimiter) TakeN(amount int64) time.Duration {
 func (rl *RateLimiter) Take() time.Duration {
 	return rl.TakeN(1)
 }
+
+// TryTakeN is the non blocking version of TakeN.
+// It takes the amount only if the rate limit is not broken, returning false otherwise.
+func (rl *RateLimiter) TryTakeN(amount int64) bool {
+	rl.Lock()
+	defer rl.Unlock()
+
+	var now = rl.clock.Now()
+	if now.Before(rl.allowedAt()) {
+		return false
+	}
+	rl.take(now, amount)
+	return true
+}
+
+// allowedAt returns when the next take can occur, ahead of nextTake by the burst
+func (rl *RateLimiter) allowedAt() time.Time {
+	return rl.nextTake.Add(-time.Duration(rl.perTake * (rl.burst - 1)))
+}
+
+// take delays the next take by the amount, counting from now if the limiter was idle
+func (rl *RateLimiter) take(now time.Time, amount int64) {
+	if rl.nextTake.Before(now) {
+		rl.nextTake = now
+	}
+	rl.nextTake = rl.nextTake.Add(time.Duration(rl.perTake * amount))
+}
+
+// TryTake is the same as TryTakeN(1)
+func (rl *RateLimiter) TryTake() bool {
+	return rl.TryTakeN(1)
+}
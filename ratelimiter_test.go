@@ -1,20 +1,71 @@
 package toolkit
 
 import (
-	"fmt"
 	"testing"
 	"time"
+
+	"github.com/quintans/toolkit/clock"
 )
 
 func TestRate(t *testing.T) {
-	var rl = NewRateLimiter(1) // per second
-	var start = time.Now()
-	for i := 0; i < 5; i++ {
-		var d = rl.Take()
-		fmt.Println(time.Now(), d)
-	}
-	var delta = time.Now().Sub(start)
-	if delta > time.Second*5 {
-		t.Fatal("Expected less than 5s, got", delta)
+	var clk = clock.NewFake(time.Now())
+	var rl = NewRateLimiter(1, RateLimiterClock(clk)) // per second
+	var start = clk.Now()
+
+	var done = make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			rl.Take()
+		}
+		close(done)
+	}()
+
+	// the first take does not wait
+	for i := 0; i < 4; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(time.Second)
+	}
+	<-done
+
+	var delta = clk.Now().Sub(start)
+	if delta != time.Second*4 {
+		t.Fatal("Expected 4s, got", delta)
+	}
+}
+
+func TestTryTake(t *testing.T) {
+	var clk = clock.NewFake(time.Now())
+	var rl = NewRateLimiter(2, RateLimiterClock(clk)) // per second
+
+	if !rl.TryTake() {
+		t.Fatal("Expected the first take to succeed")
+	}
+	if rl.TryTake() {
+		t.Fatal("Expected the second take to fail")
+	}
+	clk.Advance(500 * time.Millisecond)
+	if !rl.TryTake() {
+		t.Fatal("Expected the take to succeed after 500ms")
+	}
+}
+
+func TestTryTakeBurst(t *testing.T) {
+	var clk = clock.NewFake(time.Now())
+	var rl = NewRateLimiter(2, RateLimiterClock(clk), RateLimiterBurst(3)) // per second
+
+	for i := 0; i < 3; i++ {
+		if !rl.TryTake() {
+			t.Fatal("Expected the burst take to succeed", i)
+		}
+	}
+	if rl.TryTake() {
+		t.Fatal("Expected the take after the burst to fail")
+	}
+	clk.Advance(500 * time.Millisecond)
+	if !rl.TryTake() {
+		t.Fatal("Expected the take to succeed after 500ms")
+	}
+	if rl.TryTake() {
+		t.Fatal("Expected the take to fail")
 	}
 }
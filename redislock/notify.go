@@ -0,0 +1,110 @@
+package redislock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// keepAlive calls extend every heartbeat until done is closed.
+// If extend fails, lost is called.
+func keepAlive(heartbeat time.Duration, done chan struct{}, extend func() bool, lost func()) {
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if !extend() {
+				lost()
+				return
+			}
+		}
+	}
+}
+
+// publishRelease wakes up the contenders waiting on channel.
+// It is best effort, since waiters also retry after the backoff delay.
+func publishRelease(pools []*redis.Pool, channel string) {
+	for _, p := range pools {
+		conn := p.Get()
+		_, _ = conn.Do("PUBLISH", channel, "released")
+		conn.Close()
+	}
+}
+
+// waitRelease waits up to timeout for a release notification on channel, subscribing to all the redis instances.
+// Since a release may happen before subscribing, after subscribing it also returns if free reports
+// that the resource is available, in the majority of the instances.
+func waitRelease(ctx context.Context, pools []*redis.Pool, channel string, timeout time.Duration, free func() (bool, error)) error {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	released := make(chan struct{}, 1)
+	wg := sync.WaitGroup{}
+	for _, p := range pools {
+		wg.Add(1)
+		go func(p *redis.Pool) {
+			defer wg.Done()
+			subscribe(waitCtx, p, channel, free, released)
+		}(p)
+	}
+
+	select {
+	case <-released:
+	case <-waitCtx.Done():
+	}
+	cancel()
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+func subscribe(ctx context.Context, p *redis.Pool, channel string, free func() (bool, error), released chan<- struct{}) {
+	conn := p.Get()
+	defer conn.Close()
+
+	psc := redis.PubSubConn{Conn: conn}
+	if err := psc.Subscribe(channel); err != nil {
+		return
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			// unblocks Receive with the unsubscribe confirmation
+			_ = psc.Unsubscribe()
+		case <-stop:
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			notify(released)
+		case redis.Subscription:
+			if v.Count == 0 {
+				return
+			}
+			if ok, err := free(); err == nil && ok {
+				notify(released)
+			}
+		case error:
+			return
+		}
+	}
+}
+
+func notify(ch chan<- struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
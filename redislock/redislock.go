@@ -1,32 +1,41 @@
 package redislock
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/go-redsync/redsync"
 	"github.com/gomodule/redigo/redis"
+	"github.com/quintans/toolkit/lock"
 )
 
+var _ lock.Locker = &Lock{}
+
 type Pool struct {
-	lock *redsync.Redsync
+	pools []*redis.Pool
 }
 
 func NewPool(redisAddresses []string) (Pool, error) {
-	pool, err := redisPool(redisAddresses)
+	pools, err := redisPool(redisAddresses)
 	if err != nil {
 		return Pool{}, err
 	}
 	return Pool{
-		lock: redsync.New(pool),
+		pools: pools,
 	}, nil
 }
 
-func redisPool(addrs []string) ([]redsync.Pool, error) {
-	pool := make([]redsync.Pool, len(addrs))
+func redisPool(addrs []string) ([]*redis.Pool, error) {
+	pool := make([]*redis.Pool, len(addrs))
 	for k, v := range addrs {
+		addr := v
 		p := &redis.Pool{
 			Dial: func() (redis.Conn, error) {
-				return redis.Dial("tcp", v)
+				return redis.Dial("tcp", addr)
 			},
 		}
 		pool[k] = p
@@ -34,53 +43,421 @@ func redisPool(addrs []string) ([]redsync.Pool, error) {
 	return pool, nil
 }
 
-func (p Pool) NewLock(lockName string, expiry time.Duration) Lock {
-	mu := p.lock.NewMutex(lockName, redsync.SetExpiry(expiry), redsync.SetTries(2))
-	return Lock{
-		mu:        mu,
+// Option configures a Lock, Semaphore or RWLock
+type Option func(*options)
+
+type options struct {
+	backoff lock.Backoff
+	value   []byte
+}
+
+// WithBackoff sets the delays between the attempts of LockWait. Default is lock.DefaultBackoff.
+func WithBackoff(b lock.Backoff) Option {
+	return func(o *options) {
+		o.backoff = b
+	}
+}
+
+// WithValue sets the value stored in the lock key while the lock is held, retrievable with Holder.
+func WithValue(value []byte) Option {
+	return func(o *options) {
+		o.value = value
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		backoff: lock.DefaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// NewLock creates a contender for the named lock.
+// The lock is acquired in the majority of the redis instances, following the Redlock algorithm.
+// The keys lockName and lockName:fence are used by the same script, so in a redis cluster
+// the name must have a hash tag, eg: {name}.
+func (p Pool) NewLock(lockName string, expiry time.Duration, options ...Option) *Lock {
+	return &Lock{
+		pools:     p.pools,
+		lockName:  lockName,
+		expiry:    expiry,
 		heartbeat: expiry / 2,
+		opts:      newOptions(options),
 	}
 }
 
+// valueSep separates the random part of the key value, that identifies the holder, from the user value
+const valueSep = ':'
+
+// genValue generates an unique key value, so that only the holder can release the lock,
+// followed by the user value
+func (l *Lock) genValue() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b) + string(valueSep) + string(l.opts.value), nil
+}
+
+// Lock is a redis distributed lock.
+// It must be used through a pointer, since it keeps the state of the current acquisition.
 type Lock struct {
-	mu        *redsync.Mutex
+	pools     []*redis.Pool
+	lockName  string
+	expiry    time.Duration
 	heartbeat time.Duration
+	opts      options
+
+	m         sync.Mutex
+	acquiring bool
 	done      chan struct{}
+	value     string
+	token     int64
 }
 
-func (l Lock) Lock() (chan struct{}, error) {
-	err := l.mu.Lock()
-	if err == redsync.ErrFailed {
-		return nil, nil
+// driftFactor is the fraction of the expiry reserved for the clock drift between the client and the redis instances
+const driftFactor = 0.01
+
+// lockScript sets the key KEYS[1] with the value ARGV[1], expiring in ARGV[2] milliseconds, if it does not exist,
+// and returns the incremented fence counter KEYS[2]. It returns 0 if the key exists.
+var lockScript = redis.NewScript(2, `
+if not redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 0
+end
+return redis.call('INCR', KEYS[2])
+`)
+
+// fenceScript raises the fence counter KEYS[1] to ARGV[1], if lower
+var fenceScript = redis.NewScript(1, `
+if tonumber(redis.call('GET', KEYS[1]) or '0') < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// touchScript sets the expiration of the key KEYS[1] to ARGV[2] milliseconds, if it still has the value ARGV[1]
+var touchScript = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// deleteScript deletes the key KEYS[1], if it still has the value ARGV[1]
+var deleteScript = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+func (l *Lock) Lock(ctx context.Context) (<-chan struct{}, error) {
+	done, _, err := l.LockWithToken(ctx)
+	return done, err
+}
+
+// LockWithToken is the same as Lock but also returns a fencing token.
+// Tokens increase monotonically with every acquisition of the lock name,
+// so that a storage can reject writes carrying a token lower than the last one it has seen,
+// protecting it from a client that lost the lock without noticing it (eg: a long GC pause).
+//
+// The token is incremented by the same script that acquires the lock, in every instance,
+// and the highest one is then written back to the instances where the lock was acquired,
+// before the acquisition is considered successful.
+// Since any two majorities share an instance, the next holder will always get a higher token,
+// as long as the redis instances do not lose their data.
+func (l *Lock) LockWithToken(ctx context.Context) (<-chan struct{}, int64, error) {
+	l.m.Lock()
+	if l.done != nil || l.acquiring {
+		l.m.Unlock()
+		return nil, 0, fmt.Errorf("lock '%s': %w", l.lockName, lock.ErrAlreadyAcquired)
+	}
+	if err := ctx.Err(); err != nil {
+		l.m.Unlock()
+		return nil, 0, err
 	}
+	l.acquiring = true
+	l.m.Unlock()
+
+	value, token, err := l.acquire()
+
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.acquiring = false
+	if value == "" {
+		return nil, 0, err
+	}
+
+	done := make(chan struct{})
+	l.done = done
+	l.value = value
+	l.token = token
+	go keepAlive(l.heartbeat, done, func() bool {
+		n, _ := onPools(l.pools, func(p *redis.Pool) (bool, error) {
+			return l.touch(p, value)
+		})
+		return n >= quorum(l.pools)
+	}, func() {
+		l.release(done)
+	})
+
+	return done, token, nil
+}
+
+// acquire tries to acquire the lock in the majority of the redis instances, within the validity time of the lock.
+// It returns an empty value if the lock was not acquired.
+func (l *Lock) acquire() (string, int64, error) {
+	value, err := l.genValue()
 	if err != nil {
-		return nil, err
-	}
-
-	l.done = make(chan struct{})
-	go func() {
-		ticker := time.NewTicker(l.heartbeat)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-l.done:
-				l.mu.Unlock()
-				return
-			case <-ticker.C:
-				ok, _ := l.mu.Extend()
-				if !ok {
-					l.Unlock()
-					return
-				}
+		return "", 0, err
+	}
+
+	start := time.Now()
+	var token int64
+	var acquired []*redis.Pool
+	var lastErr error
+	for _, p := range l.pools {
+		t, err := l.lockOn(p, value)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if t > 0 {
+			acquired = append(acquired, p)
+			if t > token {
+				token = t
 			}
 		}
-	}()
+	}
+
+	if len(acquired) >= quorum(l.pools) {
+		n, err := onPools(acquired, func(p *redis.Pool) (bool, error) {
+			return l.raiseFence(p, token)
+		})
+		if err != nil {
+			lastErr = err
+		}
+		validity := l.expiry - time.Duration(float64(l.expiry)*driftFactor)
+		if n >= quorum(l.pools) && time.Since(start) < validity {
+			return value, token, nil
+		}
+	}
+
+	l.deleteAll(value)
+	if lastErr != nil {
+		lastErr = fmt.Errorf("unable to acquire lock '%s': %w", l.lockName, lastErr)
+	}
+	return "", 0, lastErr
+}
+
+// LockWait keeps trying to acquire the lock until it succeeds or the context is done.
+// Between attempts it waits for the backoff delay or for the release notification of the current holder,
+// whatever comes first.
+func (l *Lock) LockWait(ctx context.Context) (<-chan struct{}, error) {
+	return lock.Retry(ctx, l.opts.backoff, l.Lock, l.waitRelease)
+}
+
+// Token returns the fencing token of the current acquisition or 0 if the lock is not held.
+func (l *Lock) Token() int64 {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return l.token
+}
+
+func (l *Lock) fenceKey() string {
+	return l.lockName + ":fence"
+}
+
+// lockOn returns the fencing token if the lock was acquired in the redis instance, or 0 otherwise
+func (l *Lock) lockOn(p *redis.Pool, value string) (int64, error) {
+	conn := p.Get()
+	defer conn.Close()
+	return redis.Int64(lockScript.Do(conn, l.lockName, l.fenceKey(), value, int64(l.expiry/time.Millisecond)))
+}
 
-	return l.done, nil
+func (l *Lock) raiseFence(p *redis.Pool, token int64) (bool, error) {
+	conn := p.Get()
+	defer conn.Close()
+	return redis.Bool(fenceScript.Do(conn, l.fenceKey(), token))
 }
 
-func (l Lock) Unlock() error {
+func (l *Lock) touch(p *redis.Pool, value string) (bool, error) {
+	conn := p.Get()
+	defer conn.Close()
+	return redis.Bool(touchScript.Do(conn, l.lockName, value, int64(l.expiry/time.Millisecond)))
+}
+
+// deleteAll deletes the lock key, if it has value, from all the redis instances.
+// It returns the number of instances where it was deleted and the last error, if any.
+func (l *Lock) deleteAll(value string) (int, error) {
+	return onPools(l.pools, func(p *redis.Pool) (bool, error) {
+		conn := p.Get()
+		defer conn.Close()
+		return redis.Bool(deleteScript.Do(conn, l.lockName, value))
+	})
+}
+
+// quorum returns the number of instances that make a majority
+func quorum(pools []*redis.Pool) int {
+	return len(pools)/2 + 1
+}
+
+// onPools calls fn for every redis instance, returning how many returned true
+// and the last error, if any
+func onPools(pools []*redis.Pool, fn func(*redis.Pool) (bool, error)) (int, error) {
+	var n int
+	var lastErr error
+	for _, p := range pools {
+		ok, err := fn(p)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if ok {
+			n++
+		}
+	}
+	return n, lastErr
+}
+
+func (l *Lock) TryLock(ctx context.Context) (bool, error) {
+	done, err := l.Lock(ctx)
+	return done != nil, err
+}
+
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.m.Lock()
+	done := l.done
+	value := l.value
+	l.m.Unlock()
+
+	if !l.release(done) {
+		return nil
+	}
+	n, err := l.deleteAll(value)
+	if n < quorum(l.pools) && err != nil {
+		return err
+	}
+	publishRelease(l.pools, l.releaseChannel())
+	return nil
+}
+
+func (l *Lock) releaseChannel() string {
+	return l.lockName + ":released"
+}
+
+// waitRelease waits up to timeout for a release notification.
+// It also returns if, after subscribing, the lock key no longer exists in the majority of the instances.
+func (l *Lock) waitRelease(ctx context.Context, timeout time.Duration) error {
+	return waitRelease(ctx, l.pools, l.releaseChannel(), timeout, l.isFree)
+}
+
+// release marks the lock identified by done as no longer held.
+// It returns false if that lock was already released.
+func (l *Lock) release(done chan struct{}) bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if done == nil || l.done != done {
+		return false
+	}
 	close(l.done)
-	_, err := l.mu.Unlock()
-	return err
+	l.done = nil
+	l.value = ""
+	l.token = 0
+	return true
+}
+
+func (l *Lock) Done() <-chan struct{} {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return l.done
+}
+
+// WaitForUnlock blocks until the lock key no longer exists in the majority of the redis instances.
+// It is woken up by release notifications and checks again every heartbeat, in case the lock expired.
+func (l *Lock) WaitForUnlock(ctx context.Context) error {
+	for {
+		free, err := l.isFree()
+		if err != nil {
+			return err
+		}
+		if free {
+			return nil
+		}
+		if err := l.waitRelease(ctx, l.heartbeat); err != nil {
+			return err
+		}
+	}
+}
+
+// Holder returns the value stored by the current holder of the lock, or nil if the lock is free
+// in the majority of the redis instances.
+func (l *Lock) Holder(ctx context.Context) ([]byte, error) {
+	counts := map[string]int{}
+	var lastErr error
+	for _, p := range l.pools {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		v, err := l.get(p)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if v != nil {
+			counts[string(v)]++
+		}
+	}
+	for v, n := range counts {
+		if n >= quorum(l.pools) {
+			i := strings.IndexByte(v, valueSep)
+			return []byte(v[i+1:]), nil
+		}
+	}
+	return nil, lastErr
+}
+
+func (l *Lock) get(p *redis.Pool) ([]byte, error) {
+	conn := p.Get()
+	defer conn.Close()
+	v, err := redis.Bytes(conn.Do("GET", l.lockName))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	return v, err
+}
+
+func (l *Lock) isFree() (bool, error) {
+	var free int
+	var lastErr error
+	for _, p := range l.pools {
+		exists, err := l.exists(p)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !exists {
+			free++
+		}
+	}
+	q := quorum(l.pools)
+	if free >= q {
+		return true, nil
+	}
+	if len(l.pools)-free >= q {
+		return false, nil
+	}
+	return false, lastErr
+}
+
+func (l *Lock) exists(p *redis.Pool) (bool, error) {
+	conn := p.Get()
+	defer conn.Close()
+	return redis.Bool(conn.Do("EXISTS", l.lockName))
 }
@@ -0,0 +1,239 @@
+package redislock_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/gomodule/redigo/redis"
+	"github.com/quintans/toolkit/lock"
+	"github.com/quintans/toolkit/lock/locktest"
+	"github.com/quintans/toolkit/redislock"
+	"github.com/stretchr/testify/require"
+	testcontainers "github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+func Setup(ctx context.Context) (testcontainers.Container, string, error) {
+	tcpPort := "6379"
+	natPort := nat.Port(tcpPort)
+
+	req := testcontainers.ContainerRequest{
+		Image:        "redis:6-alpine",
+		ExposedPorts: []string{tcpPort + "/tcp"},
+		WaitingFor:   wait.ForListeningPort(natPort),
+	}
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	ip, err := container.Host(ctx)
+	if err != nil {
+		container.Terminate(ctx)
+		return nil, "", err
+	}
+	port, err := container.MappedPort(ctx, natPort)
+	if err != nil {
+		container.Terminate(ctx)
+		return nil, "", err
+	}
+	redisAddr := fmt.Sprintf("%s:%s", ip, port.Port())
+
+	return container, redisAddr, nil
+}
+
+func TestRedisConformance(t *testing.T) {
+	ctx := context.Background()
+	container, addr, err := Setup(ctx)
+	require.NoError(t, err)
+	defer container.Terminate(ctx)
+
+	locktest.Run(t, func(t *testing.T, name string) lock.Locker {
+		pool, err := redislock.NewPool([]string{addr})
+		require.NoError(t, err)
+		return pool.NewLock(name, 10*time.Second)
+	})
+}
+
+func TestUnlockNotLocked(t *testing.T) {
+	pool, err := redislock.NewPool([]string{"localhost:6379"})
+	require.NoError(t, err)
+
+	// must not panic or reach redis
+	l := pool.NewLock("not-locked", time.Second)
+	require.NoError(t, l.Unlock(context.Background()))
+	require.Nil(t, l.Done())
+	require.Equal(t, int64(0), l.Token())
+}
+
+func TestFencingToken(t *testing.T) {
+	ctx := context.Background()
+	container, addr, err := Setup(ctx)
+	require.NoError(t, err)
+	defer container.Terminate(ctx)
+
+	pool, err := redislock.NewPool([]string{addr})
+	require.NoError(t, err)
+	l1 := pool.NewLock("fenced", 10*time.Second)
+	l2 := pool.NewLock("fenced", 10*time.Second)
+
+	done, token1, err := l1.LockWithToken(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, done)
+	require.True(t, token1 > 0)
+	require.Equal(t, token1, l1.Token())
+
+	done, token, err := l2.LockWithToken(ctx)
+	require.NoError(t, err)
+	require.Nil(t, done)
+	require.Equal(t, int64(0), token)
+
+	require.NoError(t, l1.Unlock(ctx))
+	require.Equal(t, int64(0), l1.Token())
+
+	done, token2, err := l2.LockWithToken(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, done)
+	require.True(t, token2 > token1, "Expected token %d to be greater than %d", token2, token1)
+	require.NoError(t, l2.Unlock(ctx))
+}
+
+func TestFencingTokenMajority(t *testing.T) {
+	ctx := context.Background()
+	var addrs []string
+	var containers []testcontainers.Container
+	for i := 0; i < 3; i++ {
+		container, addr, err := Setup(ctx)
+		require.NoError(t, err)
+		defer container.Terminate(ctx)
+		addrs = append(addrs, addr)
+		containers = append(containers, container)
+	}
+
+	// the first instance is ahead of the others
+	conn, err := redis.Dial("tcp", addrs[0])
+	require.NoError(t, err)
+	_, err = conn.Do("SET", "fenced:fence", 100)
+	conn.Close()
+	require.NoError(t, err)
+
+	pool, err := redislock.NewPool(addrs)
+	require.NoError(t, err)
+	l1 := pool.NewLock("fenced", 10*time.Second)
+	l2 := pool.NewLock("fenced", 10*time.Second)
+
+	done, token1, err := l1.LockWithToken(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, done)
+	require.Equal(t, int64(101), token1)
+	require.NoError(t, l1.Unlock(ctx))
+
+	// the next token must be higher even without the instance that issued the previous one
+	require.NoError(t, containers[0].Terminate(ctx))
+	done, token2, err := l2.LockWithToken(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, done)
+	require.True(t, token2 > token1, "Expected token %d to be greater than %d", token2, token1)
+	require.NoError(t, l2.Unlock(ctx))
+}
+
+func TestSemaphore(t *testing.T) {
+	ctx := context.Background()
+	container, addr, err := Setup(ctx)
+	require.NoError(t, err)
+	defer container.Terminate(ctx)
+
+	pool, err := redislock.NewPool([]string{addr})
+	require.NoError(t, err)
+
+	t.Run("Conformance", func(t *testing.T) {
+		locktest.Run(t, func(t *testing.T, name string) lock.Locker {
+			return pool.NewSemaphore(name, 1, 10*time.Second)
+		})
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		var sems []lock.Locker
+		for i := 0; i < 4; i++ {
+			sems = append(sems, pool.NewSemaphore("exports", 3, 2*time.Second))
+		}
+		for i := 0; i < 3; i++ {
+			ok, err := sems[i].TryLock(ctx)
+			require.NoError(t, err)
+			require.True(t, ok, "Expected to acquire permit %d", i)
+		}
+		ok, err := sems[3].TryLock(ctx)
+		require.NoError(t, err)
+		require.False(t, ok, "Expected no permits available")
+
+		// permits are kept alive
+		time.Sleep(3 * time.Second)
+		ok, err = sems[3].TryLock(ctx)
+		require.NoError(t, err)
+		require.False(t, ok, "Expected no permits available")
+
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			sems[0].Unlock(ctx)
+		}()
+		done, err := sems[3].LockWait(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, done)
+		for _, s := range sems {
+			require.NoError(t, s.Unlock(ctx))
+		}
+	})
+}
+
+func TestRWLock(t *testing.T) {
+	ctx := context.Background()
+	container, addr, err := Setup(ctx)
+	require.NoError(t, err)
+	defer container.Terminate(ctx)
+
+	pool, err := redislock.NewPool([]string{addr})
+	require.NoError(t, err)
+
+	t.Run("Conformance", func(t *testing.T) {
+		locktest.Run(t, func(t *testing.T, name string) lock.Locker {
+			return pool.NewRWLock(name, 10*time.Second).Locker()
+		})
+	})
+
+	t.Run("ReadWrite", func(t *testing.T) {
+		r1 := pool.NewRWLock("data", 10*time.Second).RLocker()
+		r2 := pool.NewRWLock("data", 10*time.Second).RLocker()
+		w := pool.NewRWLock("data", 10*time.Second).Locker()
+
+		ok, err := r1.TryLock(ctx)
+		require.NoError(t, err)
+		require.True(t, ok, "Expected readers to share the lock")
+		ok, err = r2.TryLock(ctx)
+		require.NoError(t, err)
+		require.True(t, ok, "Expected readers to share the lock")
+		ok, err = w.TryLock(ctx)
+		require.NoError(t, err)
+		require.False(t, ok, "Expected writer to wait for readers")
+
+		require.NoError(t, r1.Unlock(ctx))
+		require.NoError(t, r2.Unlock(ctx))
+		ok, err = w.TryLock(ctx)
+		require.NoError(t, err)
+		require.True(t, ok, "Expected writer to acquire the lock")
+		ok, err = r1.TryLock(ctx)
+		require.NoError(t, err)
+		require.False(t, ok, "Expected reader to wait for writer")
+
+		require.NoError(t, w.Unlock(ctx))
+		ok, err = r1.TryLock(ctx)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.NoError(t, r1.Unlock(ctx))
+	})
+}
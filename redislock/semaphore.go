@@ -0,0 +1,339 @@
+package redislock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/quintans/toolkit/lock"
+)
+
+var _ lock.Locker = &Semaphore{}
+
+// nowScript sets now with the time of the redis server, in milliseconds,
+// so that the expiration of the holders does not depend on the clocks of the clients.
+// Commands are replicated instead of the script, since TIME is not deterministic.
+const nowScript = `
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+`
+
+// acquireScript adds the holder ARGV[1], expiring in ARGV[3] milliseconds, to the sorted set KEYS[1]
+// if the set has less than ARGV[2] live holders (0 for no limit) and the sorted sets KEYS[2:] have no live holders.
+// Expired holders are removed first.
+var acquireScript = redis.NewScript(-1, nowScript+`
+for i = 1, #KEYS do
+	redis.call('ZREMRANGEBYSCORE', KEYS[i], '-inf', now)
+end
+for i = 2, #KEYS do
+	if redis.call('ZCARD', KEYS[i]) > 0 then
+		return 0
+	end
+end
+local limit = tonumber(ARGV[2])
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) and limit > 0 and redis.call('ZCARD', KEYS[1]) >= limit then
+	return 0
+end
+redis.call('ZADD', KEYS[1], now + tonumber(ARGV[3]), ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// extendScript sets the expiration of the holder ARGV[1] to ARGV[2] milliseconds from now, if it did not expire
+var extendScript = redis.NewScript(1, nowScript+`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score or tonumber(score) <= now then
+	return 0
+end
+redis.call('ZADD', KEYS[1], now + tonumber(ARGV[2]), ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+// availableScript returns 1 if the sorted set KEYS[1] has less than ARGV[1] live holders (0 for no limit)
+// and the sorted sets KEYS[2:] have no live holders
+var availableScript = redis.NewScript(-1, nowScript+`
+local live = '(' .. now
+for i = 2, #KEYS do
+	if redis.call('ZCOUNT', KEYS[i], live, '+inf') > 0 then
+		return 0
+	end
+end
+local limit = tonumber(ARGV[1])
+if limit > 0 and redis.call('ZCOUNT', KEYS[1], live, '+inf') >= limit then
+	return 0
+end
+return 1
+`)
+
+// Semaphore is a distributed semaphore allowing up to limit concurrent holders.
+// The holders are kept in a sorted set scored by their expiration time,
+// so that holders that stopped extending their permit are discarded.
+//
+// A Semaphore instance represents one contender and implements lock.Locker,
+// where acquiring the lock means acquiring a permit.
+type Semaphore struct {
+	pools     []*redis.Pool
+	name      string
+	key       string
+	blockers  []string
+	limit     int
+	expiry    time.Duration
+	heartbeat time.Duration
+	opts      options
+
+	m         sync.Mutex
+	acquiring bool
+	id        string
+	done      chan struct{}
+}
+
+// NewSemaphore creates a contender for the named semaphore allowing up to limit holders.
+// The holders are kept in the key {name}.
+func (p Pool) NewSemaphore(name string, limit int, expiry time.Duration, options ...Option) *Semaphore {
+	if limit < 1 {
+		limit = 1
+	}
+	return newSemaphore(p.pools, name, hashTag(name), nil, limit, expiry, options)
+}
+
+// hashTag returns the key {name}, so that all the keys derived from it are in the same slot of a redis cluster,
+// as required by the scripts using several keys
+func hashTag(name string) string {
+	return "{" + name + "}"
+}
+
+func newSemaphore(pools []*redis.Pool, name, key string, blockers []string, limit int, expiry time.Duration, options []Option) *Semaphore {
+	return &Semaphore{
+		pools:     pools,
+		name:      name,
+		key:       key,
+		blockers:  blockers,
+		limit:     limit,
+		expiry:    expiry,
+		heartbeat: expiry / 2,
+		opts:      newOptions(options),
+	}
+}
+
+// RWLock is a distributed read/write lock.
+// Any number of readers can hold the lock, as long as there is no writer.
+// A writer only acquires the lock when there are no readers, so a steady stream of readers can starve the writers.
+type RWLock struct {
+	r *Semaphore
+	w *Semaphore
+}
+
+// NewRWLock creates a contender, for reading and for writing, for the named lock.
+// The holders are kept in the keys {name}:readers and {name}:writer, in the same slot of a redis cluster.
+func (p Pool) NewRWLock(name string, expiry time.Duration, options ...Option) *RWLock {
+	readers := hashTag(name) + ":readers"
+	writer := hashTag(name) + ":writer"
+	return &RWLock{
+		r: newSemaphore(p.pools, name, readers, []string{writer}, 0, expiry, options),
+		w: newSemaphore(p.pools, name, writer, []string{readers}, 1, expiry, options),
+	}
+}
+
+// RLocker returns the contender for the shared read lock
+func (rw *RWLock) RLocker() lock.Locker {
+	return rw.r
+}
+
+// Locker returns the contender for the exclusive write lock
+func (rw *RWLock) Locker() lock.Locker {
+	return rw.w
+}
+
+func (s *Semaphore) Lock(ctx context.Context) (<-chan struct{}, error) {
+	s.m.Lock()
+	if s.done != nil || s.acquiring {
+		s.m.Unlock()
+		return nil, fmt.Errorf("semaphore '%s': %w", s.name, lock.ErrAlreadyAcquired)
+	}
+	if err := ctx.Err(); err != nil {
+		s.m.Unlock()
+		return nil, err
+	}
+	s.acquiring = true
+	s.m.Unlock()
+
+	id, err := s.genID()
+	if err == nil {
+		var n int
+		n, err = s.onQuorum(func(p *redis.Pool) (bool, error) {
+			return s.acquire(p, id)
+		})
+		if n < s.quorum() {
+			s.removeAll(id)
+			id = ""
+		}
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.acquiring = false
+	if id == "" {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	s.id = id
+	s.done = done
+	go keepAlive(s.heartbeat, done, func() bool {
+		n, _ := s.onQuorum(func(p *redis.Pool) (bool, error) {
+			return s.extend(p, id)
+		})
+		return n >= s.quorum()
+	}, func() {
+		s.release(done)
+	})
+
+	return done, nil
+}
+
+// LockWait keeps trying to acquire a permit until it succeeds or the context is done.
+// Between attempts it waits for the backoff delay or for a release notification, whatever comes first.
+func (s *Semaphore) LockWait(ctx context.Context) (<-chan struct{}, error) {
+	return lock.Retry(ctx, s.opts.backoff, s.Lock, s.waitRelease)
+}
+
+func (s *Semaphore) TryLock(ctx context.Context) (bool, error) {
+	done, err := s.Lock(ctx)
+	return done != nil, err
+}
+
+func (s *Semaphore) Unlock(ctx context.Context) error {
+	s.m.Lock()
+	done := s.done
+	id := s.id
+	s.m.Unlock()
+
+	if !s.release(done) {
+		return nil
+	}
+	_, err := s.removeAll(id)
+	publishRelease(s.pools, s.releaseChannel())
+	return err
+}
+
+// release marks the permit identified by done as no longer held.
+// It returns false if that permit was already released.
+func (s *Semaphore) release(done chan struct{}) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if done == nil || s.done != done {
+		return false
+	}
+	close(s.done)
+	s.done = nil
+	s.id = ""
+	return true
+}
+
+func (s *Semaphore) Done() <-chan struct{} {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.done
+}
+
+// WaitForUnlock blocks until a permit is available in the majority of the redis instances.
+// It is woken up by release notifications and checks again every heartbeat, in case a holder expired.
+func (s *Semaphore) WaitForUnlock(ctx context.Context) error {
+	for {
+		free, err := s.isFree()
+		if err != nil {
+			return err
+		}
+		if free {
+			return nil
+		}
+		if err := s.waitRelease(ctx, s.heartbeat); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Semaphore) waitRelease(ctx context.Context, timeout time.Duration) error {
+	return waitRelease(ctx, s.pools, s.releaseChannel(), timeout, s.isFree)
+}
+
+// isFree tells if a permit is available in the majority of the redis instances
+func (s *Semaphore) isFree() (bool, error) {
+	n, err := s.onQuorum(s.available)
+	if n >= s.quorum() {
+		return true, nil
+	}
+	return false, err
+}
+
+func (s *Semaphore) releaseChannel() string {
+	return s.name + ":released"
+}
+
+func (s *Semaphore) genID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
+func (s *Semaphore) quorum() int {
+	return quorum(s.pools)
+}
+
+func (s *Semaphore) onQuorum(fn func(*redis.Pool) (bool, error)) (int, error) {
+	return onPools(s.pools, fn)
+}
+
+func (s *Semaphore) removeAll(id string) (int, error) {
+	return s.onQuorum(func(p *redis.Pool) (bool, error) {
+		conn := p.Get()
+		defer conn.Close()
+		return redis.Bool(conn.Do("ZREM", s.key, id))
+	})
+}
+
+func (s *Semaphore) acquire(p *redis.Pool, id string) (bool, error) {
+	conn := p.Get()
+	defer conn.Close()
+
+	args := s.keys()
+	args = append(args, id, s.limit, int64(s.expiry/time.Millisecond))
+	return redis.Bool(acquireScript.Do(conn, args...))
+}
+
+func (s *Semaphore) extend(p *redis.Pool, id string) (bool, error) {
+	conn := p.Get()
+	defer conn.Close()
+
+	return redis.Bool(extendScript.Do(conn, s.key, id, int64(s.expiry/time.Millisecond)))
+}
+
+// available returns true if a permit can be acquired in the redis instance
+func (s *Semaphore) available(p *redis.Pool) (bool, error) {
+	conn := p.Get()
+	defer conn.Close()
+
+	args := s.keys()
+	args = append(args, s.limit)
+	return redis.Bool(availableScript.Do(conn, args...))
+}
+
+// keys returns the number of keys followed by the key of the semaphore and the keys of the blockers
+func (s *Semaphore) keys() []interface{} {
+	args := make([]interface{}, 0, 2+len(s.blockers)+3)
+	args = append(args, 1+len(s.blockers), s.key)
+	for _, b := range s.blockers {
+		args = append(args, b)
+	}
+	return args
+}
@@ -0,0 +1,128 @@
+package stacktrace
+
+import (
+	"bufio"
+	"bytes"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Goroutine is a goroutine parsed from a goroutine dump
+type Goroutine struct {
+	ID int64
+	// State is the state as reported by the runtime. eg: running, chan receive, IO wait, 2 minutes
+	State  string
+	Frames []Frame
+	// CreatedBy is where the goroutine was created, if known
+	CreatedBy *Frame
+}
+
+// String returns the goroutine header followed by its frames
+func (g Goroutine) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("goroutine ")
+	buf.WriteString(strconv.FormatInt(g.ID, 10))
+	buf.WriteString(" [")
+	buf.WriteString(g.State)
+	buf.WriteString("]:\n")
+	Write(&buf, g.Frames)
+	if g.CreatedBy != nil {
+		buf.WriteString("created by ")
+		buf.WriteString(g.CreatedBy.String())
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// AllGoroutines returns all the goroutines of the program
+func AllGoroutines() []Goroutine {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return ParseGoroutines(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// ParseGoroutines parses a goroutine dump, as returned by runtime.Stack
+func ParseGoroutines(dump []byte) []Goroutine {
+	var goroutines []Goroutine
+	var g *Goroutine
+	var fn string
+	scanner := bufio.NewScanner(bytes.NewReader(dump))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			g = nil
+		case strings.HasPrefix(line, "goroutine "):
+			goroutines = append(goroutines, parseHeader(line))
+			g = &goroutines[len(goroutines)-1]
+			fn = ""
+		case g == nil:
+		case strings.HasPrefix(line, "\t"):
+			// location of the previous function
+			frame := parseLocation(fn, line)
+			if strings.HasPrefix(fn, "created by ") {
+				frame.Function = strings.TrimPrefix(fn, "created by ")
+				g.CreatedBy = &frame
+			} else {
+				g.Frames = append(g.Frames, frame)
+			}
+		default:
+			fn = parseFunction(line)
+		}
+	}
+	return goroutines
+}
+
+// parseHeader parses: goroutine 18 [chan receive, 2 minutes]:
+func parseHeader(line string) Goroutine {
+	g := Goroutine{}
+	line = strings.TrimPrefix(line, "goroutine ")
+	if idx := strings.IndexByte(line, ' '); idx > 0 {
+		g.ID, _ = strconv.ParseInt(line[:idx], 10, 64)
+		line = line[idx+1:]
+	}
+	if start, end := strings.IndexByte(line, '['), strings.LastIndexByte(line, ']'); start >= 0 && end > start {
+		g.State = line[start+1 : end]
+	}
+	return g
+}
+
+// parseFunction parses: github.com/quintans/toolkit/timers.(*Ticker).run(0xc000010000, 0x1)
+// or: created by github.com/quintans/toolkit/timers.NewTicker in goroutine 6
+func parseFunction(line string) string {
+	if strings.HasPrefix(line, "created by ") {
+		if idx := strings.Index(line, " in goroutine "); idx > 0 {
+			line = line[:idx]
+		}
+		return line
+	}
+	if strings.HasSuffix(line, ")") {
+		if idx := strings.LastIndexByte(line, '('); idx > 0 {
+			line = line[:idx]
+		}
+	}
+	return line
+}
+
+// parseLocation parses: \t/home/paulo/toolkit/timers/ticker.go:42 +0x1d
+func parseLocation(fn, line string) Frame {
+	line = strings.TrimSpace(line)
+	if idx := strings.LastIndex(line, " +0x"); idx > 0 {
+		line = line[:idx]
+	}
+	frame := Frame{Function: fn, File: line}
+	if idx := strings.LastIndexByte(line, ':'); idx > 0 {
+		if n, err := strconv.Atoi(line[idx+1:]); err == nil {
+			frame.File = line[:idx]
+			frame.Line = n
+		}
+	}
+	return frame
+}
@@ -0,0 +1,96 @@
+// Package stacktrace resolves and formats stack traces,
+// either from program counters or from goroutine dumps.
+package stacktrace
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+)
+
+// Frame is a resolved stack frame
+type Frame struct {
+	// Function is the fully qualified function name. eg: github.com/quintans/toolkit/faults.New
+	Function string
+	File     string
+	Line     int
+}
+
+// Callers returns the program counters of the calling goroutine, up to depth,
+// skipping skip frames, where 0 is the caller of Callers
+func Callers(skip, depth int) []uintptr {
+	callers := make([]uintptr, depth)
+	length := runtime.Callers(skip+2, callers)
+	return callers[:length]
+}
+
+// Frames resolves the program counters returned by runtime.Callers
+func Frames(callers []uintptr) []Frame {
+	if len(callers) == 0 {
+		return nil
+	}
+	frames := make([]Frame, 0, len(callers))
+	it := runtime.CallersFrames(callers)
+	for {
+		f, more := it.Next()
+		frames = append(frames, Frame{
+			Function: f.Function,
+			File:     f.File,
+			Line:     f.Line,
+		})
+		if !more {
+			break
+		}
+	}
+	return frames
+}
+
+// Package returns the package of the function.
+// eg: github.com/quintans/toolkit/faults.(*Fault).Error -> github.com/quintans/toolkit/faults
+func (f Frame) Package() string {
+	name := f.Function
+	idx := strings.LastIndex(name, "/")
+	if idx < 0 {
+		idx = 0
+	}
+	if dot := strings.Index(name[idx:], "."); dot >= 0 {
+		return name[:idx+dot]
+	}
+	return name
+}
+
+// ShortFunction returns the function name without the package and receiver.
+// eg: github.com/quintans/toolkit/faults.(*Fault).Error -> Error
+func (f Frame) ShortFunction() string {
+	name := f.Function
+	if idx := strings.LastIndex(name, "."); idx > 0 {
+		return name[idx+1:]
+	}
+	return name
+}
+
+// PackageFile returns the file name prefixed by the package.
+// eg: /home/paulo/go/src/toolkit/faults/fault.go -> github.com/quintans/toolkit/faults/fault.go
+func (f Frame) PackageFile() string {
+	file := f.File
+	if idx := strings.LastIndex(file, "/"); idx >= 0 {
+		file = file[idx+1:]
+	}
+	return f.Package() + "/" + file
+}
+
+// String returns the frame as file:line function()
+func (f Frame) String() string {
+	if f.Function == "" {
+		return "n/a"
+	}
+	return fmt.Sprintf("%s:%v %s()", f.File, f.Line, f.ShortFunction())
+}
+
+// Write writes the frames, one per line, as returned by Frame.String
+func Write(w io.Writer, frames []Frame) {
+	for _, f := range frames {
+		fmt.Fprintln(w, f.String())
+	}
+}
@@ -0,0 +1,53 @@
+package stacktrace_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/quintans/toolkit/stacktrace"
+	"github.com/stretchr/testify/require"
+)
+
+const dump = `goroutine 7 [running]:
+main.main()
+	/home/paulo/app/main.go:10 +0x1d
+
+goroutine 18 [chan receive, 2 minutes]:
+github.com/quintans/toolkit/timers.(*Ticker).run(0xc000010000, 0x1)
+	/home/paulo/toolkit/timers/ticker.go:42 +0x65
+created by github.com/quintans/toolkit/timers.NewTicker in goroutine 7
+	/home/paulo/toolkit/timers/ticker.go:20 +0x9a
+`
+
+func TestParseGoroutines(t *testing.T) {
+	goroutines := stacktrace.ParseGoroutines([]byte(dump))
+	require.Len(t, goroutines, 2)
+
+	g := goroutines[1]
+	require.Equal(t, int64(18), g.ID)
+	require.Equal(t, "chan receive, 2 minutes", g.State)
+	require.Equal(t, []stacktrace.Frame{{
+		Function: "github.com/quintans/toolkit/timers.(*Ticker).run",
+		File:     "/home/paulo/toolkit/timers/ticker.go",
+		Line:     42,
+	}}, g.Frames)
+	require.NotNil(t, g.CreatedBy)
+	require.Equal(t, "github.com/quintans/toolkit/timers.NewTicker", g.CreatedBy.Function)
+	require.Equal(t, 20, g.CreatedBy.Line)
+
+	f := g.Frames[0]
+	require.Equal(t, "github.com/quintans/toolkit/timers", f.Package())
+	require.Equal(t, "run", f.ShortFunction())
+	require.Equal(t, "github.com/quintans/toolkit/timers/ticker.go", f.PackageFile())
+	require.Equal(t, "/home/paulo/toolkit/timers/ticker.go:42 run()", f.String())
+}
+
+func TestCallers(t *testing.T) {
+	frames := stacktrace.Frames(stacktrace.Callers(0, 10))
+	require.True(t, len(frames) > 0)
+	require.True(t, strings.HasSuffix(frames[0].Function, "TestCallers"), frames[0].Function)
+
+	current := stacktrace.AllGoroutines()[0]
+	require.True(t, strings.HasSuffix(current.Frames[len(current.Frames)-2].Function, "TestCallers") ||
+		strings.Contains(current.String(), "TestCallers"))
+}
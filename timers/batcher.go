@@ -0,0 +1,188 @@
+package timers
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/quintans/toolkit/clock"
+)
+
+// ErrClosed is returned when using a closed Batcher
+var ErrClosed = errors.New("closed")
+
+// Batcher accumulates items and flushes them in batches,
+// whenever the batch reaches a max size or the first item of the batch has waited for a max time.
+type Batcher struct {
+	mu     sync.Mutex
+	items  []interface{}
+	gen    int
+	timer  *timerEntry
+	closed bool
+	// batches are flushed in the order they were taken
+	tickets uint64
+	flushMu sync.Mutex
+	flushed *sync.Cond
+	serving uint64
+	// timer triggered flushes in progress
+	wg sync.WaitGroup
+
+	maxSize int
+	maxWait time.Duration
+	flush   func(items []interface{}) error
+	onError func(err error, items []interface{})
+	timers  *timerQueue
+}
+
+// BatcherOption configures a Batcher
+type BatcherOption func(*Batcher)
+
+// BatchMaxSize sets the number of items that triggers a flush. Default is 100.
+func BatchMaxSize(size int) BatcherOption {
+	return func(b *Batcher) {
+		if size > 0 {
+			b.maxSize = size
+		}
+	}
+}
+
+// BatchMaxWait sets the max time an item waits before being flushed. Default is 1s.
+// A zero value disables the time triggered flush.
+func BatchMaxWait(maxWait time.Duration) BatcherOption {
+	return func(b *Batcher) {
+		b.maxWait = maxWait
+	}
+}
+
+// BatchOnError sets the callback for errors returned by time triggered flushes.
+// Errors of flushes triggered by Add, Flush or Close are returned to the caller.
+func BatchOnError(onError func(err error, items []interface{})) BatcherOption {
+	return func(b *Batcher) {
+		b.onError = onError
+	}
+}
+
+// BatchClock sets the clock used by the max wait timer
+func BatchClock(c clock.Clock) BatcherOption {
+	return func(b *Batcher) {
+		b.timers = timerQueueFor(c)
+	}
+}
+
+// NewBatcher creates a Batcher that calls flush with the accumulated items.
+// Flushes never run concurrently.
+func NewBatcher(flush func(items []interface{}) error, options ...BatcherOption) *Batcher {
+	b := &Batcher{
+		maxSize: 100,
+		maxWait: time.Second,
+		flush:   flush,
+		timers:  defaultTimerQueue,
+	}
+	for _, o := range options {
+		o(b)
+	}
+	b.items = make([]interface{}, 0, b.maxSize)
+	b.flushed = sync.NewCond(&b.flushMu)
+	return b
+}
+
+// Add adds an item to the current batch.
+// If the batch reaches the max size it is flushed in the caller goroutine.
+func (b *Batcher) Add(item interface{}) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	b.items = append(b.items, item)
+	if len(b.items) == 1 && b.maxWait > 0 {
+		gen := b.gen
+		b.timer = b.timers.schedule(b.maxWait, nil, func() {
+			b.timeout(gen)
+		})
+	}
+	if len(b.items) < b.maxSize {
+		b.mu.Unlock()
+		return nil
+	}
+
+	items, ticket := b.take()
+	b.mu.Unlock()
+
+	return b.flushInOrder(items, ticket)
+}
+
+// Flush flushes the current batch, if not empty, after the batches taken before it
+func (b *Batcher) Flush() error {
+	b.mu.Lock()
+	items, ticket := b.take()
+	b.mu.Unlock()
+
+	return b.flushInOrder(items, ticket)
+}
+
+// Close flushes the pending items, waits for in-flight flushes and rejects new items.
+func (b *Batcher) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	err := b.Flush()
+	b.wg.Wait()
+	return err
+}
+
+// take returns the current batch, with its position in the flush order, and starts a new one.
+// Must be called with mu held.
+func (b *Batcher) take() ([]interface{}, uint64) {
+	b.timers.cancel(b.timer)
+	b.timer = nil
+	b.gen++
+	items := b.items
+	b.items = make([]interface{}, 0, b.maxSize)
+	ticket := b.tickets
+	b.tickets++
+	return items, ticket
+}
+
+// flushInOrder waits for the batches taken before this one to be flushed and then flushes items, if not empty.
+func (b *Batcher) flushInOrder(items []interface{}, ticket uint64) error {
+	b.flushMu.Lock()
+	for b.serving != ticket {
+		b.flushed.Wait()
+	}
+	b.flushMu.Unlock()
+
+	defer func() {
+		b.flushMu.Lock()
+		b.serving++
+		b.flushed.Broadcast()
+		b.flushMu.Unlock()
+	}()
+
+	if len(items) == 0 {
+		return nil
+	}
+	return b.flush(items)
+}
+
+func (b *Batcher) timeout(gen int) {
+	b.mu.Lock()
+	// stale timer
+	if gen != b.gen || len(b.items) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	b.wg.Add(1)
+	defer b.wg.Done()
+	items, ticket := b.take()
+	b.mu.Unlock()
+
+	if err := b.flushInOrder(items, ticket); err != nil && b.onError != nil {
+		b.onError(err, items)
+	}
+}
@@ -0,0 +1,200 @@
+package timers
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/quintans/toolkit/clock"
+)
+
+func TestBatcherMaxSize(t *testing.T) {
+	var batches [][]interface{}
+	b := NewBatcher(func(items []interface{}) error {
+		batches = append(batches, items)
+		return nil
+	}, BatchMaxSize(3), BatchMaxWait(time.Hour))
+
+	for i := 0; i < 7; i++ {
+		if err := b.Add(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(batches) != 2 {
+		t.Fatal("Expected 2 batches, got", len(batches))
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 3 || len(batches[2]) != 1 || batches[2][0] != 6 {
+		t.Fatal("Expected last batch to be drained on close, got", batches)
+	}
+	if err := b.Add(7); err != ErrClosed {
+		t.Fatal("Expected ErrClosed, got", err)
+	}
+}
+
+func TestBatcherMaxWait(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	ch := make(chan []interface{}, 1)
+	b := NewBatcher(func(items []interface{}) error {
+		ch <- items
+		return errors.New("boom")
+	}, BatchMaxWait(100*time.Millisecond), BatchOnError(func(err error, items []interface{}) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}))
+	defer b.Close()
+
+	b.Add("a")
+	b.Add("b")
+	select {
+	case items := <-ch:
+		if len(items) != 2 {
+			t.Fatal("Expected 2 items, got", items)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a time triggered flush")
+	}
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 1 {
+		t.Fatal("Expected flush error to be reported, got", errs)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	var mu sync.Mutex
+	var calls []interface{}
+	th := NewThrottle(100*time.Millisecond, func(arg interface{}) {
+		mu.Lock()
+		calls = append(calls, arg)
+		mu.Unlock()
+	})
+	defer th.Stop()
+
+	for i := 0; i < 5; i++ {
+		th.Call(i)
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 2 || calls[0] != 0 || calls[1] != 4 {
+		t.Fatal("Expected leading 0 and trailing 4, got", calls)
+	}
+}
+
+func TestKeyedDebounce(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]interface{}{}
+	cnt := 0
+	k := NewKeyedDebounce(100*time.Millisecond, func(key string, arg interface{}) {
+		mu.Lock()
+		calls[key] = arg
+		cnt++
+		mu.Unlock()
+	})
+	defer k.Kill()
+
+	for i := 0; i < 3; i++ {
+		k.Delay("a", i)
+		k.Delay("b", i*10)
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if cnt != 2 || calls["a"] != 2 || calls["b"] != 20 {
+		t.Fatal("Expected one call per key with the last value, got", calls)
+	}
+	if k.Pending() != 0 {
+		t.Fatal("Expected no pending keys, got", k.Pending())
+	}
+}
+
+func TestBatcherFakeClock(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	ch := make(chan []interface{}, 1)
+	b := NewBatcher(func(items []interface{}) error {
+		ch <- items
+		return nil
+	}, BatchMaxWait(time.Minute), BatchClock(clk))
+	defer b.Close()
+
+	b.Add("a")
+	clk.Advance(30 * time.Second)
+	select {
+	case <-ch:
+		t.Fatal("Unexpected flush")
+	case <-time.After(20 * time.Millisecond):
+	}
+	clk.Advance(30 * time.Second)
+	select {
+	case items := <-ch:
+		if len(items) != 1 {
+			t.Fatal("Expected 1 item, got", items)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a time triggered flush")
+	}
+}
+
+func TestBatcherAddDuringFlush(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]interface{}
+	release := make(chan struct{})
+	b := NewBatcher(func(items []interface{}) error {
+		if items[0] == 0 {
+			<-release
+		}
+		mu.Lock()
+		batches = append(batches, items)
+		mu.Unlock()
+		return nil
+	}, BatchMaxSize(2), BatchMaxWait(time.Hour))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.Add(0)
+		b.Add(1)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.Add(2)
+		b.Add(3)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	added := make(chan struct{})
+	go func() {
+		b.Add(4)
+		close(added)
+	}()
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Add not to wait for the flushes in progress")
+	}
+
+	close(release)
+	wg.Wait()
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches) != 3 || batches[0][0] != 0 || batches[1][0] != 2 || batches[2][0] != 4 {
+		t.Fatal("Expected batches in order, got", batches)
+	}
+}
@@ -0,0 +1,46 @@
+package timers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	var tests = []struct {
+		spec     string
+		from     string
+		expected string
+	}{
+		{"* * * * *", "2020-01-01T10:00:30Z", "2020-01-01T10:01:00Z"},
+		{"*/15 * * * *", "2020-01-01T10:07:00Z", "2020-01-01T10:15:00Z"},
+		{"30 9 * * MON-FRI", "2020-01-03T10:00:00Z", "2020-01-06T09:30:00Z"},
+		{"0 0 1 JAN *", "2020-06-01T00:00:00Z", "2021-01-01T00:00:00Z"},
+		{"0 12 29 2 *", "2021-01-01T00:00:00Z", "2024-02-29T12:00:00Z"},
+		{"0 0 13 * 5", "2020-03-01T00:00:00Z", "2020-03-06T00:00:00Z"},
+		{"*/10 * * * * *", "2020-01-01T10:00:01Z", "2020-01-01T10:00:10Z"},
+		{"@daily", "2020-01-01T10:00:00Z", "2020-01-02T00:00:00Z"},
+		{"@every 90s", "2020-01-01T10:00:00Z", "2020-01-01T10:01:30Z"},
+		{"0 0 * * 7", "2020-01-01T00:00:00Z", "2020-01-05T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.spec, err)
+		}
+		from, _ := time.Parse(time.RFC3339, tt.from)
+		expected, _ := time.Parse(time.RFC3339, tt.expected)
+		next := s.Next(from)
+		if !next.Equal(expected) {
+			t.Errorf("%s: expected %s, got %s", tt.spec, expected, next)
+		}
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "@every -1s", "* * * FOO *"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("expected error for '%s'", spec)
+		}
+	}
+}
@@ -3,47 +3,149 @@ package timers
 import (
 	"sync"
 	"time"
+
+	"github.com/quintans/toolkit/clock"
 )
 
-// Debouncer struct to support debouncing
+// Debouncer struct to support debouncing.
+// A burst of calls to Delay, where each call is separated by less than the interval,
+// results in a single execution of the action.
+// The Debouncer can be reused for any number of bursts until it is killed.
 type Debouncer struct {
 	once   sync.Once
 	input  chan interface{}
 	OnExit func()
+
+	interval time.Duration
+	action   func(arg interface{})
+	leading  bool
+	trailing bool
+	maxWait  time.Duration
+	clock    clock.Clock
+}
+
+// DebounceOption configures a Debouncer
+type DebounceOption func(*Debouncer)
+
+// DebounceLeading sets if the action is executed at the start of a burst, with the first item. Default is false.
+func DebounceLeading(leading bool) DebounceOption {
+	return func(d *Debouncer) {
+		d.leading = leading
+	}
+}
+
+// DebounceTrailing sets if the action is executed at the end of a burst, with the last item. Default is true.
+func DebounceTrailing(trailing bool) DebounceOption {
+	return func(d *Debouncer) {
+		d.trailing = trailing
+	}
+}
+
+// DebounceMaxWait sets the maximum time the action can be delayed during a continuous burst.
+// When it is reached, the action is executed with the last item and a new wait period starts.
+func DebounceMaxWait(maxWait time.Duration) DebounceOption {
+	return func(d *Debouncer) {
+		d.maxWait = maxWait
+	}
+}
+
+// DebounceClock sets the clock used by the timers
+func DebounceClock(c clock.Clock) DebounceOption {
+	return func(d *Debouncer) {
+		d.clock = c
+	}
 }
 
 // NewDebounce creates a new Debouncer
-func NewDebounce(interval time.Duration, action func(arg interface{})) *Debouncer {
-	d := &Debouncer{}
-	d.input = make(chan interface{}, 10)
-
-	go func() {
-		// clean up
-		defer func() {
-			if d.OnExit != nil {
-				d.OnExit()
+func NewDebounce(interval time.Duration, action func(arg interface{}), options ...DebounceOption) *Debouncer {
+	d := &Debouncer{
+		input:    make(chan interface{}, 10),
+		interval: interval,
+		action:   action,
+		trailing: true,
+	}
+	for _, o := range options {
+		o(d)
+	}
+	d.clock = clock.OrDefault(d.clock)
+
+	go d.run()
+
+	return d
+}
+
+func (d *Debouncer) run() {
+	var timer, maxTimer clock.Timer
+	var timerC, maxC <-chan time.Time
+	// clean up
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		if maxTimer != nil {
+			maxTimer.Stop()
+		}
+		if d.OnExit != nil {
+			d.OnExit()
+		}
+	}()
+
+	var item interface{}
+	var pending, active bool
+	for {
+		select {
+		case it, ok := <-d.input:
+			if !ok {
+				// was closed
+				return
 			}
-		}()
-
-		var item interface{}
-		var ok bool
-		t := time.NewTimer(interval)
-		for {
-			select {
-			case item, ok = <-d.input:
-				if !ok {
-					// was closed
-					return
+			if !active {
+				// start of a burst
+				active = true
+				if d.leading {
+					d.action(it)
+				} else {
+					item = it
+					pending = true
 				}
-				t.Reset(interval)
-			case <-t.C:
-				action(item)
-				return
+				if d.maxWait > 0 {
+					maxTimer = d.clock.NewTimer(d.maxWait)
+					maxC = maxTimer.C()
+				}
+			} else {
+				item = it
+				pending = true
 			}
-		}
-	}()
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = d.clock.NewTimer(d.interval)
+			timerC = timer.C()
 
-	return d
+		case <-timerC:
+			// end of the burst
+			timerC = nil
+			if maxTimer != nil {
+				maxTimer.Stop()
+				maxC = nil
+			}
+			if d.trailing && pending {
+				d.action(item)
+			}
+			item = nil
+			pending = false
+			active = false
+
+		case <-maxC:
+			if pending {
+				d.action(item)
+				item = nil
+				pending = false
+			}
+			maxTimer = d.clock.NewTimer(d.maxWait)
+			maxC = maxTimer.C()
+		}
+	}
 }
 
 // Delay delays the execution of action declared when we created the debouncer
@@ -25,3 +25,43 @@ func TestDebounce(t *testing.T) {
 		t.Fatal("Expected 'c', got ", s)
 	}
 }
+
+func TestDebounceReuse(t *testing.T) {
+	ch := make(chan interface{}, 2)
+	d := NewDebounce(100*time.Millisecond, func(arg interface{}) {
+		ch <- arg
+	})
+	defer d.Kill()
+
+	d.Delay("a")
+	if r := <-ch; r != "a" {
+		t.Fatal("Expected 'a', got ", r)
+	}
+	d.Delay("b")
+	if r := <-ch; r != "b" {
+		t.Fatal("Expected 'b', got ", r)
+	}
+}
+
+func TestDebounceLeadingMaxWait(t *testing.T) {
+	ch := make(chan interface{}, 10)
+	d := NewDebounce(100*time.Millisecond, func(arg interface{}) {
+		ch <- arg
+	}, DebounceLeading(true), DebounceTrailing(false), DebounceMaxWait(250*time.Millisecond))
+	defer d.Kill()
+
+	for i := 0; i < 8; i++ {
+		d.Delay(i)
+		time.Sleep(50 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	// leading edge with 0 and then one call for each max wait period
+	var got []interface{}
+	for len(ch) > 0 {
+		got = append(got, <-ch)
+	}
+	if len(got) < 2 || got[0] != 0 {
+		t.Fatal("Expected leading call with 0 followed by max wait calls, got", got)
+	}
+}
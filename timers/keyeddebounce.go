@@ -0,0 +1,165 @@
+package timers
+
+import (
+	"sync"
+	"time"
+)
+
+// KeyedDebouncer debounces events per key.
+// A burst of calls to Delay for the same key results in a single execution of the action for that key.
+// It accepts the same options as Debouncer.
+// Executions of the action never overlap, even for different keys, so the action must not call Delay.
+type KeyedDebouncer struct {
+	mu      sync.Mutex
+	serial  serializer
+	entries map[string]*keyedEntry
+	gen     int
+
+	interval time.Duration
+	action   func(key string, arg interface{})
+	leading  bool
+	trailing bool
+	maxWait  time.Duration
+	timers   *timerQueue
+}
+
+type keyedEntry struct {
+	item     interface{}
+	pending  bool
+	timer    *timerEntry
+	maxTimer *timerEntry
+	// generation of the burst, to discard stale callbacks
+	gen int
+	// sequence of the quiet timer, since it is rescheduled on every call
+	seq int
+}
+
+// NewKeyedDebounce creates a new KeyedDebouncer
+func NewKeyedDebounce(interval time.Duration, action func(key string, arg interface{}), options ...DebounceOption) *KeyedDebouncer {
+	cfg := &Debouncer{
+		trailing: true,
+	}
+	for _, o := range options {
+		o(cfg)
+	}
+	return &KeyedDebouncer{
+		entries:  make(map[string]*keyedEntry),
+		interval: interval,
+		action:   action,
+		leading:  cfg.leading,
+		trailing: cfg.trailing,
+		maxWait:  cfg.maxWait,
+		timers:   timerQueueFor(cfg.clock),
+	}
+}
+
+// Delay delays the execution of the action for the key.
+// A leading execution runs in the caller goroutine, after any execution in progress returns.
+func (k *KeyedDebouncer) Delay(key string, item interface{}) {
+	k.mu.Lock()
+	e, ok := k.entries[key]
+	fire := false
+	if !ok {
+		// start of a burst
+		k.gen++
+		e = &keyedEntry{gen: k.gen}
+		k.entries[key] = e
+		if k.leading {
+			fire = true
+		} else {
+			e.item = item
+			e.pending = true
+		}
+		if k.maxWait > 0 {
+			k.scheduleMax(key, e)
+		}
+	} else {
+		e.item = item
+		e.pending = true
+	}
+
+	k.timers.cancel(e.timer)
+	e.seq++
+	gen, seq := e.gen, e.seq
+	e.timer = k.timers.schedule(k.interval, &k.serial, func() {
+		k.quiet(key, gen, seq)
+	})
+	k.mu.Unlock()
+
+	if fire {
+		k.serial.do(func() {
+			k.action(key, item)
+		})
+	}
+}
+
+// Pending returns the number of keys with an active burst
+func (k *KeyedDebouncer) Pending() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.entries)
+}
+
+// Kill discards all pending executions
+func (k *KeyedDebouncer) Kill() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for key, e := range k.entries {
+		k.timers.cancel(e.timer)
+		k.timers.cancel(e.maxTimer)
+		delete(k.entries, key)
+	}
+}
+
+// scheduleMax must be called with mu held
+func (k *KeyedDebouncer) scheduleMax(key string, e *keyedEntry) {
+	gen := e.gen
+	e.maxTimer = k.timers.schedule(k.maxWait, &k.serial, func() {
+		k.max(key, gen)
+	})
+}
+
+// entry returns the entry for the key if it belongs to the generation. Must be called with mu held.
+func (k *KeyedDebouncer) entry(key string, gen int) *keyedEntry {
+	e, ok := k.entries[key]
+	if !ok || e.gen != gen {
+		return nil
+	}
+	return e
+}
+
+func (k *KeyedDebouncer) quiet(key string, gen, seq int) {
+	k.mu.Lock()
+	e := k.entry(key, gen)
+	if e == nil || e.seq != seq {
+		k.mu.Unlock()
+		return
+	}
+	// end of the burst
+	delete(k.entries, key)
+	k.timers.cancel(e.maxTimer)
+	k.mu.Unlock()
+
+	if k.trailing && e.pending {
+		k.action(key, e.item)
+	}
+}
+
+func (k *KeyedDebouncer) max(key string, gen int) {
+	k.mu.Lock()
+	e := k.entry(key, gen)
+	if e == nil {
+		k.mu.Unlock()
+		return
+	}
+	item, pending := e.item, e.pending
+	e.item = nil
+	e.pending = false
+	k.scheduleMax(key, e)
+	k.mu.Unlock()
+
+	if pending {
+		k.action(key, item)
+	}
+}
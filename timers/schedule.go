@@ -0,0 +1,49 @@
+package timers
+
+import (
+	"time"
+)
+
+// Schedule describes when a job should run.
+type Schedule interface {
+	// Next returns the next activation time after t.
+	// A zero time means that there are no more activations.
+	Next(t time.Time) time.Time
+}
+
+// Delayed can be implemented by a Schedule whose next activation must be computed
+// from the time the handler returns, instead of from the previous activation.
+// Such schedules never overlap, so the OverlapPolicy of the job is ignored.
+type Delayed interface {
+	Delayed() bool
+}
+
+type every time.Duration
+
+// Every returns a fixed rate schedule.
+// Activations are spaced by interval, measured from the previous scheduled activation,
+// regardless of how long the handler takes.
+func Every(interval time.Duration) Schedule {
+	return every(interval)
+}
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+type fixedDelay time.Duration
+
+// FixedDelay returns a fixed delay schedule.
+// The next activation is computed only after the handler returns,
+// so there is always at least delay between the end of one run and the start of the next.
+func FixedDelay(delay time.Duration) Schedule {
+	return fixedDelay(delay)
+}
+
+func (f fixedDelay) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(f))
+}
+
+func (f fixedDelay) Delayed() bool {
+	return true
+}
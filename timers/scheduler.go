@@ -0,0 +1,242 @@
+package timers
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quintans/toolkit/clock"
+)
+
+// OverlapPolicy defines what happens when an activation occurs while the previous run is still executing
+type OverlapPolicy int
+
+const (
+	// OverlapSkip discards the activation if the previous run is still executing
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue queues the activation to be executed after the previous run finishes.
+	// If the queue is full the activation is discarded.
+	OverlapQueue
+	// OverlapConcurrent executes the activation concurrently with the previous run
+	OverlapConcurrent
+)
+
+// JobOption configures a Job
+type JobOption func(*Job)
+
+// WithOverlap sets the overlap policy. Default is OverlapSkip.
+// It has no effect on Delayed schedules, like FixedDelay, since they never overlap.
+func WithOverlap(policy OverlapPolicy) JobOption {
+	return func(j *Job) {
+		j.overlap = policy
+	}
+}
+
+// WithQueueSize sets the max number of pending activations when using OverlapQueue. Default is 1.
+func WithQueueSize(size int) JobOption {
+	return func(j *Job) {
+		if size > 0 {
+			j.queueSize = size
+		}
+	}
+}
+
+// WithJitter delays every activation by a random duration in [0, max).
+// The jitter is not accumulated: activations are always computed from the nominal schedule.
+func WithJitter(max time.Duration) JobOption {
+	return func(j *Job) {
+		j.jitter = max
+	}
+}
+
+// WithInitialDelay sets the time of the first activation, relative to the start of the job,
+// instead of using the schedule. A zero delay runs the handler immediately.
+func WithInitialDelay(delay time.Duration) JobOption {
+	return func(j *Job) {
+		j.initialDelay = &delay
+	}
+}
+
+// WithClock sets the clock used to compute and wait for the activations
+func WithClock(c clock.Clock) JobOption {
+	return func(j *Job) {
+		j.clock = clock.OrDefault(c)
+	}
+}
+
+// Job is a handler being executed according to a Schedule
+type Job struct {
+	schedule     Schedule
+	handler      func(context.Context, time.Time)
+	overlap      OverlapPolicy
+	queueSize    int
+	jitter       time.Duration
+	initialDelay *time.Duration
+	clock        clock.Clock
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running int32
+	// running handlers
+	wg   sync.WaitGroup
+	done chan struct{}
+}
+
+// NewJob starts executing hnd according to schedule until ctx is cancelled or Stop is called.
+// The context passed to the handler is cancelled when the job stops.
+func NewJob(ctx context.Context, schedule Schedule, hnd func(context.Context, time.Time), options ...JobOption) *Job {
+	j := &Job{
+		schedule:  schedule,
+		handler:   hnd,
+		overlap:   OverlapSkip,
+		queueSize: 1,
+		clock:     clock.New(),
+		done:      make(chan struct{}),
+	}
+	for _, o := range options {
+		o(j)
+	}
+	j.ctx, j.cancel = context.WithCancel(ctx)
+
+	go j.run()
+
+	return j
+}
+
+// Stop stops the job and waits for the running handlers to return
+func (j *Job) Stop() {
+	j.cancel()
+	<-j.done
+}
+
+// Done returns a channel that is closed when the job has stopped and all handlers have returned
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+func (j *Job) run() {
+	defer close(j.done)
+	defer j.wg.Wait()
+
+	var queue chan time.Time
+	if j.overlap == OverlapQueue {
+		queue = make(chan time.Time, j.queueSize)
+		j.wg.Add(1)
+		go func() {
+			defer j.wg.Done()
+			for {
+				select {
+				case <-j.ctx.Done():
+					return
+				case t := <-queue:
+					j.handler(j.ctx, t)
+				}
+			}
+		}()
+	}
+
+	d, ok := j.schedule.(Delayed)
+	delayed := ok && d.Delayed()
+	var nominal time.Time
+	if j.initialDelay != nil {
+		nominal = j.clock.Now().Add(*j.initialDelay)
+	} else {
+		nominal = j.schedule.Next(j.clock.Now())
+	}
+	for !nominal.IsZero() {
+		timer := j.clock.NewTimer(nominal.Add(j.randomJitter()).Sub(j.clock.Now()))
+		select {
+		case <-j.ctx.Done():
+			timer.Stop()
+			return
+		case t := <-timer.C():
+			if delayed {
+				j.handler(j.ctx, t)
+				nominal = j.schedule.Next(j.clock.Now())
+				continue
+			}
+
+			j.fire(t, queue)
+			nominal = j.schedule.Next(nominal)
+			// if we fell behind we do not try to catch up
+			if now := j.clock.Now(); nominal.Before(now) {
+				nominal = j.schedule.Next(now)
+			}
+		}
+	}
+}
+
+func (j *Job) randomJitter() time.Duration {
+	if j.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(j.jitter)))
+}
+
+func (j *Job) fire(t time.Time, queue chan time.Time) {
+	switch j.overlap {
+	case OverlapQueue:
+		select {
+		case queue <- t:
+		default:
+		}
+	case OverlapConcurrent:
+		j.wg.Add(1)
+		go func() {
+			defer j.wg.Done()
+			j.handler(j.ctx, t)
+		}()
+	default:
+		if !atomic.CompareAndSwapInt32(&j.running, 0, 1) {
+			return
+		}
+		j.wg.Add(1)
+		go func() {
+			defer j.wg.Done()
+			defer atomic.StoreInt32(&j.running, 0)
+			j.handler(j.ctx, t)
+		}()
+	}
+}
+
+// Scheduler manages a group of jobs that share the same lifecycle
+type Scheduler struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates a Scheduler. All jobs are stopped when ctx is cancelled or Stop is called.
+func NewScheduler(ctx context.Context) *Scheduler {
+	s := &Scheduler{}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	return s
+}
+
+// Schedule starts a new job
+func (s *Scheduler) Schedule(schedule Schedule, hnd func(context.Context, time.Time), options ...JobOption) *Job {
+	j := NewJob(s.ctx, schedule, hnd, options...)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		<-j.Done()
+	}()
+	return j
+}
+
+// ScheduleCron starts a new job using a cron expression. See ParseCron.
+func (s *Scheduler) ScheduleCron(spec string, hnd func(context.Context, time.Time), options ...JobOption) (*Job, error) {
+	schedule, err := ParseCron(spec)
+	if err != nil {
+		return nil, err
+	}
+	return s.Schedule(schedule, hnd, options...), nil
+}
+
+// Stop stops all jobs and waits for their handlers to return
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
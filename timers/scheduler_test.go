@@ -0,0 +1,83 @@
+package timers
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quintans/toolkit/leaktest"
+)
+
+func TestJobOverlapSkip(t *testing.T) {
+	var cnt int32
+	job := NewJob(context.Background(), Every(100*time.Millisecond), func(ctx context.Context, _ time.Time) {
+		atomic.AddInt32(&cnt, 1)
+		select {
+		case <-ctx.Done():
+		case <-time.After(250 * time.Millisecond):
+		}
+	})
+	time.Sleep(550 * time.Millisecond)
+	job.Stop()
+
+	// runs at 100ms and 400ms. Ticks at 200, 300 and 500 are skipped
+	if c := atomic.LoadInt32(&cnt); c != 2 {
+		t.Fatal("Expected 2 runs, got", c)
+	}
+}
+
+func TestJobOverlapConcurrent(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	var cnt int32
+	job := NewJob(context.Background(), Every(100*time.Millisecond), func(ctx context.Context, _ time.Time) {
+		atomic.AddInt32(&cnt, 1)
+		<-ctx.Done()
+	}, WithOverlap(OverlapConcurrent))
+	time.Sleep(350 * time.Millisecond)
+	job.Stop()
+
+	if c := atomic.LoadInt32(&cnt); c != 3 {
+		t.Fatal("Expected 3 runs, got", c)
+	}
+}
+
+func TestJobFixedDelay(t *testing.T) {
+	var cnt int32
+	job := NewJob(context.Background(), FixedDelay(100*time.Millisecond), func(_ context.Context, _ time.Time) {
+		atomic.AddInt32(&cnt, 1)
+		time.Sleep(100 * time.Millisecond)
+	}, WithInitialDelay(0))
+	time.Sleep(450 * time.Millisecond)
+	job.Stop()
+
+	// runs at 0, 200 and 400ms
+	if c := atomic.LoadInt32(&cnt); c != 3 {
+		t.Fatal("Expected 3 runs, got", c)
+	}
+}
+
+func TestSchedulerStopOnContext(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewScheduler(ctx)
+	var cnt int32
+	job := s.Schedule(Every(50*time.Millisecond), func(_ context.Context, _ time.Time) {
+		atomic.AddInt32(&cnt, 1)
+	}, WithJitter(10*time.Millisecond))
+	time.Sleep(180 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-job.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected job to stop after context cancellation")
+	}
+	s.Stop()
+
+	if c := atomic.LoadInt32(&cnt); c == 0 {
+		t.Fatal("Expected the job to run")
+	}
+}
@@ -0,0 +1,132 @@
+package timers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/quintans/toolkit/clock"
+)
+
+// Throttle limits the execution of an action to at most once per interval.
+// Executions of the action never overlap, so the action must not call Call.
+type Throttle struct {
+	mu      sync.Mutex
+	serial  serializer
+	timer   *timerEntry
+	gen     int
+	item    interface{}
+	pending bool
+
+	interval time.Duration
+	action   func(arg interface{})
+	leading  bool
+	trailing bool
+	timers   *timerQueue
+}
+
+// ThrottleOption configures a Throttle
+type ThrottleOption func(*Throttle)
+
+// ThrottleLeading sets if the action is executed immediately on the first call of an interval. Default is true.
+func ThrottleLeading(leading bool) ThrottleOption {
+	return func(t *Throttle) {
+		t.leading = leading
+	}
+}
+
+// ThrottleTrailing sets if the action is executed at the end of the interval,
+// with the last item, when there were calls during the interval. Default is true.
+func ThrottleTrailing(trailing bool) ThrottleOption {
+	return func(t *Throttle) {
+		t.trailing = trailing
+	}
+}
+
+// ThrottleClock sets the clock used by the interval timer
+func ThrottleClock(c clock.Clock) ThrottleOption {
+	return func(t *Throttle) {
+		t.timers = timerQueueFor(c)
+	}
+}
+
+// NewThrottle creates a Throttle
+func NewThrottle(interval time.Duration, action func(arg interface{}), options ...ThrottleOption) *Throttle {
+	t := &Throttle{
+		interval: interval,
+		action:   action,
+		leading:  true,
+		trailing: true,
+		timers:   defaultTimerQueue,
+	}
+	for _, o := range options {
+		o(t)
+	}
+	return t
+}
+
+// Call requests the execution of the action with item.
+// A leading execution runs in the caller goroutine, after any execution in progress returns.
+func (t *Throttle) Call(item interface{}) {
+	t.mu.Lock()
+	if t.timer != nil {
+		// inside an interval
+		t.item = item
+		t.pending = true
+		t.mu.Unlock()
+		return
+	}
+
+	t.startInterval()
+	if t.leading {
+		t.mu.Unlock()
+		t.serial.do(func() {
+			t.action(item)
+		})
+		return
+	}
+	t.item = item
+	t.pending = true
+	t.mu.Unlock()
+}
+
+// Stop discards any pending execution
+func (t *Throttle) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.timers.cancel(t.timer)
+	t.timer = nil
+	t.gen++
+	t.item = nil
+	t.pending = false
+}
+
+// startInterval must be called with mu held
+func (t *Throttle) startInterval() {
+	gen := t.gen
+	t.timer = t.timers.schedule(t.interval, &t.serial, func() {
+		t.endInterval(gen)
+	})
+}
+
+func (t *Throttle) endInterval(gen int) {
+	t.mu.Lock()
+	if gen != t.gen {
+		t.mu.Unlock()
+		return
+	}
+	t.gen++
+	t.timer = nil
+	item, pending := t.item, t.pending
+	t.item = nil
+	t.pending = false
+	if !t.trailing || !pending {
+		t.mu.Unlock()
+		return
+	}
+	// the trailing execution starts a new interval
+	t.startInterval()
+	t.mu.Unlock()
+
+	t.action(item)
+}
@@ -1,47 +1,45 @@
 package timers
 
 import (
-	"sync"
+	"context"
 	"time"
 )
 
+// Ticker calls a handler at a fixed rate.
+// If the handler takes longer than the interval, the next tick is queued instead of being dropped.
 type Ticker struct {
-	once   sync.Once
-	stop   chan struct{}
-	ticker *time.Ticker
+	job *Job
 }
 
-func NewTicker(duration time.Duration, hnd func(time.Time)) *Ticker {
-	return NewDelayedTicker(duration, duration, hnd)
+func NewTicker(duration time.Duration, hnd func(time.Time), options ...JobOption) *Ticker {
+	return NewDelayedTicker(duration, duration, hnd, options...)
 }
 
-func NewDelayedTicker(delay time.Duration, duration time.Duration, hnd func(time.Time)) *Ticker {
-	tck := &Ticker{
-		stop: make(chan struct{}, 1),
+// NewDelayedTicker creates a ticker whose first tick happens after delay.
+// Options, like WithClock, are applied to the underlying Job.
+func NewDelayedTicker(delay time.Duration, duration time.Duration, hnd func(time.Time), options ...JobOption) *Ticker {
+	options = append([]JobOption{WithOverlap(OverlapQueue)}, options...)
+	options = append(options, WithInitialDelay(delay))
+	job := NewJob(
+		context.Background(),
+		Every(duration),
+		func(_ context.Context, t time.Time) {
+			hnd(t)
+		},
+		options...,
+	)
+	return &Ticker{
+		job: job,
 	}
-
-	go func() {
-		if delay > 0 {
-			time.Sleep(delay)
-		}
-		hnd(time.Now())
-
-		tck.ticker = time.NewTicker(duration)
-		for {
-			select {
-			case <-tck.stop:
-				return
-			case t := <-tck.ticker.C:
-				hnd(t)
-			}
-		}
-	}()
-
-	return tck
 }
 
+// Stop stops the ticker without waiting for a running handler, so it can be called by the handler itself
 func (tck *Ticker) Stop() {
-	tck.once.Do(func() {
-		close(tck.stop)
-	})
+	tck.job.cancel()
+}
+
+// StopWait stops the ticker and waits for a running handler to return.
+// It must not be called by the handler, since it would wait for itself.
+func (tck *Ticker) StopWait() {
+	tck.job.Stop()
 }
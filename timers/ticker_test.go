@@ -1,21 +1,51 @@
 package timers
 
 import (
-	"fmt"
 	"testing"
 	"time"
+
+	"github.com/quintans/toolkit/clock"
 )
 
 func TestTicker(t *testing.T) {
-	cnt := 0
+	clk := clock.NewFake(time.Now())
+	ticks := make(chan time.Time, 10)
 	tick := NewTicker(time.Second, func(t time.Time) {
-		cnt++
-		fmt.Println(t, "count=", cnt)
-	})
+		ticks <- t
+	}, WithClock(clk))
 
-	<-time.After(time.Millisecond * 3500)
-	tick.Stop()
-	if cnt != 3 {
-		t.Fatal("Expected 3 counts, got", cnt)
+	for i := 0; i < 3; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(time.Second)
+		<-ticks
+	}
+	clk.BlockUntil(1)
+	clk.Advance(500 * time.Millisecond)
+	tick.StopWait()
+	if len(ticks) != 0 {
+		t.Fatal("Expected 3 counts, got", 3+len(ticks))
+	}
+}
+
+func TestTickerStopFromHandler(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	var tick *Ticker
+	stopped := make(chan struct{})
+	tick = NewTicker(time.Second, func(t time.Time) {
+		tick.Stop()
+		close(stopped)
+	}, WithClock(clk))
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the handler to stop the ticker")
+	}
+	select {
+	case <-tick.job.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected the ticker to stop")
 	}
 }
@@ -0,0 +1,213 @@
+package timers
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/quintans/toolkit/clock"
+)
+
+// timerQueue is a heap of timers served by a single goroutine.
+// It is shared by Batcher, Throttle and KeyedDebouncer so that
+// we do not need a goroutine for each instance.
+// The goroutine only runs while there are timers in the queue.
+// Callbacks are executed outside of the queue goroutine so that a slow callback does not delay the others.
+// Callbacks scheduled with the same serializer run one at a time, in the order they were due,
+// otherwise each runs in its own goroutine.
+type timerQueue struct {
+	mu      sync.Mutex
+	entries timerHeap
+	seq     uint64
+	wake    chan struct{}
+	running bool
+	clock   clock.Clock
+}
+
+type timerEntry struct {
+	at     time.Time
+	fn     func()
+	serial *serializer
+	// breaks ties between entries due at the same time
+	seq   uint64
+	index int
+}
+
+var defaultTimerQueue = newTimerQueue(clock.New())
+
+func newTimerQueue(c clock.Clock) *timerQueue {
+	return &timerQueue{
+		wake:  make(chan struct{}, 1),
+		clock: c,
+	}
+}
+
+// timerQueueFor returns the shared timer queue if the clock is the default one,
+// otherwise a queue of its own, that is released with its user
+func timerQueueFor(c clock.Clock) *timerQueue {
+	if c == nil || c == clock.New() {
+		return defaultTimerQueue
+	}
+	return newTimerQueue(c)
+}
+
+// schedule calls fn after d. If s is not nil, fn is executed by s.
+func (q *timerQueue) schedule(d time.Duration, s *serializer, fn func()) *timerEntry {
+	e := &timerEntry{
+		at:     q.clock.Now().Add(d),
+		fn:     fn,
+		serial: s,
+	}
+	q.mu.Lock()
+	q.seq++
+	e.seq = q.seq
+	heap.Push(&q.entries, e)
+	first := e.index == 0
+	start := !q.running
+	q.running = true
+	q.mu.Unlock()
+
+	if start {
+		go q.loop()
+	} else if first {
+		q.signal()
+	}
+	return e
+}
+
+// cancel removes the entry from the queue.
+// It returns false if the entry was already dispatched or cancelled.
+func (q *timerQueue) cancel(e *timerEntry) bool {
+	if e == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if e.index < 0 {
+		return false
+	}
+	heap.Remove(&q.entries, e.index)
+	return true
+}
+
+func (q *timerQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *timerQueue) loop() {
+	for {
+		q.mu.Lock()
+		now := q.clock.Now()
+		var due []*timerEntry
+		for len(q.entries) > 0 && !q.entries[0].at.After(now) {
+			due = append(due, heap.Pop(&q.entries).(*timerEntry))
+		}
+		empty := len(q.entries) == 0
+		var wait time.Duration
+		if empty {
+			// schedule starts a new goroutine when needed
+			q.running = false
+		} else {
+			wait = q.entries[0].at.Sub(now)
+		}
+		q.mu.Unlock()
+
+		for _, e := range due {
+			if e.serial != nil {
+				e.serial.run(e.fn)
+			} else {
+				go e.fn()
+			}
+		}
+		if empty {
+			return
+		}
+
+		t := q.clock.NewTimer(wait)
+		select {
+		case <-t.C():
+		case <-q.wake:
+			t.Stop()
+		}
+	}
+}
+
+// serializer executes functions one at a time.
+// Functions passed to run are executed in order by a goroutine that only lives while there is work,
+// and functions passed to do are executed in the caller goroutine, between them.
+type serializer struct {
+	mu      sync.Mutex
+	pending []func()
+	running bool
+	// held while a function is executing
+	exec sync.Mutex
+}
+
+func (s *serializer) run(fn func()) {
+	s.mu.Lock()
+	s.pending = append(s.pending, fn)
+	start := !s.running
+	s.running = true
+	s.mu.Unlock()
+
+	if start {
+		go s.drain()
+	}
+}
+
+func (s *serializer) do(fn func()) {
+	s.exec.Lock()
+	defer s.exec.Unlock()
+	fn()
+}
+
+func (s *serializer) drain() {
+	for {
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.running = false
+			s.mu.Unlock()
+			return
+		}
+		fn := s.pending[0]
+		s.pending[0] = nil
+		s.pending = s.pending[1:]
+		s.mu.Unlock()
+
+		s.do(fn)
+	}
+}
+
+type timerHeap []*timerEntry
+
+func (h timerHeap) Len() int { return len(h) }
+func (h timerHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].at.Before(h[j].at)
+}
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timerHeap) Push(x interface{}) {
+	e := x.(*timerEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *timerHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+	return e
+}
@@ -0,0 +1,80 @@
+package timers
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quintans/toolkit/clock"
+)
+
+func TestTimerQueueStopsWhenEmpty(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	q := timerQueueFor(clk)
+	if q == defaultTimerQueue {
+		t.Fatal("Expected a queue for the fake clock")
+	}
+
+	fired := make(chan struct{}, 2)
+	q.schedule(time.Second, nil, func() { fired <- struct{}{} })
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	<-fired
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		q.mu.Lock()
+		running := q.running
+		q.mu.Unlock()
+		if !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the goroutine of the empty queue to stop")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// it starts again
+	q.schedule(time.Second, nil, func() { fired <- struct{}{} })
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	<-fired
+}
+
+func TestTimerQueueSerial(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	q := timerQueueFor(clk)
+
+	var s serializer
+	var mu sync.Mutex
+	var order []int
+	running := int32(0)
+	done := make(chan struct{}, 3)
+	for i := 0; i < 3; i++ {
+		i := i
+		q.schedule(time.Second, &s, func() {
+			if atomic.AddInt32(&running, 1) != 1 {
+				t.Error("Expected callbacks of the same serializer not to overlap")
+			}
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			atomic.AddInt32(&running, -1)
+			done <- struct{}{}
+		})
+	}
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != 3 || order[0] != 0 || order[1] != 1 || order[2] != 2 {
+		t.Fatal("Expected callbacks in scheduling order, got", order)
+	}
+}
@@ -0,0 +1,90 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/quintans/toolkit"
+	"github.com/quintans/toolkit/log"
+)
+
+const (
+	// RequestIDHeader is the header with the ID of the request, propagated between services
+	RequestIDHeader = "X-Request-ID"
+	// TraceParentHeader is the W3C trace context header, with the trace and span IDs
+	TraceParentHeader = "traceparent"
+)
+
+// request IDs longer than this, or with other than printable ASCII characters, are replaced,
+// since they are logged with every message
+const maxRequestIDSize = 128
+
+type requestIDKey struct{}
+
+// RequestID is a middleware that takes the X-Request-ID of the request or, if absent or invalid, generates one,
+// and sets it in the response.
+//
+// The request context carries a logger with the request ID field and, if the request has a valid traceparent header,
+// the trace and span ID fields. It is obtained with log.FromContext(r.Context()).
+// The logger is the one already carried by the context or, if none, the root logger.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = toolkit.NewUUID().String()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		fields := []interface{}{log.RequestIDKey, id}
+		if traceID, spanID, ok := parseTraceParent(r.Header.Get(TraceParentHeader)); ok {
+			fields = append(fields, log.TraceIDKey, traceID, log.SpanIDKey, spanID)
+		}
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = log.ContextWith(ctx, fields...)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFrom returns the request ID set by the RequestID middleware, or an empty string
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDSize {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTraceParent returns the trace and span IDs of a traceparent header: version-traceid-spanid-flags
+func parseTraceParent(header string) (string, string, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", "", false
+	}
+	traceID, spanID := parts[1], parts[2]
+	if len(traceID) != 32 || len(spanID) != 16 || !isHex(traceID) || !isHex(spanID) ||
+		strings.Trim(traceID, "0") == "" || strings.Trim(spanID, "0") == "" {
+		return "", "", false
+	}
+	return traceID, spanID, true
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
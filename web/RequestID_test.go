@@ -0,0 +1,49 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/quintans/toolkit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveRequestID(header http.Header) (*httptest.ResponseRecorder, []log.Field, string) {
+	var fields []log.Field
+	var id string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fields = log.FromContext(r.Context()).Fields()
+		id = RequestIDFrom(r.Context())
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w, fields, id
+}
+
+func TestRequestIDPropagated(t *testing.T) {
+	w, fields, id := serveRequestID(http.Header{
+		"X-Request-Id": {"abc-123"},
+		"Traceparent":  {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	})
+	assert.Equal(t, "abc-123", id)
+	assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+	assert.Equal(t, []log.Field{
+		log.String(log.RequestIDKey, "abc-123"),
+		log.String(log.TraceIDKey, "4bf92f3577b34da6a3ce929d0e0e4736"),
+		log.String(log.SpanIDKey, "00f067aa0ba902b7"),
+	}, fields)
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	for _, header := range []http.Header{nil, {"X-Request-Id": {"bad id\x01"}}} {
+		w, fields, id := serveRequestID(header)
+		assert.Len(t, id, 32)
+		assert.Equal(t, id, w.Header().Get(RequestIDHeader))
+		assert.Equal(t, []log.Field{log.String(log.RequestIDKey, id)}, fields)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"net/http"
 	"strconv"
 	"time"
+
+	"github.com/quintans/toolkit/clock"
 )
 
 type Client struct {
@@ -30,17 +32,31 @@ type Poller struct {
 	pipe          chan Message
 	timeout       time.Duration
 	removeChannel chan chan []Message
+	clock         clock.Clock
+}
+
+type Option func(*Poller)
+
+// WithClock sets the clock used for the polling timeouts and message expiration
+func WithClock(c clock.Clock) Option {
+	return func(p *Poller) {
+		p.clock = clock.OrDefault(c)
+	}
 }
 
-func NewPoller(timeout time.Duration) *Poller {
+func NewPoller(timeout time.Duration, options ...Option) *Poller {
 	this := new(Poller)
 	this.addClient = make(chan Client, 1)
 	this.pipe = make(chan Message, 1)
 	this.removeChannel = make(chan chan []Message, 1)
 	this.timeout = timeout
+	this.clock = clock.New()
+	for _, o := range options {
+		o(this)
+	}
 
 	channels := list.New()
-	tick := time.Tick(this.timeout)
+	tick := this.clock.NewTicker(this.timeout).C()
 	var version int64
 	var messages = make(map[string]Message)
 	var clients = make(map[chan []Message]*list.Element)
@@ -95,7 +111,7 @@ func NewPoller(timeout time.Duration) *Poller {
 
 			case <-tick:
 				// delete expired messages
-				mark := time.Now().Add(-this.timeout)
+				mark := this.clock.Now().Add(-this.timeout)
 				for k, v := range messages {
 					if v.timestamp.Before(mark) {
 						delete(messages, k)
@@ -127,7 +143,7 @@ func (this *Poller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	this.addClient <- Client{Tokens: tokens, Channel: message}
 
 	select {
-	case <-time.After(this.timeout):
+	case <-this.clock.After(this.timeout):
 		this.removeChannel <- message
 		sendMessage(w, []Message{Message{Version: 0}})
 
@@ -148,7 +164,7 @@ func sendMessage(w http.ResponseWriter, m []Message) {
 
 func (this *Poller) Broadcast(name string, data interface{}) {
 	this.pipe <- Message{
-		timestamp: time.Now(),
+		timestamp: this.clock.Now(),
 		Name:      name,
 		Data:      data,
 	}